@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"flag"
 	"fmt"
 	"log"
@@ -12,8 +13,12 @@ import (
 
 	"github.com/AdamGriffiths31/pulseboard/internal/db"
 	"github.com/AdamGriffiths31/pulseboard/internal/handlers"
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
 	"github.com/AdamGriffiths31/pulseboard/internal/models"
 	"github.com/AdamGriffiths31/pulseboard/internal/poller"
+	"github.com/AdamGriffiths31/pulseboard/internal/retention"
+	"github.com/AdamGriffiths31/pulseboard/internal/rollup"
+	"github.com/AdamGriffiths31/pulseboard/internal/secrets"
 	"github.com/AdamGriffiths31/pulseboard/internal/websocket"
 
 	"github.com/google/uuid"
@@ -21,11 +26,44 @@ import (
 
 func main() {
 	runPoller := flag.Bool("run-poller", false, "Run the poller to monitor endpoints")
+	maxConcurrent := flag.Int("max-concurrent-checks", poller.DefaultLimits.MaxConcurrent, "Maximum number of checks running at once")
+	maxPerHost := flag.Int("max-checks-per-host", 0, "Maximum number of checks running at once against one host (0 for no limit)")
+	secretKeyFile := flag.String("secret-key-file", "secret.key", "File holding the key that encrypts sensitive headers, created if missing. PULSEBOARD_SECRET_KEY overrides it.")
+	rollupInterval := flag.Duration("rollup-interval", rollup.DefaultInterval, "How often new metrics are rolled up into minute, hour and day buckets")
+	retainRawDays := flag.Int("retain-raw-days", models.DefaultRetention.RawDays, "Days raw metrics are kept, unless an endpoint overrides it")
+	retainMinuteDays := flag.Int("retain-minute-days", models.DefaultRetention.MinuteDays, "Days minute rollups are kept, unless an endpoint overrides it")
+	retainHourDays := flag.Int("retain-hour-days", models.DefaultRetention.HourDays, "Days hour rollups are kept, unless an endpoint overrides it")
+	pruneInterval := flag.Duration("prune-interval", retention.DefaultInterval, "How often expired metrics and rollups are deleted")
+	migrateDryRun := flag.Bool("migrate-dry-run", false, "Check the schema migrations metrics.db needs without applying them, then exit")
 	flag.Parse()
 
+	secretKey := []byte(os.Getenv("PULSEBOARD_SECRET_KEY"))
+	if len(secretKey) == 0 {
+		var err error
+		if secretKey, err = secrets.LoadOrCreateKey(*secretKeyFile); err != nil {
+			log.Fatal("Failed to load secret key:", err)
+		}
+	}
+	box, err := secrets.NewBox(secretKey)
+	if err != nil {
+		log.Fatal("Invalid secret key:", err)
+	}
+
+	if *migrateDryRun {
+		if err := checkMigrations("metrics.db", box); err != nil {
+			log.Fatal("Schema migrations would fail:", err)
+		}
+		return
+	}
+
+	retentionPolicy := models.RetentionPolicy{RawDays: *retainRawDays, MinuteDays: *retainMinuteDays, HourDays: *retainHourDays}
+	if err := retentionPolicy.Validate(false); err != nil {
+		log.Fatal("Invalid retention policy:", err)
+	}
+
 	log.Println("Pulseboard Poller Starting...")
 
-	sqlClient, err := db.NewSQLiteClient("metrics.db")
+	sqlClient, err := db.NewSQLiteClient("metrics.db", box)
 	if err != nil {
 		log.Fatal("Failed to connect to SQLite:", err)
 	}
@@ -57,6 +95,7 @@ func main() {
 				URL:       "https://httpstat.us/200?sleep=10000",
 				Frequency: 10 * time.Second,
 				Headers:   map[string]string{},
+				TimeoutMS: 15000, // The endpoint deliberately takes 10 seconds to respond
 			},
 		}
 
@@ -68,24 +107,76 @@ func main() {
 		}
 	}
 
+	// Poller results are broadcast to live WebSocket clients through the hub
+	metricsHub := hub.New(hub.DefaultBufferSize)
+
+	// Without --run-poller endpoints can still be managed, they just aren't polled
+	var scheduler handlers.EndpointScheduler = noopScheduler{}
+	var pollScheduler *poller.Scheduler
 	if *runPoller {
-		stopChan := make(chan os.Signal, 1)
-		signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
+		limits := poller.Limits{MaxConcurrent: *maxConcurrent, MaxPerHost: *maxPerHost}
+		pollScheduler = poller.NewScheduler(sqlClient, metricsHub, limits)
+		pollScheduler.Start(endpoints)
+		scheduler = pollScheduler
+	}
 
-		poller.StartPolling(endpoints, sqlClient)
+	// Charts over long ranges read rollups rather than raw metrics
+	rollupJob := rollup.NewJob(sqlClient, *rollupInterval, rollup.DefaultSettle)
+	rollupJob.Start()
 
-		go func() {
-			<-stopChan
+	// Expired metrics and rollups are deleted in the background
+	pruner := retention.NewPruner(sqlClient, retentionPolicy, *pruneInterval, retention.DefaultBatchSize)
+	pruner.Start()
+
+	stopChan := make(chan os.Signal, 1)
+	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-stopChan
+		if pollScheduler != nil {
 			log.Println("Shutting down poller...")
-		}()
-	}
+			// Let in-flight checks finish and be stored before exiting
+			pollScheduler.Stop()
+		}
+		rollupJob.Stop()
+		pruner.Stop()
+		os.Exit(0)
+	}()
 
 	// Set up HTTP routes and handlers
 	http.HandleFunc("/getlatency", handlers.GetLatencyMetrics(sqlClient))
 	http.HandleFunc("/statuscodedistribution", handlers.GetStatusCodeDistribution(sqlClient))
+	http.HandleFunc("/latencybreakdown", handlers.GetLatencyBreakdown(sqlClient))
+	http.HandleFunc("/latencyrollups", handlers.GetLatencyRollups(sqlClient))
+	http.HandleFunc("/latencypercentiles", handlers.GetLatencyPercentiles(sqlClient))
+	http.HandleFunc("/certificates/expiring", handlers.GetExpiringCertificates(sqlClient))
+	http.HandleFunc("GET /endpoints", handlers.ListEndpoints(sqlClient))
+	http.HandleFunc("POST /endpoints", handlers.CreateEndpoint(sqlClient, scheduler))
+	http.HandleFunc("GET /endpoints/{id}", handlers.GetEndpoint(sqlClient))
+	http.HandleFunc("PUT /endpoints/{id}", handlers.UpdateEndpoint(sqlClient, scheduler))
+	http.HandleFunc("DELETE /endpoints/{id}", handlers.DeleteEndpoint(sqlClient, scheduler))
+	http.HandleFunc("POST /endpoints/{id}/pause", handlers.PauseEndpoint(sqlClient, scheduler))
+	http.HandleFunc("POST /endpoints/{id}/resume", handlers.ResumeEndpoint(sqlClient, scheduler))
+	http.HandleFunc("OPTIONS /endpoints", handlers.EndpointsPreflight())
+	http.HandleFunc("OPTIONS /endpoints/", handlers.EndpointsPreflight())
+	http.HandleFunc("GET /authprofiles", handlers.ListAuthProfiles(sqlClient))
+	http.HandleFunc("POST /authprofiles", handlers.CreateAuthProfile(sqlClient))
+	http.HandleFunc("GET /authprofiles/{id}", handlers.GetAuthProfile(sqlClient))
+	http.HandleFunc("PUT /authprofiles/{id}", handlers.UpdateAuthProfile(sqlClient))
+	http.HandleFunc("DELETE /authprofiles/{id}", handlers.DeleteAuthProfile(sqlClient))
+	http.HandleFunc("OPTIONS /authprofiles", handlers.EndpointsPreflight())
+	http.HandleFunc("OPTIONS /authprofiles/", handlers.EndpointsPreflight())
+	http.HandleFunc("/ping/{token}", handlers.ReceivePing(sqlClient, scheduler, metricsHub, models.PingSuccess))
+	http.HandleFunc("/ping/{token}/start", handlers.ReceivePing(sqlClient, scheduler, metricsHub, models.PingStart))
+	http.HandleFunc("/ping/{token}/fail", handlers.ReceivePing(sqlClient, scheduler, metricsHub, models.PingFail))
+	http.HandleFunc("GET /pruner/status", handlers.GetPrunerStatus(pruner))
+	if pollScheduler != nil {
+		http.HandleFunc("GET /poller/stats", handlers.GetPollerStats(pollScheduler))
+	}
 	http.HandleFunc("/generatetestdata", handlers.GenerateTestData(sqlClient))
+	http.HandleFunc("/events", handlers.StreamEvents(metricsHub, sqlClient))
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		websocket.HandleWebSocket(w, r, sqlClient)
+		websocket.HandleWebSocket(w, r, metricsHub, sqlClient)
 	})
 
 	port := ":8080"
@@ -100,3 +191,33 @@ func main() {
 
 	select {}
 }
+
+// Run the pending schema migrations in a transaction that is rolled back,
+// listing what an upgrade would apply
+func checkMigrations(path string, box *secrets.Box) error {
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	pending, err := db.Migrate(conn, box, true)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Printf("%s is at schema version %d, nothing to apply\n", path, db.LatestSchemaVersion())
+		return nil
+	}
+	for _, m := range pending {
+		fmt.Printf("Would apply migration %d: %s\n", m.Version, m.Description)
+	}
+	return nil
+}
+
+// Scheduler used when the poller isn't running
+type noopScheduler struct{}
+
+func (noopScheduler) Add(models.MonitoredEndpoint)    {}
+func (noopScheduler) Update(models.MonitoredEndpoint) {}
+func (noopScheduler) Remove(uuid.UUID)                {}
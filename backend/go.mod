@@ -6,4 +6,15 @@ require github.com/google/uuid v1.6.0
 
 require github.com/mattn/go-sqlite3 v1.14.28
 
-require github.com/gorilla/websocket v1.5.3 
+require (
+	github.com/gorilla/websocket v1.5.3
+	google.golang.org/grpc v1.70.0
+)
+
+require (
+	golang.org/x/net v0.32.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241202173237-19429a94021a // indirect
+	google.golang.org/protobuf v1.35.2 // indirect
+)
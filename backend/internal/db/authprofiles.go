@@ -0,0 +1,111 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+const authProfileColumns = `id, name, type, COALESCE(username, ''), COALESCE(password, ''), COALESCE(token, ''),
+	COALESCE(token_url, ''), COALESCE(client_id, ''), COALESCE(client_secret, ''), COALESCE(scopes, ''),
+	COALESCE(client_cert, ''), COALESCE(client_key, '')`
+
+// Store an auth profile, encrypting its secrets
+func (c *SQLiteClient) StoreAuthProfile(p models.AuthProfile) error {
+	for _, secret := range []*string{&p.Password, &p.Token, &p.ClientSecret, &p.ClientKey} {
+		if *secret == "" {
+			continue
+		}
+		if c.Secrets == nil {
+			return errors.New("can't store auth profile secrets without a secret key")
+		}
+		sealed, err := c.Secrets.Seal(*secret)
+		if err != nil {
+			return err
+		}
+		*secret = sealed
+	}
+
+	scopes, err := marshalOptional(p.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DB.Exec(`
+		INSERT OR REPLACE INTO auth_profiles (id, name, type, username, password, token, token_url, client_id, client_secret,
+			scopes, client_cert, client_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.ID.String(), p.Name, string(p.Type), p.Username, p.Password, p.Token, p.TokenURL, p.ClientID, p.ClientSecret,
+		scopes, p.ClientCert, p.ClientKey,
+	)
+	return err
+}
+
+// Fetch an auth profile with its secrets decrypted, returning ErrNotFound if
+// it doesn't exist
+func (c *SQLiteClient) GetAuthProfile(id uuid.UUID) (models.AuthProfile, error) {
+	row := c.DB.QueryRow("SELECT "+authProfileColumns+" FROM auth_profiles WHERE id = ?", id.String())
+	p, err := c.scanAuthProfile(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, ErrNotFound
+	}
+	return p, err
+}
+
+// Fetch every auth profile with its secrets decrypted
+func (c *SQLiteClient) GetAllAuthProfiles() ([]models.AuthProfile, error) {
+	rows, err := c.DB.Query("SELECT " + authProfileColumns + " FROM auth_profiles ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var profiles []models.AuthProfile
+	for rows.Next() {
+		p, err := c.scanAuthProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, rows.Err()
+}
+
+// Delete an auth profile. Returns ErrInUse while endpoints still use it.
+func (c *SQLiteClient) DeleteAuthProfile(id uuid.UUID) error {
+	var users int
+	if err := c.DB.QueryRow("SELECT COUNT(*) FROM monitored_endpoints WHERE auth_profile_id = ?", id.String()).Scan(&users); err != nil {
+		return err
+	}
+	if users > 0 {
+		return ErrInUse
+	}
+
+	res, err := c.DB.Exec("DELETE FROM auth_profiles WHERE id = ?", id.String())
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+func (c *SQLiteClient) scanAuthProfile(row scanner) (models.AuthProfile, error) {
+	var p models.AuthProfile
+	var scopes string
+	err := row.Scan(&p.ID, &p.Name, &p.Type, &p.Username, &p.Password, &p.Token, &p.TokenURL, &p.ClientID,
+		&p.ClientSecret, &scopes, &p.ClientCert, &p.ClientKey)
+	if err != nil {
+		return p, err
+	}
+	if err := unmarshalOptional(scopes, &p.Scopes); err != nil {
+		return p, err
+	}
+
+	for _, secret := range []*string{&p.Password, &p.Token, &p.ClientSecret, &p.ClientKey} {
+		if *secret, err = c.Secrets.Open(*secret); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Fetch the heartbeat monitor with the given ping token, returning
+// ErrNotFound if none has it
+func (c *SQLiteClient) GetEndpointByPingToken(token string) (models.MonitoredEndpoint, error) {
+	row := c.DB.QueryRow("SELECT "+endpointColumns+" FROM monitored_endpoints WHERE type = ? AND ping_token = ? AND ping_token != ''",
+		string(models.CheckHeartbeat), token)
+	ep, err := c.scanEndpoint(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ep, ErrNotFound
+	}
+	return ep, err
+}
+
+// Record where a heartbeat monitor's job is up to, returning ErrNotFound if
+// the monitor doesn't exist
+func (c *SQLiteClient) SetPingState(id uuid.UUID, state models.PingState) error {
+	res, err := c.DB.Exec("UPDATE monitored_endpoints SET last_ping_at = ?, running_since = ?, ping_start_log = ? WHERE id = ?",
+		optionalTimestamp(state.LastPingAt), optionalTimestamp(state.RunningSince), state.StartLog, id.String())
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
@@ -0,0 +1,203 @@
+package db
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Add everything from a time range into a builder's buckets, reading each
+// stretch from the coarsest rollups that have reached it, up to the given
+// resolution. Time past what those have been rolled up to is filled in from
+// finer rollups and then raw metrics, so recent data is complete too and data
+// pruned from the finer tables is still counted.
+func (c *SQLiteClient) collectRange(b *rollupBuilder, coarsest models.Resolution, from, to time.Time) error {
+	for i := slices.Index(models.Resolutions, coarsest); i >= 0; i-- {
+		r := models.Resolutions[i]
+		until, err := c.RolledUntil(r)
+		if err != nil {
+			return err
+		}
+		if until.After(to) {
+			until = to
+		}
+		if !until.After(from) {
+			continue
+		}
+		if err := c.mergeRollups(b, r, from, until); err != nil {
+			return err
+		}
+		from = until
+	}
+	return c.mergeMetrics(b, from, to)
+}
+
+// Merge the rollups at a resolution from a time range into a builder's buckets
+func (c *SQLiteClient) mergeRollups(b *rollupBuilder, r models.Resolution, from, to time.Time) error {
+	rows, err := c.DB.Query(`
+		SELECT `+rollupColumns+`, e.url
+		FROM metric_rollups r
+		JOIN monitored_endpoints e ON r.endpoint_id = e.id
+		WHERE r.resolution = ? AND r.bucket_start >= ? AND r.bucket_start < ?`,
+		string(r), formatTimestamp(from), formatTimestamp(to))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rollup, err := scanRollup(rows)
+		if err != nil {
+			return err
+		}
+		b.bucket(rollup.EndpointID, rollup.URL, rollup.BucketStart).Merge(rollup)
+	}
+	return rows.Err()
+}
+
+// Add the raw metrics from a time range to a builder's buckets
+func (c *SQLiteClient) mergeMetrics(b *rollupBuilder, from, to time.Time) error {
+	rows, err := c.DB.Query(`
+		SELECT `+rollupMetricColumns+`, e.url
+		FROM api_metrics m
+		JOIN monitored_endpoints e ON m.endpoint_id = e.id
+		WHERE m.timestamp >= ? AND m.timestamp < ?`,
+		formatTimestamp(from), formatTimestamp(to))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanRollupMetric(rows)
+		if err != nil {
+			return err
+		}
+		b.bucket(m.EndpointID, m.URL, m.Timestamp).Add(m)
+	}
+	return rows.Err()
+}
+
+// Every check in a date range, summed per URL. Long ranges are read from
+// coarser rollups, so whole buckets overlapping the start of the range are
+// counted.
+func (c *SQLiteClient) rangeTotals(start, end time.Time) ([]*models.Rollup, error) {
+	r := models.ChooseResolution(start, end)
+	b := newRollupBuilder(0)
+	b.byURL = true
+	if err := c.collectRange(b, r, r.Truncate(start), end.Add(time.Millisecond)); err != nil { // End is inclusive
+		return nil, err
+	}
+	return b.rollups, nil
+}
+
+// Count confirmed checks in a date range by status code and whether they
+// succeeded, grouped by URL, optionally only those that failed for a reason.
+// Checks made without HTTP have no status code, so are only told apart by
+// success.
+func (c *SQLiteClient) GetStatusCodeDistributionByURL(start, end time.Time, failureReason *models.FailureReason) (map[string][]models.StatusCodeCount, error) {
+	totals, err := c.rangeTotals(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	type statusKey struct {
+		statusCode int
+		success    bool
+	}
+	result := make(map[string][]models.StatusCodeCount)
+	for _, total := range totals {
+		byStatus := make(map[statusKey]int)
+		for outcome, count := range total.Outcomes {
+			if failureReason == nil || outcome.FailureReason == *failureReason {
+				byStatus[statusKey{outcome.StatusCode, outcome.FailureReason == models.FailureNone}] += count
+			}
+		}
+		for key, count := range byStatus {
+			result[total.URL] = append(result[total.URL], models.StatusCodeCount{
+				URL:        total.URL,
+				StatusCode: key.statusCode,
+				Success:    key.success,
+				Count:      count,
+			})
+		}
+	}
+	for _, counts := range result {
+		slices.SortFunc(counts, func(a, b models.StatusCodeCount) int {
+			if a.StatusCode != b.StatusCode {
+				return cmp.Compare(a.StatusCode, b.StatusCode)
+			}
+			if a.Success == b.Success {
+				return 0
+			}
+			if a.Success {
+				return -1
+			}
+			return 1
+		})
+	}
+	return result, nil
+}
+
+// Count confirmed failed checks in a date range by failure reason, grouped by
+// URL, optionally only those that failed for one reason
+func (c *SQLiteClient) GetFailureReasonDistributionByURL(start, end time.Time, failureReason *models.FailureReason) (map[string][]models.FailureReasonCount, error) {
+	totals, err := c.rangeTotals(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]models.FailureReasonCount)
+	for _, total := range totals {
+		byReason := make(map[models.FailureReason]int)
+		for outcome, count := range total.Outcomes {
+			if outcome.FailureReason != models.FailureNone && (failureReason == nil || outcome.FailureReason == *failureReason) {
+				byReason[outcome.FailureReason] += count
+			}
+		}
+		for reason, count := range byReason {
+			result[total.URL] = append(result[total.URL], models.FailureReasonCount{
+				URL:           total.URL,
+				FailureReason: reason,
+				Count:         count,
+			})
+		}
+	}
+	for _, counts := range result {
+		slices.SortFunc(counts, func(a, b models.FailureReasonCount) int { return cmp.Compare(a.FailureReason, b.FailureReason) })
+	}
+	return result, nil
+}
+
+// Fetch average per-phase timings in a date range, grouped by URL, in buckets
+// of the resolution that suits the range
+func (c *SQLiteClient) GetLatencyBreakdownByURL(start, end time.Time, excludeRetried bool) (map[string][]models.LatencyBreakdown, error) {
+	r := models.ChooseResolution(start, end)
+	b := newRollupBuilder(r.Duration())
+	b.byURL = true
+	if err := c.collectRange(b, r, r.Truncate(start), end.Add(time.Millisecond)); err != nil { // End is inclusive
+		return nil, err
+	}
+
+	result := make(map[string][]models.LatencyBreakdown)
+	for _, rollup := range b.rollups {
+		sum, count := rollup.Phases.All, rollup.Count
+		if excludeRetried {
+			sum, count = rollup.Phases.FirstAttempt, rollup.Phases.FirstAttempts
+		}
+		if count == 0 {
+			continue
+		}
+		result[rollup.URL] = append(result[rollup.URL], models.LatencyBreakdown{
+			Timestamp:    rollup.BucketStart,
+			Count:        count,
+			PhaseTimings: sum.Average(count),
+		})
+	}
+	for _, breakdown := range result {
+		slices.SortFunc(breakdown, func(a, b models.LatencyBreakdown) int { return a.Timestamp.Compare(b.Timestamp) })
+	}
+	return result, nil
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestRangesReadPrunedMetricsFromRollups(t *testing.T) {
+	client := newTestClient(t)
+
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: "https://api.example.com", Frequency: time.Minute}
+	if err := client.StoreEndpoint(ep); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	old := []models.Metric{
+		{StatusCode: 200, Success: true, Attempts: 1, PhaseTimings: models.PhaseTimings{DNSMS: 10, TTFBMS: 100}},
+		{StatusCode: 200, Success: true, Attempts: 3, PhaseTimings: models.PhaseTimings{DNSMS: 30, TTFBMS: 300}},
+		{StatusCode: 503, FailureReason: models.FailureUnexpectedStatus, Attempts: 1},
+		{FailureReason: models.FailureTimeout, Attempts: 1},
+		{StatusCode: 500, FailureReason: models.FailureUnexpectedStatus, Attempts: 1, Unconfirmed: true},
+	}
+	for i, m := range old {
+		m.ID, m.EndpointID, m.Timestamp = uuid.New(), ep.ID, day.Add(time.Duration(i)*time.Second)
+		if err := client.StoreMetric(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Roll everything up, then prune the raw metrics
+	if err := client.RollUpMetrics(day.Add(3*24*time.Hour), 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DB.Exec("DELETE FROM api_metrics"); err != nil {
+		t.Fatal(err)
+	}
+	// A recent metric that hasn't been rolled up yet
+	recent := models.Metric{ID: uuid.New(), EndpointID: ep.ID, Timestamp: day.Add(3*24*time.Hour + time.Minute), StatusCode: 200, Success: true, Attempts: 1}
+	if err := client.StoreMetric(recent); err != nil {
+		t.Fatal(err)
+	}
+
+	start, end := day, day.Add(4*24*time.Hour)
+	byStatus, err := client.GetStatusCodeDistributionByURL(start, end, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []models.StatusCodeCount{
+		{URL: ep.URL, StatusCode: 0, Count: 1},
+		{URL: ep.URL, StatusCode: 200, Success: true, Count: 3},
+		{URL: ep.URL, StatusCode: 503, Count: 1},
+	}
+	if !reflect.DeepEqual(byStatus[ep.URL], expected) {
+		t.Errorf("expected %+v, got %+v", expected, byStatus[ep.URL])
+	}
+
+	timeout := models.FailureTimeout
+	if filtered, err := client.GetStatusCodeDistributionByURL(start, end, &timeout); err != nil || len(filtered[ep.URL]) != 1 || filtered[ep.URL][0].StatusCode != 0 {
+		t.Errorf("expected only the timed out check, got %+v (%v)", filtered, err)
+	}
+
+	byReason, err := client.GetFailureReasonDistributionByURL(start, end, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedReasons := []models.FailureReasonCount{
+		{URL: ep.URL, FailureReason: models.FailureTimeout, Count: 1},
+		{URL: ep.URL, FailureReason: models.FailureUnexpectedStatus, Count: 1},
+	}
+	if !reflect.DeepEqual(byReason[ep.URL], expectedReasons) {
+		t.Errorf("expected %+v, got %+v", expectedReasons, byReason[ep.URL])
+	}
+	if filtered, err := client.GetFailureReasonDistributionByURL(start, end, &timeout); err != nil || !reflect.DeepEqual(filtered[ep.URL], expectedReasons[:1]) {
+		t.Errorf("expected only the timed out check, got %+v (%v)", filtered, err)
+	}
+
+	// Phase timings are averaged per minute over the first hour
+	breakdown, err := client.GetLatencyBreakdownByURL(day, day.Add(time.Hour), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := breakdown[ep.URL]; len(got) != 1 || got[0].Count != 5 || got[0].DNSMS != 8 || got[0].TTFBMS != 80 {
+		t.Errorf("unexpected breakdown %+v", got)
+	}
+	firstAttempts, err := client.GetLatencyBreakdownByURL(day, day.Add(time.Hour), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := firstAttempts[ep.URL]; len(got) != 1 || got[0].Count != 4 || got[0].DNSMS != 2 || got[0].TTFBMS != 25 {
+		t.Errorf("expected the retried check to be left out, got %+v", got)
+	}
+}
+
+func TestStatusCodeDistributionSplitsChecksWithoutHTTPOnSuccess(t *testing.T) {
+	client := newTestClient(t)
+
+	ep := models.MonitoredEndpoint{ID: uuid.New(), Type: models.CheckTCP, URL: "tcp://db.example.com:5432", Frequency: time.Minute}
+	if err := client.StoreEndpoint(ep); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	for i, m := range []models.Metric{
+		{Success: true},
+		{Success: true},
+		{FailureReason: models.FailureConnectionRefused},
+	} {
+		m.ID, m.EndpointID, m.Timestamp = uuid.New(), ep.ID, now.Add(-time.Duration(i)*time.Second)
+		if err := client.StoreMetric(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	byStatus, err := client.GetStatusCodeDistributionByURL(now.Add(-time.Hour), now, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []models.StatusCodeCount{
+		{URL: ep.URL, Success: true, Count: 2},
+		{URL: ep.URL, Count: 1},
+	}
+	if !reflect.DeepEqual(byStatus[ep.URL], expected) {
+		t.Errorf("expected up and down to be counted apart, got %+v", byStatus[ep.URL])
+	}
+}
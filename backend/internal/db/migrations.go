@@ -0,0 +1,478 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/AdamGriffiths31/pulseboard/internal/secrets"
+)
+
+// A versioned change to the schema. Each is applied once, in order, inside a
+// transaction, and recorded in the schema_version table.
+type Migration struct {
+	Version     int
+	Description string
+	up          migrationStep
+}
+
+// Change made by a migration. The box is for migrations that encrypt data,
+// and is nil when no secret key is configured.
+type migrationStep func(tx *sql.Tx, box *secrets.Box) error
+
+// Every migration in the order it is applied. Append new ones with the next
+// version; never edit or reorder one that has been released.
+//
+// Databases created before migrations were tracked have no schema_version
+// table but may already have some or all of these changes, so each one
+// leaves tables and columns that already exist alone.
+var migrations = []Migration{
+	{1, "create endpoints and metrics tables", exec(`
+	CREATE TABLE IF NOT EXISTS monitored_endpoints (
+		id TEXT PRIMARY KEY,
+		url TEXT,
+		frequency INTEGER,
+		headers TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS api_metrics (
+		id TEXT PRIMARY KEY,
+		endpoint_id TEXT,
+		timestamp DATETIME,
+		status_code INTEGER,
+		latency_ms INTEGER,
+		FOREIGN KEY(endpoint_id) REFERENCES monitored_endpoints(id)
+	);`)},
+	{2, "add request method, body and expected status", combine(addColumns(
+		column{"monitored_endpoints", "method", "TEXT DEFAULT 'GET'"},
+		column{"monitored_endpoints", "body", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "content_type", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "expected_status", "TEXT DEFAULT ''"},
+	), backfillColumn(
+		// Metrics from before success was recorded count as up if they got
+		// the status an endpoint expects by default
+		column{"api_metrics", "success", "INTEGER DEFAULT 0"},
+		"UPDATE api_metrics SET success = (status_code BETWEEN 200 AND 399)",
+	))},
+	{3, "add response assertions", addColumns(
+		column{"monitored_endpoints", "assertions", "TEXT DEFAULT ''"},
+		column{"api_metrics", "assertion_results", "TEXT DEFAULT ''"},
+	)},
+	{4, "add per-phase timings", addColumns(
+		column{"api_metrics", "dns_ms", "INTEGER DEFAULT 0"},
+		column{"api_metrics", "connect_ms", "INTEGER DEFAULT 0"},
+		column{"api_metrics", "tls_ms", "INTEGER DEFAULT 0"},
+		column{"api_metrics", "ttfb_ms", "INTEGER DEFAULT 0"},
+		column{"api_metrics", "transfer_ms", "INTEGER DEFAULT 0"},
+	)},
+	{5, "create certificates table", exec(`
+	CREATE TABLE IF NOT EXISTS endpoint_certificates (
+		endpoint_id TEXT,
+		position INTEGER,
+		subject TEXT,
+		sans TEXT,
+		issuer TEXT,
+		not_before DATETIME,
+		not_after DATETIME,
+		key_type TEXT,
+		hostname_verified INTEGER,
+		checked_at DATETIME,
+		PRIMARY KEY(endpoint_id, position),
+		FOREIGN KEY(endpoint_id) REFERENCES monitored_endpoints(id)
+	);`)},
+	{6, "add failure reasons", addColumns(
+		column{"api_metrics", "failure_reason", "TEXT DEFAULT ''"},
+		column{"api_metrics", "error_message", "TEXT DEFAULT ''"},
+	)},
+	{7, "add paused endpoints", addColumns(
+		column{"monitored_endpoints", "paused", "INTEGER DEFAULT 0"},
+	)},
+	{8, "add retry policies", addColumns(
+		column{"monitored_endpoints", "retries", "INTEGER DEFAULT 0"},
+		column{"monitored_endpoints", "retry_backoff_ms", "INTEGER DEFAULT 0"},
+		column{"monitored_endpoints", "confirm_after", "INTEGER DEFAULT 0"},
+		column{"api_metrics", "attempts", "INTEGER DEFAULT 1"},
+		column{"api_metrics", "unconfirmed", "INTEGER DEFAULT 0"},
+	)},
+	{9, "add timeout, redirect, proxy and TLS settings", addColumns(
+		column{"monitored_endpoints", "timeout_ms", "INTEGER DEFAULT 0"},
+		column{"monitored_endpoints", "max_redirects", "INTEGER DEFAULT 0"},
+		column{"monitored_endpoints", "no_redirects", "INTEGER DEFAULT 0"},
+		column{"monitored_endpoints", "proxy_url", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "tls_skip_verify", "INTEGER DEFAULT 0"},
+		column{"monitored_endpoints", "ca_bundle", "TEXT DEFAULT ''"},
+		column{"api_metrics", "redirect_chain", "TEXT DEFAULT ''"},
+	)},
+	{10, "create auth profiles table", combine(exec(`
+	CREATE TABLE IF NOT EXISTS auth_profiles (
+		id TEXT PRIMARY KEY,
+		name TEXT,
+		type TEXT,
+		username TEXT DEFAULT '',
+		password TEXT DEFAULT '',
+		token TEXT DEFAULT '',
+		token_url TEXT DEFAULT '',
+		client_id TEXT DEFAULT '',
+		client_secret TEXT DEFAULT '',
+		scopes TEXT DEFAULT '',
+		client_cert TEXT DEFAULT '',
+		client_key TEXT DEFAULT ''
+	);`), addColumns(
+		column{"monitored_endpoints", "auth_profile_id", "TEXT DEFAULT ''"},
+	))},
+	{11, "add check types and transactions", addColumns(
+		column{"monitored_endpoints", "type", "TEXT DEFAULT 'http'"},
+		column{"monitored_endpoints", "steps", "TEXT DEFAULT ''"},
+		column{"api_metrics", "step_results", "TEXT DEFAULT ''"},
+	)},
+	{12, "add TCP, DNS and TLS check settings", addColumns(
+		column{"monitored_endpoints", "banner_match", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "dns_record_type", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "dns_expected", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "dns_resolver", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "min_tls_version", "TEXT DEFAULT ''"},
+		column{"api_metrics", "tls_version", "TEXT DEFAULT ''"},
+	)},
+	{13, "add gRPC health checks", addColumns(
+		column{"monitored_endpoints", "grpc_service", "TEXT DEFAULT ''"},
+		column{"api_metrics", "grpc_status", "TEXT DEFAULT ''"},
+	)},
+	{14, "add WebSocket checks", addColumns(
+		column{"monitored_endpoints", "ws_message", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "ws_expect", "TEXT DEFAULT ''"},
+		column{"api_metrics", "handshake_ms", "INTEGER DEFAULT 0"},
+		column{"api_metrics", "first_message_ms", "INTEGER DEFAULT 0"},
+		column{"api_metrics", "close_code", "INTEGER DEFAULT 0"},
+	)},
+	{15, "add heartbeat monitors", addColumns(
+		column{"monitored_endpoints", "ping_token", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "grace_seconds", "INTEGER DEFAULT 0"},
+		column{"monitored_endpoints", "last_ping_at", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "running_since", "TEXT DEFAULT ''"},
+		column{"monitored_endpoints", "ping_start_log", "TEXT DEFAULT ''"},
+		column{"api_metrics", "ping", "TEXT DEFAULT ''"},
+		column{"api_metrics", "ping_log", "TEXT DEFAULT ''"},
+	)},
+	{16, "create metric rollups", exec(`
+	CREATE TABLE IF NOT EXISTS metric_rollups (
+		endpoint_id TEXT,
+		resolution TEXT,
+		bucket_start DATETIME,
+		count INTEGER,
+		success_count INTEGER,
+		min_latency_ms INTEGER,
+		max_latency_ms INTEGER,
+		sum_latency_ms INTEGER,
+		sketch TEXT,
+		PRIMARY KEY(endpoint_id, resolution, bucket_start),
+		FOREIGN KEY(endpoint_id) REFERENCES monitored_endpoints(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS rollup_progress (
+		resolution TEXT PRIMARY KEY,
+		rolled_until DATETIME
+	);
+
+	CREATE INDEX IF NOT EXISTS api_metrics_timestamp ON api_metrics(timestamp);`)},
+	{17, "add retention overrides", combine(addColumns(
+		column{"monitored_endpoints", "retain_raw_days", "INTEGER DEFAULT 0"},
+		column{"monitored_endpoints", "retain_minute_days", "INTEGER DEFAULT 0"},
+		column{"monitored_endpoints", "retain_hour_days", "INTEGER DEFAULT 0"},
+	), exec(`
+	CREATE INDEX IF NOT EXISTS api_metrics_endpoint_timestamp ON api_metrics(endpoint_id, timestamp);`))},
+	// The first release stored metric times to the second in local time.
+	// Timestamps are compared as text, so rewrite them in the UTC,
+	// millisecond layout used since for them to sort in time order.
+	{18, "normalise legacy metric timestamps", exec(`
+	UPDATE api_metrics SET timestamp = strftime('%Y-%m-%dT%H:%M:%fZ', timestamp)
+	WHERE timestamp NOT LIKE '____-__-__T__:__:__.___Z' AND strftime('%Y-%m-%dT%H:%M:%fZ', timestamp) IS NOT NULL;`)},
+	{19, "add outcomes and phase timings to rollups", addColumns(
+		column{"metric_rollups", "outcomes", "TEXT DEFAULT ''"},
+		column{"metric_rollups", "phases", "TEXT DEFAULT ''"},
+	)},
+	{20, "encrypt sensitive headers stored in plain text", sealPlaintextHeaders},
+	// Failures stored before failure reasons were recorded would otherwise
+	// be counted as successes in the distributions, which only have the
+	// reason to go on. Give them the reason the poller gave such failures.
+	{21, "classify failures stored without a reason", exec(`
+	UPDATE api_metrics SET failure_reason = CASE WHEN status_code > 0 THEN 'unexpected_status' ELSE 'network_error' END
+	WHERE COALESCE(success, 0) = 0 AND COALESCE(failure_reason, '') = '';`)},
+	{22, "encrypt proxy urls with passwords stored in plain text", sealPlaintextProxyURLs},
+}
+
+const schemaVersionTable = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT,
+		applied_at DATETIME
+	);`
+
+// Bring the database up to the latest schema, returning the migrations that
+// were applied. Each migration runs in its own transaction so a failure
+// leaves the database at the last version that succeeded.
+//
+// With dryRun set every pending migration is run in a single transaction
+// that is rolled back, so they are checked against the real database without
+// changing it.
+func Migrate(db *sql.DB, box *secrets.Box, dryRun bool) ([]Migration, error) {
+	if dryRun {
+		return dryRunMigrations(db, box)
+	}
+
+	if _, err := db.Exec(schemaVersionTable); err != nil {
+		return nil, err
+	}
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range pending {
+		tx, err := db.Begin()
+		if err != nil {
+			return applied, err
+		}
+		if err := applyMigration(tx, box, m); err != nil {
+			tx.Rollback()
+			return applied, err
+		}
+		if err := tx.Commit(); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func dryRunMigrations(db *sql.DB, box *secrets.Box) ([]Migration, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(schemaVersionTable); err != nil {
+		return nil, err
+	}
+	pending, err := pendingMigrations(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range pending {
+		if err := applyMigration(tx, box, m); err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+// Anything queries can be run on, so a dry run can read inside its transaction
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Migrations newer than the database's schema version
+func pendingMigrations(q querier) ([]Migration, error) {
+	var current int
+	if err := q.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func applyMigration(tx *sql.Tx, box *secrets.Box, m Migration) error {
+	if err := m.up(tx, box); err != nil {
+		return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+	}
+	_, err := tx.Exec("INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Description, formatTimestamp(time.Now()))
+	return err
+}
+
+// Latest version the schema can be migrated to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func exec(statements string) migrationStep {
+	return func(tx *sql.Tx, _ *secrets.Box) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+type column struct {
+	table, name, definition string
+}
+
+// Add columns to existing tables, skipping any already there
+func addColumns(columns ...column) migrationStep {
+	return func(tx *sql.Tx, _ *secrets.Box) error {
+		for _, col := range columns {
+			exists, err := columnExists(tx, col.table, col.name)
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+			if _, err := tx.Exec("ALTER TABLE " + col.table + " ADD COLUMN " + col.name + " " + col.definition); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Add a column like addColumns, then fill it in for the rows already there.
+// If the column existed those rows already have values, so they are left alone.
+func backfillColumn(col column, backfill string) migrationStep {
+	return func(tx *sql.Tx, box *secrets.Box) error {
+		exists, err := columnExists(tx, col.table, col.name)
+		if err != nil || exists {
+			return err
+		}
+		if err := addColumns(col)(tx, box); err != nil {
+			return err
+		}
+		_, err = tx.Exec(backfill)
+		return err
+	}
+}
+
+// Encrypt sensitive endpoint headers saved before headers were encrypted
+func sealPlaintextHeaders(tx *sql.Tx, box *secrets.Box) error {
+	stored, err := endpointHeaders(tx)
+	if err != nil {
+		return err
+	}
+
+	for id, data := range stored {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(data), &headers); err != nil {
+			return fmt.Errorf("endpoint %s: %w", id, err)
+		}
+		changed := false
+		for k, v := range headers {
+			if !models.IsSensitiveHeader(k) || secrets.IsSealed(v) {
+				continue
+			}
+			if box == nil {
+				return fmt.Errorf("endpoint %s has header %s in plain text, which can't be encrypted without a secret key", id, k)
+			}
+			if headers[k], err = box.Seal(v); err != nil {
+				return err
+			}
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		sealed, err := json.Marshal(headers)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE monitored_endpoints SET headers = ? WHERE id = ?", string(sealed), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encrypt proxy URLs with a password saved before they were encrypted
+func sealPlaintextProxyURLs(tx *sql.Tx, box *secrets.Box) error {
+	rows, err := tx.Query("SELECT id, proxy_url FROM monitored_endpoints WHERE COALESCE(proxy_url, '') != ''")
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]string)
+	for rows.Next() {
+		var id, proxyURL string
+		if err := rows.Scan(&id, &proxyURL); err != nil {
+			rows.Close()
+			return err
+		}
+		stored[id] = proxyURL
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, proxyURL := range stored {
+		if secrets.IsSealed(proxyURL) || !models.ProxyHasPassword(proxyURL) {
+			continue
+		}
+		if box == nil {
+			return fmt.Errorf("endpoint %s has a proxy password in plain text, which can't be encrypted without a secret key", id)
+		}
+		sealed, err := box.Seal(proxyURL)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE monitored_endpoints SET proxy_url = ? WHERE id = ?", sealed, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Every endpoint's stored headers, keyed by endpoint ID
+func endpointHeaders(tx *sql.Tx) (map[string]string, error) {
+	rows, err := tx.Query("SELECT id, headers FROM monitored_endpoints WHERE COALESCE(headers, '') != ''")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stored := make(map[string]string)
+	for rows.Next() {
+		var id, headers string
+		if err := rows.Scan(&id, &headers); err != nil {
+			return nil, err
+		}
+		stored[id] = headers
+	}
+	return stored, rows.Err()
+}
+
+func combine(steps ...migrationStep) migrationStep {
+	return func(tx *sql.Tx, box *secrets.Box) error {
+		for _, step := range steps {
+			if err := step(tx, box); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func columnExists(q querier, table, column string) (bool, error) {
+	rows, err := q.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Fetch latency percentiles, min, max, mean and sample count per endpoint in
+// buckets of the given interval covering a date range, ordered by URL.
+// Buckets with no samples are left out.
+//
+// Each bucket is built from the coarsest rollups that fit into it. Time past
+// what those have been rolled up to is filled in from finer rollups and then
+// raw metrics, so the latest buckets are complete too.
+func (c *SQLiteClient) GetLatencyPercentiles(interval time.Duration, start, end time.Time) ([]models.EndpointLatency, error) {
+	b := newRollupBuilder(interval)
+	from := start.UTC().Truncate(interval)
+	to := end.UTC().Truncate(interval).Add(interval) // Whole buckets, so the last one isn't cut short
+	if err := c.collectRange(b, models.SourceResolution(interval), from, to); err != nil {
+		return nil, err
+	}
+
+	byEndpoint := make(map[uuid.UUID]*models.EndpointLatency)
+	for _, rollup := range b.rollups {
+		endpoint, ok := byEndpoint[rollup.EndpointID]
+		if !ok {
+			endpoint = &models.EndpointLatency{EndpointID: rollup.EndpointID, URL: rollup.URL}
+			byEndpoint[rollup.EndpointID] = endpoint
+		}
+		endpoint.Buckets = append(endpoint.Buckets, rollup.Summary())
+	}
+
+	result := make([]models.EndpointLatency, 0, len(byEndpoint))
+	for _, endpoint := range byEndpoint {
+		slices.SortFunc(endpoint.Buckets, func(a, b models.LatencyBucket) int {
+			return a.BucketStart.Compare(b.BucketStart)
+		})
+		result = append(result, *endpoint)
+	}
+	slices.SortFunc(result, func(a, b models.EndpointLatency) int {
+		if a.URL != b.URL {
+			return cmp.Compare(a.URL, b.URL)
+		}
+		return cmp.Compare(a.EndpointID.String(), b.EndpointID.String())
+	})
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/AdamGriffiths31/pulseboard/internal/sketch"
+	"github.com/google/uuid"
+)
+
+func TestGetLatencyPercentiles(t *testing.T) {
+	client := newTestClient(t)
+
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: "https://api.example.com", Frequency: time.Minute}
+	if err := client.StoreEndpoint(ep); err != nil {
+		t.Fatal(err)
+	}
+
+	// A sample every 10 seconds for two hours, with a spike in the first
+	// five minutes of the second hour
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	rng := rand.New(rand.NewPCG(1, 2))
+	var firstHour, spike []float64
+	for at := start; at.Before(start.Add(2 * time.Hour)); at = at.Add(10 * time.Second) {
+		latency := 50 + rng.IntN(100)
+		if at.Sub(start) >= time.Hour && at.Sub(start) < time.Hour+5*time.Minute {
+			latency += 2000
+			spike = append(spike, float64(latency))
+		}
+		if at.Sub(start) < time.Hour {
+			firstHour = append(firstHour, float64(latency))
+		}
+		storeTestMetric(t, client, ep.ID, at, latency, true)
+	}
+
+	// Only the first 90 minutes have been rolled up, and only the first hour
+	// into an hour rollup, so later buckets come from minutes and raw metrics
+	if err := client.RollUpMetrics(start.Add(90*time.Minute), 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if until, err := client.RolledUntil(models.ResolutionHour); err != nil || !until.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected hours to be rolled up to the first hour, got %v (%v)", until, err)
+	}
+
+	hours, err := client.GetLatencyPercentiles(time.Hour, start, start.Add(119*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hours) != 1 || hours[0].EndpointID != ep.ID || hours[0].URL != ep.URL {
+		t.Fatalf("expected one endpoint, got %+v", hours)
+	}
+	buckets := hours[0].Buckets
+	if len(buckets) != 2 || buckets[0].Count != 360 || buckets[1].Count != 360 {
+		t.Fatalf("expected two complete hour buckets, got %+v", buckets)
+	}
+	slices.Sort(firstHour)
+	for q, got := range map[float64]float64{0.5: buckets[0].P50MS, 0.99: buckets[0].P99MS} {
+		want := firstHour[int(math.Ceil(q*float64(len(firstHour))))-1]
+		if math.Abs(got-want) > want*sketch.RelativeAccuracy {
+			t.Errorf("p%v: expected %v within %v%%, got %v", q*100, want, sketch.RelativeAccuracy*100, got)
+		}
+	}
+
+	// The spike stands out in its five minute bucket
+	fives, err := client.GetLatencyPercentiles(5*time.Minute, start.Add(time.Hour), start.Add(time.Hour+10*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fives) != 1 {
+		t.Fatalf("expected one endpoint, got %+v", fives)
+	}
+	buckets = fives[0].Buckets
+	if len(buckets) != 3 || !buckets[0].BucketStart.Equal(start.Add(time.Hour)) {
+		t.Fatalf("expected three five minute buckets, got %+v", buckets)
+	}
+	if buckets[0].Count != len(spike) || buckets[0].MinLatencyMS < 2000 || buckets[1].P99MS > 200 {
+		t.Errorf("expected the spike in the first bucket only, got %+v", buckets)
+	}
+
+	// Buckets with no samples are left out
+	empty, err := client.GetLatencyPercentiles(time.Minute, start.Add(-time.Hour), start.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(empty) != 0 {
+		t.Errorf("expected no buckets before the first sample, got %+v", empty)
+	}
+}
+
+func TestGetLatencyPercentilesKeepsEndpointsSharingAURLApart(t *testing.T) {
+	client := newTestClient(t)
+
+	// The same URL checked from two endpoints, such as with different headers
+	fast := models.MonitoredEndpoint{ID: uuid.New(), URL: "https://api.example.com", Frequency: time.Minute}
+	slow := models.MonitoredEndpoint{ID: uuid.New(), URL: fast.URL, Frequency: time.Minute}
+	for _, ep := range []models.MonitoredEndpoint{fast, slow} {
+		if err := client.StoreEndpoint(ep); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	for at := start; at.Before(start.Add(2 * time.Hour)); at = at.Add(time.Minute) {
+		storeTestMetric(t, client, fast.ID, at, 50, true)
+		storeTestMetric(t, client, slow.ID, at, 500, true)
+	}
+	// Half from rollups and half from raw metrics
+	if err := client.RollUpMetrics(start.Add(time.Hour), 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, err := client.GetLatencyPercentiles(time.Hour, start, start.Add(119*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 2 {
+		t.Fatalf("expected both endpoints, got %+v", endpoints)
+	}
+	for _, endpoint := range endpoints {
+		want := 50
+		if endpoint.EndpointID == slow.ID {
+			want = 500
+		}
+		if endpoint.URL != fast.URL || len(endpoint.Buckets) != 2 {
+			t.Fatalf("expected two hour buckets for %s, got %+v", endpoint.EndpointID, endpoint)
+		}
+		for _, bucket := range endpoint.Buckets {
+			if bucket.Count != 60 || bucket.MinLatencyMS != want || bucket.MaxLatencyMS != want {
+				t.Errorf("expected %s to only hold its own samples, got %+v", endpoint.EndpointID, bucket)
+			}
+		}
+	}
+}
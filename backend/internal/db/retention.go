@@ -0,0 +1,66 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Delete up to limit of an endpoint's metrics, or its rollups at a
+// resolution, from before the given time. Returns how many were deleted, so
+// callers can delete in small batches until fewer than limit come back.
+func (c *SQLiteClient) DeleteExpired(resolution models.Resolution, endpointID uuid.UUID, before time.Time, limit int) (int64, error) {
+	var res sql.Result
+	var err error
+	switch {
+	case resolution == models.ResolutionRaw:
+		res, err = c.DB.Exec(`
+		DELETE FROM api_metrics WHERE rowid IN (
+			SELECT rowid FROM api_metrics WHERE endpoint_id = ? AND timestamp < ? LIMIT ?)`,
+			endpointID.String(), formatTimestamp(before), limit)
+	case slices.Contains(models.Resolutions, resolution):
+		res, err = c.DB.Exec(`
+		DELETE FROM metric_rollups WHERE rowid IN (
+			SELECT rowid FROM metric_rollups WHERE endpoint_id = ? AND resolution = ? AND bucket_start < ? LIMIT ?)`,
+			endpointID.String(), string(resolution), formatTimestamp(before), limit)
+	default:
+		return 0, fmt.Errorf("unknown resolution %q", resolution)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Hand space freed by deleting rows back to the filesystem. In WAL mode the
+// log is checkpointed and truncated. The database itself is only vacuumed
+// once at least a quarter of it is free, since vacuuming rewrites the whole
+// file and blocks writes while it does.
+func (c *SQLiteClient) Compact() error {
+	var mode string
+	if err := c.DB.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		return err
+	}
+	if mode == "wal" {
+		if _, err := c.DB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return err
+		}
+	}
+
+	var free, total int64
+	if err := c.DB.QueryRow("PRAGMA freelist_count").Scan(&free); err != nil {
+		return err
+	}
+	if err := c.DB.QueryRow("PRAGMA page_count").Scan(&total); err != nil {
+		return err
+	}
+	if total == 0 || free*4 < total {
+		return nil
+	}
+	_, err := c.DB.Exec("VACUUM")
+	return err
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestRetentionOverrideRoundTrip(t *testing.T) {
+	client := newTestClient(t)
+
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: "https://api.example.com", Frequency: time.Minute,
+		Retention: &models.RetentionPolicy{RawDays: 30}}
+	other := models.MonitoredEndpoint{ID: uuid.New(), URL: "https://other.example.com", Frequency: time.Minute}
+	for _, e := range []models.MonitoredEndpoint{ep, other} {
+		if err := client.StoreEndpoint(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := client.GetEndpoint(ep.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Retention == nil || *got.Retention != *ep.Retention {
+		t.Errorf("expected retention %+v, got %+v", ep.Retention, got.Retention)
+	}
+	if got, err := client.GetEndpoint(other.ID); err != nil || got.Retention != nil {
+		t.Errorf("expected no retention override, got %+v (%v)", got.Retention, err)
+	}
+}
+
+func TestDeleteExpired(t *testing.T) {
+	client := newTestClient(t)
+
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: "https://api.example.com", Frequency: time.Minute}
+	other := models.MonitoredEndpoint{ID: uuid.New(), URL: "https://other.example.com", Frequency: time.Minute}
+	for _, e := range []models.MonitoredEndpoint{ep, other} {
+		if err := client.StoreEndpoint(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		storeTestMetric(t, client, ep.ID, start.Add(time.Duration(i)*time.Minute), 100, true)
+		storeTestMetric(t, client, other.ID, start.Add(time.Duration(i)*time.Minute), 100, true)
+	}
+	if err := client.RollUpMetrics(start.Add(2*time.Hour), 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// Batches stop at the limit and only touch the endpoint and data asked for
+	cutoff := start.Add(4 * time.Minute)
+	for _, want := range []int64{3, 1, 0} {
+		n, err := client.DeleteExpired(models.ResolutionRaw, ep.ID, cutoff, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != want {
+			t.Fatalf("expected %d deleted, got %d", want, n)
+		}
+	}
+	n, err := client.DeleteExpired(models.ResolutionMinute, ep.ID, cutoff, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("expected 4 minute rollups deleted, got %d", n)
+	}
+
+	if n := countRows(t, client, "SELECT COUNT(*) FROM api_metrics WHERE endpoint_id = ?", ep.ID.String()); n != 1 {
+		t.Errorf("expected 1 metric left, got %d", n)
+	}
+	if n := countRows(t, client, "SELECT COUNT(*) FROM api_metrics WHERE endpoint_id = ?", other.ID.String()); n != 5 {
+		t.Errorf("expected the other endpoint's metrics to be kept, got %d", n)
+	}
+	if n := countRows(t, client, "SELECT COUNT(*) FROM metric_rollups WHERE endpoint_id = ? AND resolution = '1h'", ep.ID.String()); n != 1 {
+		t.Errorf("expected the hour rollup to be kept, got %d", n)
+	}
+
+	if _, err := client.DeleteExpired(models.Resolution("5m"), ep.ID, cutoff, 100); err == nil {
+		t.Error("expected an unknown resolution to be rejected")
+	}
+	if err := client.Compact(); err != nil {
+		t.Errorf("unexpected error compacting: %v", err)
+	}
+}
+
+func countRows(t *testing.T, client *SQLiteClient, query string, args ...any) int {
+	t.Helper()
+	var count int
+	if err := client.DB.QueryRow(query, args...).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
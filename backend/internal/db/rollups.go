@@ -0,0 +1,347 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Buckets rolled up per transaction, so a large backlog doesn't hold the
+// database for long
+const rollupChunkBuckets = 60
+
+// Aggregate metrics into rollups at every resolution, picking up where the
+// last run stopped. Minutes are rolled up from raw metrics up to now, and
+// the most recent ones are rolled up again until they are older than settle,
+// since a metric can be written a little after its timestamp. Hours are rolled
+// up from settled minutes and days from hours.
+func (c *SQLiteClient) RollUpMetrics(now time.Time, settle time.Duration) error {
+	var sourceUntil time.Time
+	for i, r := range models.Resolutions {
+		from, err := c.RolledUntil(r)
+		if err != nil {
+			return err
+		}
+
+		var to time.Time
+		if i == 0 {
+			to = r.Truncate(now)
+			if redo := r.Truncate(now.Add(-settle)); !from.IsZero() && redo.Before(from) {
+				from = redo
+			}
+		} else {
+			to = r.Truncate(sourceUntil)
+		}
+
+		if err := c.rollUpRange(r, from, to); err != nil {
+			return err
+		}
+
+		if sourceUntil, err = c.RolledUntil(r); err != nil {
+			return err
+		}
+		if i == 0 {
+			sourceUntil = sourceUntil.Add(-settle)
+		}
+	}
+	return nil
+}
+
+// Roll up the buckets from one time up to another at a resolution, a chunk
+// at a time, recording progress after each. Stretches with nothing to roll
+// up are skipped.
+func (c *SQLiteClient) rollUpRange(r models.Resolution, from, to time.Time) error {
+	for from.Before(to) {
+		next, ok, err := c.nextSourceTime(r, from)
+		if err != nil {
+			return err
+		}
+		if !ok || !next.Before(to) {
+			return setRolledUntil(c.DB, r, to)
+		}
+		if start := r.Truncate(next); start.After(from) {
+			from = start
+		}
+
+		end := from.Add(rollupChunkBuckets * r.Duration())
+		if end.After(to) {
+			end = to
+		}
+		if err := c.rollUpChunk(r, from, end); err != nil {
+			return err
+		}
+		from = end
+	}
+	return nil
+}
+
+func (c *SQLiteClient) rollUpChunk(r models.Resolution, from, to time.Time) error {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var rollups []*models.Rollup
+	if r == models.Resolutions[0] {
+		rollups, err = rollUpMetrics(tx, r, from, to)
+	} else {
+		rollups, err = rollUpRollups(tx, r, from, to)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, rollup := range rollups {
+		if err := storeRollup(tx, r, rollup); err != nil {
+			return err
+		}
+	}
+	if err := setRolledUntil(tx, r, to); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Rollups of the raw metrics in a time range
+func rollUpMetrics(tx *sql.Tx, r models.Resolution, from, to time.Time) ([]*models.Rollup, error) {
+	rows, err := tx.Query(`
+		SELECT `+rollupMetricColumns+`, ''
+		FROM api_metrics m
+		WHERE m.timestamp >= ? AND m.timestamp < ?
+		ORDER BY m.timestamp ASC`, formatTimestamp(from), formatTimestamp(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	b := newRollupBuilder(r.Duration())
+	for rows.Next() {
+		m, err := scanRollupMetric(rows)
+		if err != nil {
+			return nil, err
+		}
+		b.bucket(m.EndpointID, "", m.Timestamp).Add(m)
+	}
+	return b.rollups, rows.Err()
+}
+
+// Columns of a metric that rollups are built from
+const rollupMetricColumns = `m.endpoint_id, m.timestamp, m.latency_ms, COALESCE(m.success, 0), m.status_code,
+	COALESCE(m.failure_reason, ''), COALESCE(m.unconfirmed, 0), COALESCE(m.attempts, 1), COALESCE(m.dns_ms, 0),
+	COALESCE(m.connect_ms, 0), COALESCE(m.tls_ms, 0), COALESCE(m.ttfb_ms, 0), COALESCE(m.transfer_ms, 0)`
+
+// Scan rollupMetricColumns followed by the endpoint URL
+func scanRollupMetric(row scanner) (models.Metric, error) {
+	var m models.Metric
+	var timestamp string
+	err := row.Scan(&m.EndpointID, &timestamp, &m.LatencyMS, &m.Success, &m.StatusCode, &m.FailureReason,
+		&m.Unconfirmed, &m.Attempts, &m.DNSMS, &m.ConnectMS, &m.TLSMS, &m.TTFBMS, &m.TransferMS, &m.URL)
+	if err != nil {
+		return m, err
+	}
+	m.Timestamp, err = time.Parse(time.RFC3339, timestamp)
+	return m, err
+}
+
+// Rollups at a resolution of the finer rollups in a time range
+func rollUpRollups(tx *sql.Tx, r models.Resolution, from, to time.Time) ([]*models.Rollup, error) {
+	rows, err := tx.Query(`
+		SELECT `+rollupColumns+`, ''
+		FROM metric_rollups r
+		WHERE r.resolution = ? AND r.bucket_start >= ? AND r.bucket_start < ?
+		ORDER BY r.bucket_start ASC`, string(finerResolution(r)), formatTimestamp(from), formatTimestamp(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	b := newRollupBuilder(r.Duration())
+	for rows.Next() {
+		finer, err := scanRollup(rows)
+		if err != nil {
+			return nil, err
+		}
+		b.bucket(finer.EndpointID, "", finer.BucketStart).Merge(finer)
+	}
+	return b.rollups, rows.Err()
+}
+
+// Collects rollups per endpoint, or per URL, and bucket as rows are read
+type rollupBuilder struct {
+	width   time.Duration
+	byURL   bool // Merge endpoints that share a URL
+	index   map[rollupKey]*models.Rollup
+	rollups []*models.Rollup
+}
+
+type rollupKey struct {
+	endpointID  uuid.UUID
+	url         string
+	bucketStart time.Time
+}
+
+// Builder for buckets of the given width, aligned to UTC
+func newRollupBuilder(width time.Duration) *rollupBuilder {
+	return &rollupBuilder{width: width, index: make(map[rollupKey]*models.Rollup)}
+}
+
+// Rollup for the bucket a metric at a time falls in. Metrics are grouped by
+// endpoint ID and URL, so leaving either empty groups by the other, as does a
+// builder that merges by URL. A builder with a width of zero puts every time
+// in one bucket.
+func (b *rollupBuilder) bucket(endpointID uuid.UUID, url string, t time.Time) *models.Rollup {
+	if b.byURL {
+		endpointID = uuid.Nil
+	}
+	key := rollupKey{endpointID: endpointID, url: url}
+	if b.width > 0 {
+		key.bucketStart = t.UTC().Truncate(b.width)
+	}
+	rollup, ok := b.index[key]
+	if !ok {
+		rollup = &models.Rollup{EndpointID: endpointID, URL: url, BucketStart: key.bucketStart}
+		b.index[key] = rollup
+		b.rollups = append(b.rollups, rollup)
+	}
+	return rollup
+}
+
+func storeRollup(tx *sql.Tx, r models.Resolution, rollup *models.Rollup) error {
+	sketch, err := json.Marshal(&rollup.Latency)
+	if err != nil {
+		return err
+	}
+	outcomes, err := json.Marshal(rollup.Outcomes)
+	if err != nil {
+		return err
+	}
+	phases, err := json.Marshal(rollup.Phases)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO metric_rollups (endpoint_id, resolution, bucket_start, count, success_count,
+			min_latency_ms, max_latency_ms, sum_latency_ms, sketch, outcomes, phases)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rollup.EndpointID.String(), string(r), formatTimestamp(rollup.BucketStart), rollup.Count, rollup.SuccessCount,
+		rollup.MinLatencyMS, rollup.MaxLatencyMS, rollup.SumLatencyMS, string(sketch), string(outcomes), string(phases),
+	)
+	return err
+}
+
+// Earliest time at or after from that there is something to roll up at a
+// resolution, and whether there is one
+func (c *SQLiteClient) nextSourceTime(r models.Resolution, from time.Time) (time.Time, bool, error) {
+	var next sql.NullString
+	var err error
+	if r == models.Resolutions[0] {
+		err = c.DB.QueryRow("SELECT MIN(timestamp) FROM api_metrics WHERE timestamp >= ?",
+			formatTimestamp(from)).Scan(&next)
+	} else {
+		err = c.DB.QueryRow("SELECT MIN(bucket_start) FROM metric_rollups WHERE resolution = ? AND bucket_start >= ?",
+			string(finerResolution(r)), formatTimestamp(from)).Scan(&next)
+	}
+	if err != nil || !next.Valid {
+		return time.Time{}, false, err
+	}
+	t, err := time.Parse(time.RFC3339, next.String)
+	return t, err == nil, err
+}
+
+// Resolution the given one is rolled up from
+func finerResolution(r models.Resolution) models.Resolution {
+	for i := 1; i < len(models.Resolutions); i++ {
+		if models.Resolutions[i] == r {
+			return models.Resolutions[i-1]
+		}
+	}
+	return r
+}
+
+// Time a resolution has been rolled up to, zero if it hasn't been yet
+func (c *SQLiteClient) RolledUntil(r models.Resolution) (time.Time, error) {
+	var until string
+	err := c.DB.QueryRow("SELECT rolled_until FROM rollup_progress WHERE resolution = ?", string(r)).Scan(&until)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, until)
+}
+
+func setRolledUntil(e execer, r models.Resolution, until time.Time) error {
+	_, err := e.Exec(`
+		INSERT INTO rollup_progress (resolution, rolled_until) VALUES (?, ?)
+		ON CONFLICT(resolution) DO UPDATE SET rolled_until = MAX(rolled_until, excluded.rolled_until)`,
+		string(r), formatTimestamp(until))
+	return err
+}
+
+// Anything statements can be run on, so progress is recorded in or outside
+// a transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+const rollupColumns = `r.endpoint_id, r.bucket_start, r.count, r.success_count, r.min_latency_ms, r.max_latency_ms,
+	r.sum_latency_ms, r.sketch, COALESCE(r.outcomes, ''), COALESCE(r.phases, '')`
+
+// Fetch every endpoint's rollups at a resolution whose buckets overlap a
+// date range, ordered by URL and then time
+func (c *SQLiteClient) GetRollups(resolution models.Resolution, start, end time.Time) ([]models.Rollup, error) {
+	rows, err := c.DB.Query(`
+		SELECT `+rollupColumns+`, e.url
+		FROM metric_rollups r
+		JOIN monitored_endpoints e ON r.endpoint_id = e.id
+		WHERE r.resolution = ? AND r.bucket_start >= ? AND r.bucket_start <= ?
+		ORDER BY e.url, r.bucket_start ASC`,
+		string(resolution), formatTimestamp(resolution.Truncate(start)), formatTimestamp(end))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rollups []models.Rollup
+	for rows.Next() {
+		rollup, err := scanRollup(rows)
+		if err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, rollup)
+	}
+	return rollups, rows.Err()
+}
+
+// Scan rollupColumns followed by the endpoint URL
+func scanRollup(row scanner) (models.Rollup, error) {
+	var rollup models.Rollup
+	var bucketStart, sketch, outcomes, phases string
+	err := row.Scan(&rollup.EndpointID, &bucketStart, &rollup.Count, &rollup.SuccessCount, &rollup.MinLatencyMS,
+		&rollup.MaxLatencyMS, &rollup.SumLatencyMS, &sketch, &outcomes, &phases, &rollup.URL)
+	if err != nil {
+		return rollup, err
+	}
+	if rollup.BucketStart, err = time.Parse(time.RFC3339, bucketStart); err != nil {
+		return rollup, err
+	}
+	if err := json.Unmarshal([]byte(sketch), &rollup.Latency); err != nil {
+		return rollup, err
+	}
+	// Rollups stored before outcomes and phases were added have neither
+	if outcomes != "" {
+		if err := json.Unmarshal([]byte(outcomes), &rollup.Outcomes); err != nil {
+			return rollup, err
+		}
+	}
+	if phases != "" {
+		err = json.Unmarshal([]byte(phases), &rollup.Phases)
+	}
+	return rollup, err
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func storeTestMetric(t *testing.T, client *SQLiteClient, endpointID uuid.UUID, at time.Time, latency int, success bool) {
+	t.Helper()
+	err := client.StoreMetric(models.Metric{ID: uuid.New(), EndpointID: endpointID, Timestamp: at, LatencyMS: latency, Success: success})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollUpMetrics(t *testing.T) {
+	client := newTestClient(t)
+
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: "https://api.example.com", Frequency: time.Minute}
+	if err := client.StoreEndpoint(ep); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two metrics in one minute, one the next minute and one the next day
+	day := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	storeTestMetric(t, client, ep.ID, day.Add(10*time.Second), 100, true)
+	storeTestMetric(t, client, ep.ID, day.Add(50*time.Second), 300, false)
+	storeTestMetric(t, client, ep.ID, day.Add(90*time.Second), 200, true)
+	storeTestMetric(t, client, ep.ID, day.Add(25*time.Hour), 400, true)
+
+	now := day.Add(3 * 24 * time.Hour)
+	if err := client.RollUpMetrics(now, 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		resolution models.Resolution
+		counts     []int
+	}{
+		{models.ResolutionMinute, []int{2, 1, 1}},
+		{models.ResolutionHour, []int{3, 1}},
+		{models.ResolutionDay, []int{3, 1}},
+	}
+	for _, tt := range tests {
+		rollups, err := client.GetRollups(tt.resolution, day, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rollups) != len(tt.counts) {
+			t.Fatalf("%s: expected %d rollups, got %+v", tt.resolution, len(tt.counts), rollups)
+		}
+		for i, rollup := range rollups {
+			if rollup.Count != tt.counts[i] || rollup.URL != ep.URL || !rollup.BucketStart.Equal(tt.resolution.Truncate(rollup.BucketStart)) {
+				t.Errorf("%s: unexpected rollup %+v", tt.resolution, rollup)
+			}
+		}
+
+		first := rollups[0].Summary()
+		if first.MinLatencyMS != 100 || first.MaxLatencyMS != 300 || first.SuccessCount != first.Count-1 {
+			t.Errorf("%s: unexpected first bucket %+v", tt.resolution, first)
+		}
+		if tt.resolution != models.ResolutionMinute && first.P99MS < 250 {
+			t.Errorf("%s: expected p99 from the merged sketch, got %+v", tt.resolution, first)
+		}
+	}
+}
+
+func TestRollUpMetricsIsIncremental(t *testing.T) {
+	client := newTestClient(t)
+
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: "https://api.example.com", Frequency: time.Minute}
+	if err := client.StoreEndpoint(ep); err != nil {
+		t.Fatal(err)
+	}
+
+	hour := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	storeTestMetric(t, client, ep.ID, hour.Add(time.Minute), 100, true)
+	if err := client.RollUpMetrics(hour.Add(10*time.Minute), 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// A metric stored late for a minute still settling is rolled up again
+	storeTestMetric(t, client, ep.ID, hour.Add(time.Minute+time.Second), 500, true)
+	if err := client.RollUpMetrics(hour.Add(12*time.Minute), 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	rollups, err := client.GetRollups(models.ResolutionMinute, hour, hour.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rollups) != 1 || rollups[0].Count != 2 || rollups[0].MaxLatencyMS != 500 {
+		t.Fatalf("expected the late metric to be rolled up, got %+v", rollups)
+	}
+
+	// Hours aren't rolled up until their minutes have settled
+	rollups, err = client.GetRollups(models.ResolutionHour, hour, hour.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rollups) != 0 {
+		t.Fatalf("expected no hour rollups yet, got %+v", rollups)
+	}
+	if err := client.RollUpMetrics(hour.Add(2*time.Hour), 15*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	rollups, err = client.GetRollups(models.ResolutionHour, hour, hour.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rollups) != 1 || rollups[0].Count != 2 {
+		t.Fatalf("expected one hour rollup of both metrics, got %+v", rollups)
+	}
+
+	// Deleting the endpoint deletes its rollups
+	if err := client.DeleteEndpoint(ep.ID); err != nil {
+		t.Fatal(err)
+	}
+	var remaining int
+	if err := client.DB.QueryRow("SELECT COUNT(*) FROM metric_rollups").Scan(&remaining); err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 0 {
+		t.Errorf("expected rollups to be deleted with the endpoint, %d remain", remaining)
+	}
+}
@@ -3,89 +3,240 @@ package db
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
 	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/AdamGriffiths31/pulseboard/internal/secrets"
+	"github.com/google/uuid"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Timestamps are stored in UTC with a fixed millisecond precision so that
+// string comparisons in SQL order them correctly
+const timestampLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// Returned when a lookup by ID matches nothing
+var ErrNotFound = errors.New("not found")
+
+// Returned when deleting something other records still refer to
+var ErrInUse = errors.New("in use")
+
 type DBClient interface {
-	GetAllMetrics(startDate, endDate string) ([]models.Metric, error)
-	GetStatusCodeDistributionByURL(startDate, endDate string) (map[string][]models.StatusCodeCount, error)
+	GetAllMetrics(startDate, endDate string, failureReason *models.FailureReason, excludeRetried bool) ([]models.Metric, error)
+	GetMetricsAfter(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error)
+	GetStatusCodeDistributionByURL(start, end time.Time, failureReason *models.FailureReason) (map[string][]models.StatusCodeCount, error)
+	GetFailureReasonDistributionByURL(start, end time.Time, failureReason *models.FailureReason) (map[string][]models.FailureReasonCount, error)
+	GetLatencyBreakdownByURL(start, end time.Time, excludeRetried bool) (map[string][]models.LatencyBreakdown, error)
+	StoreCertificates(endpointID uuid.UUID, certs []models.Certificate) error
+	GetExpiringCertificates(before time.Time) ([]models.Certificate, error)
 	StoreMetric(m models.Metric) error
 	StoreEndpoint(ep models.MonitoredEndpoint) error
+	UpdateEndpoint(ep models.MonitoredEndpoint) error
 	GetAllEndpoints() ([]models.MonitoredEndpoint, error)
+	GetEndpoint(id uuid.UUID) (models.MonitoredEndpoint, error)
+	SetEndpointPaused(id uuid.UUID, paused bool) error
+	GetEndpointByPingToken(token string) (models.MonitoredEndpoint, error)
+	SetPingState(id uuid.UUID, state models.PingState) error
+	RollUpMetrics(now time.Time, settle time.Duration) error
+	GetRollups(resolution models.Resolution, start, end time.Time) ([]models.Rollup, error)
+	RolledUntil(resolution models.Resolution) (time.Time, error)
+	GetLatencyPercentiles(interval time.Duration, start, end time.Time) ([]models.EndpointLatency, error)
+	DeleteExpired(resolution models.Resolution, endpointID uuid.UUID, before time.Time, limit int) (int64, error)
+	Compact() error
+	DeleteEndpoint(id uuid.UUID) error
+	StoreAuthProfile(p models.AuthProfile) error
+	GetAuthProfile(id uuid.UUID) (models.AuthProfile, error)
+	GetAllAuthProfiles() ([]models.AuthProfile, error)
+	DeleteAuthProfile(id uuid.UUID) error
 	DeleteDatabase() error
 	CreateDatabase() error
 }
 
 type SQLiteClient struct {
 	DB *sql.DB
+
+	// Encrypts sensitive header values at rest. Without it they can't be
+	// stored or read.
+	Secrets *secrets.Box
 }
 
-// Initialize the database and create necessary tables
-func NewSQLiteClient(path string) (*SQLiteClient, error) {
+// Initialize the database and create necessary tables. Secrets encrypts
+// sensitive values, including any the migrations find in plain text.
+func NewSQLiteClient(path string, box *secrets.Box) (*SQLiteClient, error) {
 	db, err := sql.Open("sqlite3", path)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create tables for endpoints and metrics
-	schema := `
-	CREATE TABLE IF NOT EXISTS monitored_endpoints (
-		id TEXT PRIMARY KEY,
-		url TEXT,
-		frequency INTEGER,
-		headers TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS api_metrics (
-		id TEXT PRIMARY KEY,
-		endpoint_id TEXT,
-		timestamp DATETIME,
-		status_code INTEGER,
-		latency_ms INTEGER,
-		FOREIGN KEY(endpoint_id) REFERENCES monitored_endpoints(id)
-	);`
-
-	_, err = db.Exec(schema)
+	applied, err := Migrate(db, box, false)
 	if err != nil {
 		return nil, err
 	}
+	for _, m := range applied {
+		log.Printf("Applied schema migration %d: %s", m.Version, m.Description)
+	}
 
-	return &SQLiteClient{DB: db}, nil
+	return &SQLiteClient{DB: db, Secrets: box}, nil
+}
+
+// Columns set from an endpoint's settings. The paused state and ping state
+// are left out, as they are changed by their own updates.
+var editableEndpointColumns = []string{
+	"url", "frequency", "headers", "method", "body", "content_type", "expected_status", "assertions",
+	"retries", "retry_backoff_ms", "confirm_after", "timeout_ms", "max_redirects", "no_redirects", "proxy_url", "tls_skip_verify", "ca_bundle",
+	"auth_profile_id", "type", "steps", "banner_match", "dns_record_type", "dns_expected", "dns_resolver", "min_tls_version",
+	"grpc_service", "ws_message", "ws_expect", "ping_token", "grace_seconds",
+	"retain_raw_days", "retain_minute_days", "retain_hour_days",
 }
 
 // Store an endpoint in the database
 func (c *SQLiteClient) StoreEndpoint(ep models.MonitoredEndpoint) error {
-	headersJSON, err := json.Marshal(ep.Headers)
+	values, err := c.editableEndpointValues(ep)
 	if err != nil {
 		return err
 	}
+	args := append([]any{ep.ID.String()}, values...)
+	args = append(args, ep.Paused, optionalTimestamp(ep.LastPingAt), optionalTimestamp(ep.RunningSince), ep.StartLog)
 
-	_, err = c.DB.Exec(`
-		INSERT OR REPLACE INTO monitored_endpoints (id, url, frequency, headers)
-		VALUES (?, ?, ?, ?)`,
-		ep.ID.String(), ep.URL, int(ep.Frequency.Seconds()), string(headersJSON),
+	_, err = c.DB.Exec(fmt.Sprintf(`
+		INSERT OR REPLACE INTO monitored_endpoints (id, %s, paused, last_ping_at, running_since, ping_start_log)
+		VALUES (?%s, ?, ?, ?, ?)`,
+		strings.Join(editableEndpointColumns, ", "), strings.Repeat(", ?", len(editableEndpointColumns))),
+		args...,
 	)
 	return err
 }
 
+// Replace an existing endpoint's settings, leaving its paused state alone so
+// a pause or resume made while it was being edited isn't undone. The ping
+// state is kept too, unless the ping token changes and it belongs to a
+// heartbeat that no longer exists.
+func (c *SQLiteClient) UpdateEndpoint(ep models.MonitoredEndpoint) error {
+	values, err := c.editableEndpointValues(ep)
+	if err != nil {
+		return err
+	}
+	args := append(values, ep.PingToken, ep.PingToken, ep.PingToken, ep.ID.String())
+
+	// Every expression sees the row as it was, so ping_token here is the
+	// stored token rather than the new one
+	res, err := c.DB.Exec(fmt.Sprintf(`
+		UPDATE monitored_endpoints SET %s = ?,
+			last_ping_at = CASE WHEN ping_token = ? THEN last_ping_at ELSE '' END,
+			running_since = CASE WHEN ping_token = ? THEN running_since ELSE '' END,
+			ping_start_log = CASE WHEN ping_token = ? THEN ping_start_log ELSE '' END
+		WHERE id = ?`, strings.Join(editableEndpointColumns, " = ?, ")),
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// Values for editableEndpointColumns, in the same order, with secrets sealed
+func (c *SQLiteClient) editableEndpointValues(ep models.MonitoredEndpoint) ([]any, error) {
+	headers, err := c.sealHeaders(ep.Headers)
+	if err != nil {
+		return nil, err
+	}
+	headersJSON, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	assertionsJSON, err := marshalOptional(ep.Assertions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step headers can carry credentials too, so are sealed the same way
+	steps := make([]models.TransactionStep, len(ep.Steps))
+	for i, step := range ep.Steps {
+		if step.Headers, err = c.sealHeaders(step.Headers); err != nil {
+			return nil, err
+		}
+		steps[i] = step
+	}
+	stepsJSON, err := marshalOptional(steps)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyURL, err := c.sealProxyURL(ep.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var retention models.RetentionPolicy
+	if ep.Retention != nil {
+		retention = *ep.Retention
+	}
+
+	return []any{
+		ep.URL, int(ep.Frequency.Seconds()), string(headersJSON),
+		ep.HTTPMethod(), ep.Body, ep.ContentType, models.FormatStatusRanges(ep.ExpectedStatus), assertionsJSON,
+		ep.Retry.Retries, ep.Retry.BackoffMS, ep.Retry.ConfirmAfter,
+		ep.TimeoutMS, ep.MaxRedirects, ep.NoRedirects, proxyURL, ep.TLSSkipVerify, ep.CABundle,
+		optionalID(ep.AuthProfileID), string(ep.Kind()), stepsJSON,
+		ep.BannerMatch, ep.DNSRecordType, ep.DNSExpected, ep.DNSResolver, ep.MinTLSVersion,
+		ep.GRPCService, ep.WSMessage, ep.WSExpect, ep.PingToken, ep.GraceSeconds,
+		retention.RawDays, retention.MinuteDays, retention.HourDays,
+	}, nil
+}
+
 // Store a metric in the database
 func (c *SQLiteClient) StoreMetric(m models.Metric) error {
-	_, err := c.DB.Exec(`
-		INSERT INTO api_metrics (id, endpoint_id, timestamp, status_code, latency_ms)
-		VALUES (?, ?, ?, ?, ?)`,
-		m.ID.String(), m.EndpointID.String(), m.Timestamp.Format(time.RFC3339),
-		m.StatusCode, m.LatencyMS,
+	resultsJSON, err := marshalOptional(m.AssertionResults)
+	if err != nil {
+		return err
+	}
+
+	redirectsJSON, err := marshalOptional(m.RedirectChain)
+	if err != nil {
+		return err
+	}
+
+	stepsJSON, err := marshalOptional(m.Steps)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.DB.Exec(`
+		INSERT INTO api_metrics (id, endpoint_id, timestamp, status_code, latency_ms, success, assertion_results,
+			dns_ms, connect_ms, tls_ms, ttfb_ms, transfer_ms, failure_reason, error_message, attempts, unconfirmed, redirect_chain,
+			step_results, tls_version, grpc_status, handshake_ms, first_message_ms, close_code, ping, ping_log)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.ID.String(), m.EndpointID.String(), formatTimestamp(m.Timestamp),
+		m.StatusCode, m.LatencyMS, m.Success, resultsJSON,
+		m.DNSMS, m.ConnectMS, m.TLSMS, m.TTFBMS, m.TransferMS,
+		string(m.FailureReason), m.ErrorMessage, max(m.Attempts, 1), m.Unconfirmed, redirectsJSON,
+		stepsJSON, m.TLSVersion, m.GRPCStatus, m.HandshakeMS, m.FirstMessageMS, m.CloseCode,
+		string(m.Ping), m.PingLog,
 	)
 	return err
 }
 
+const endpointColumns = `id, url, frequency, COALESCE(headers, ''), COALESCE(method, 'GET'), COALESCE(body, ''),
+	COALESCE(content_type, ''), COALESCE(expected_status, ''), COALESCE(assertions, ''), COALESCE(paused, 0),
+	COALESCE(retries, 0), COALESCE(retry_backoff_ms, 0), COALESCE(confirm_after, 0),
+	COALESCE(timeout_ms, 0), COALESCE(max_redirects, 0), COALESCE(no_redirects, 0), COALESCE(proxy_url, ''),
+	COALESCE(tls_skip_verify, 0), COALESCE(ca_bundle, ''), COALESCE(auth_profile_id, ''), COALESCE(type, 'http'),
+	COALESCE(steps, ''), COALESCE(banner_match, ''), COALESCE(dns_record_type, ''), COALESCE(dns_expected, ''),
+	COALESCE(dns_resolver, ''), COALESCE(min_tls_version, ''), COALESCE(grpc_service, ''),
+	COALESCE(ws_message, ''), COALESCE(ws_expect, ''), COALESCE(ping_token, ''), COALESCE(grace_seconds, 0),
+	COALESCE(last_ping_at, ''), COALESCE(running_since, ''), COALESCE(ping_start_log, ''),
+	COALESCE(retain_raw_days, 0), COALESCE(retain_minute_days, 0), COALESCE(retain_hour_days, 0)`
+
 // Fetch all endpoints from the DB
 func (c *SQLiteClient) GetAllEndpoints() ([]models.MonitoredEndpoint, error) {
-	rows, err := c.DB.Query("SELECT id, url, frequency FROM monitored_endpoints")
+	rows, err := c.DB.Query("SELECT " + endpointColumns + " FROM monitored_endpoints")
 	if err != nil {
 		return nil, err
 	}
@@ -93,83 +244,417 @@ func (c *SQLiteClient) GetAllEndpoints() ([]models.MonitoredEndpoint, error) {
 
 	var endpoints []models.MonitoredEndpoint
 	for rows.Next() {
-		var ep models.MonitoredEndpoint
-		var freq int
-		err := rows.Scan(&ep.ID, &ep.URL, &freq)
+		ep, err := c.scanEndpoint(rows)
 		if err != nil {
 			return nil, err
 		}
-		ep.Frequency = time.Duration(freq) * time.Second
 		endpoints = append(endpoints, ep)
 	}
 
-	return endpoints, nil
+	return endpoints, rows.Err()
+}
+
+// Fetch a single endpoint, returning ErrNotFound if it doesn't exist
+func (c *SQLiteClient) GetEndpoint(id uuid.UUID) (models.MonitoredEndpoint, error) {
+	row := c.DB.QueryRow("SELECT "+endpointColumns+" FROM monitored_endpoints WHERE id = ?", id.String())
+	ep, err := c.scanEndpoint(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ep, ErrNotFound
+	}
+	return ep, err
+}
+
+// Pause or resume polling of an endpoint
+func (c *SQLiteClient) SetEndpointPaused(id uuid.UUID, paused bool) error {
+	res, err := c.DB.Exec("UPDATE monitored_endpoints SET paused = ? WHERE id = ?", paused, id.String())
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// Delete an endpoint along with its metrics, rollups and certificates
+func (c *SQLiteClient) DeleteEndpoint(id uuid.UUID) error {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM api_metrics WHERE endpoint_id = ?", id.String()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM metric_rollups WHERE endpoint_id = ?", id.String()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM endpoint_certificates WHERE endpoint_id = ?", id.String()); err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM monitored_endpoints WHERE id = ?", id.String())
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Anything rows can be scanned from, so single and multi-row queries share code
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func (c *SQLiteClient) scanEndpoint(row scanner) (models.MonitoredEndpoint, error) {
+	var ep models.MonitoredEndpoint
+	var freq int
+	var headers, expectedStatus, assertions, authProfileID, steps, lastPingAt, runningSince string
+	var retention models.RetentionPolicy
+	err := row.Scan(&ep.ID, &ep.URL, &freq, &headers, &ep.Method, &ep.Body, &ep.ContentType, &expectedStatus, &assertions, &ep.Paused,
+		&ep.Retry.Retries, &ep.Retry.BackoffMS, &ep.Retry.ConfirmAfter,
+		&ep.TimeoutMS, &ep.MaxRedirects, &ep.NoRedirects, &ep.ProxyURL, &ep.TLSSkipVerify, &ep.CABundle, &authProfileID,
+		&ep.Type, &steps, &ep.BannerMatch, &ep.DNSRecordType, &ep.DNSExpected, &ep.DNSResolver, &ep.MinTLSVersion,
+		&ep.GRPCService, &ep.WSMessage, &ep.WSExpect, &ep.PingToken, &ep.GraceSeconds,
+		&lastPingAt, &runningSince, &ep.StartLog, &retention.RawDays, &retention.MinuteDays, &retention.HourDays)
+	if err != nil {
+		return ep, err
+	}
+	if retention != (models.RetentionPolicy{}) {
+		ep.Retention = &retention
+	}
+	if ep.ProxyURL, err = c.Secrets.Open(ep.ProxyURL); err != nil {
+		return ep, fmt.Errorf("endpoint %s: proxy url: %w", ep.ID, err)
+	}
+	if ep.LastPingAt, err = parseOptionalTimestamp(lastPingAt); err != nil {
+		return ep, err
+	}
+	if ep.RunningSince, err = parseOptionalTimestamp(runningSince); err != nil {
+		return ep, err
+	}
+	ep.Frequency = time.Duration(freq) * time.Second
+	if authProfileID != "" {
+		id, err := uuid.Parse(authProfileID)
+		if err != nil {
+			return ep, err
+		}
+		ep.AuthProfileID = &id
+	}
+	if ep.ExpectedStatus, err = models.ParseStatusRanges(expectedStatus); err != nil {
+		return ep, err
+	}
+	if err := unmarshalOptional(assertions, &ep.Assertions); err != nil {
+		return ep, err
+	}
+	if headers != "" && headers != "null" {
+		if err := json.Unmarshal([]byte(headers), &ep.Headers); err != nil {
+			return ep, err
+		}
+		if ep.Headers, err = c.openHeaders(ep.Headers); err != nil {
+			return ep, fmt.Errorf("endpoint %s: %w", ep.ID, err)
+		}
+	}
+	if err := unmarshalOptional(steps, &ep.Steps); err != nil {
+		return ep, err
+	}
+	for i := range ep.Steps {
+		if ep.Steps[i].Headers, err = c.openHeaders(ep.Steps[i].Headers); err != nil {
+			return ep, fmt.Errorf("endpoint %s step %d: %w", ep.ID, i+1, err)
+		}
+	}
+	return ep, nil
+}
+
+// Encrypt the values of sensitive headers before they are stored
+func (c *SQLiteClient) sealHeaders(headers map[string]string) (map[string]string, error) {
+	sealed := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if models.IsSensitiveHeader(k) {
+			if c.Secrets == nil {
+				return nil, fmt.Errorf("can't store header %s without a secret key", k)
+			}
+			var err error
+			if v, err = c.Secrets.Seal(v); err != nil {
+				return nil, err
+			}
+		}
+		sealed[k] = v
+	}
+	return sealed, nil
+}
+
+// A proxy URL with a password is sealed whole, like a sensitive header
+func (c *SQLiteClient) sealProxyURL(proxyURL string) (string, error) {
+	if !models.ProxyHasPassword(proxyURL) {
+		return proxyURL, nil
+	}
+	if c.Secrets == nil {
+		return "", fmt.Errorf("can't store a proxy url with a password without a secret key")
+	}
+	return c.Secrets.Seal(proxyURL)
+}
+
+func (c *SQLiteClient) openHeaders(headers map[string]string) (map[string]string, error) {
+	for k, v := range headers {
+		plain, err := c.Secrets.Open(v)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", k, err)
+		}
+		headers[k] = plain
+	}
+	return headers, nil
+}
+
+// Store NULL-able IDs as an empty string when unset
+func optionalID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+// Map an update or delete that touched no rows to ErrNotFound
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
-// Fetch all metrics from the DB within a date range
-func (c *SQLiteClient) GetAllMetrics(startDate, endDate string) ([]models.Metric, error) {
+const metricColumns = `m.id, m.endpoint_id, m.timestamp, m.status_code, m.latency_ms, COALESCE(m.success, 0), COALESCE(m.assertion_results, ''),
+	COALESCE(m.dns_ms, 0), COALESCE(m.connect_ms, 0), COALESCE(m.tls_ms, 0), COALESCE(m.ttfb_ms, 0), COALESCE(m.transfer_ms, 0),
+	COALESCE(m.failure_reason, ''), COALESCE(m.error_message, ''), COALESCE(m.attempts, 1), COALESCE(m.unconfirmed, 0),
+	COALESCE(m.redirect_chain, ''), COALESCE(m.step_results, ''), COALESCE(m.tls_version, ''),
+	COALESCE(m.grpc_status, ''), COALESCE(m.handshake_ms, 0), COALESCE(m.first_message_ms, 0), COALESCE(m.close_code, 0),
+	COALESCE(m.ping, ''), COALESCE(m.ping_log, ''), e.url`
+
+// Fetch all metrics from the DB within a date range. With excludeRetried set,
+// checks that needed more than one attempt are left out.
+func (c *SQLiteClient) GetAllMetrics(startDate, endDate string, failureReason *models.FailureReason, excludeRetried bool) ([]models.Metric, error) {
 	rows, err := c.DB.Query(`
-	SELECT m.id, m.endpoint_id, m.timestamp, m.status_code, m.latency_ms, e.url
+	SELECT `+metricColumns+`
 	FROM api_metrics m
 	JOIN monitored_endpoints e ON m.endpoint_id = e.id
 	WHERE m.timestamp BETWEEN ? AND ?
+	AND (? IS NULL OR COALESCE(m.failure_reason, '') = ?)
+	AND (? = 0 OR COALESCE(m.attempts, 1) <= 1)
 	ORDER BY m.timestamp ASC
-	LIMIT 100`, startDate, endDate)
+	LIMIT 100`, startDate, endDate, failureReasonArg(failureReason), failureReasonArg(failureReason), excludeRetried)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanMetrics(rows)
+}
+
+// Fetch up to limit metrics stored after a cursor that match a live feed
+// filter, oldest first. Pass the last metric's cursor to read the next page.
+// The filter must have been compiled.
+func (c *SQLiteClient) GetMetricsAfter(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error) {
+	where, args := filterConditions(filter)
+	args = append([]any{formatTimestamp(cursor.Timestamp), cursor.ID.String()}, args...)
+	rows, err := c.DB.Query(`
+	SELECT `+metricColumns+`
+	FROM api_metrics m
+	JOIN monitored_endpoints e ON m.endpoint_id = e.id
+	WHERE (m.timestamp, m.id) > (?, ?)`+where+`
+	ORDER BY m.timestamp ASC, m.id ASC
+	LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMetrics(rows)
+}
+
+// SQL conditions, each starting with AND, matching the metrics a live feed
+// filter lets through
+func filterConditions(f hub.Filter) (string, []any) {
+	var where strings.Builder
+	var args []any
+
+	// Endpoint IDs and URL patterns both select endpoints, so either can match
+	var endpoints []string
+	for _, id := range f.EndpointIDs {
+		endpoints = append(endpoints, "m.endpoint_id = ?")
+		args = append(args, id.String())
+	}
+	for _, pattern := range f.URLPatterns {
+		endpoints = append(endpoints, "e.url GLOB ?")
+		args = append(args, globPattern(pattern))
+	}
+	if len(endpoints) > 0 {
+		where.WriteString(" AND (" + strings.Join(endpoints, " OR ") + ")")
+	}
+
+	if classes := f.Classes(); len(classes) > 0 {
+		where.WriteString(" AND m.status_code / 100 IN (?" + strings.Repeat(", ?", len(classes)-1) + ")")
+		for _, class := range classes {
+			args = append(args, class)
+		}
+	}
+
+	if f.MinLatencyMS > 0 {
+		where.WriteString(" AND m.latency_ms >= ?")
+		args = append(args, f.MinLatencyMS)
+	}
+	return where.String(), args
+}
+
+// SQLite GLOB pattern for a filter's URL pattern, where only * is special
+func globPattern(pattern string) string {
+	return strings.NewReplacer("[", "[[]", "?", "[?]").Replace(pattern)
+}
+
+func scanMetrics(rows *sql.Rows) ([]models.Metric, error) {
 	var metrics []models.Metric
 	for rows.Next() {
 		var m models.Metric
-		var timestamp string
-		err := rows.Scan(&m.ID, &m.EndpointID, &timestamp, &m.StatusCode, &m.LatencyMS, &m.URL)
+		var timestamp, results, redirects, steps string
+		err := rows.Scan(&m.ID, &m.EndpointID, &timestamp, &m.StatusCode, &m.LatencyMS, &m.Success, &results,
+			&m.DNSMS, &m.ConnectMS, &m.TLSMS, &m.TTFBMS, &m.TransferMS, &m.FailureReason, &m.ErrorMessage, &m.Attempts, &m.Unconfirmed,
+			&redirects, &steps, &m.TLSVersion, &m.GRPCStatus,
+			&m.HandshakeMS, &m.FirstMessageMS, &m.CloseCode, &m.Ping, &m.PingLog, &m.URL)
 		if err != nil {
 			return nil, err
 		}
+		if err := unmarshalOptional(results, &m.AssertionResults); err != nil {
+			return nil, err
+		}
+		if err := unmarshalOptional(redirects, &m.RedirectChain); err != nil {
+			return nil, err
+		}
+		if err := unmarshalOptional(steps, &m.Steps); err != nil {
+			return nil, err
+		}
 		m.Timestamp, _ = time.Parse(time.RFC3339, timestamp) // Convert string to time
 		metrics = append(metrics, m)
 	}
 
-	return metrics, nil
+	return metrics, rows.Err()
+}
+
+// Query argument for an optional failure reason filter, NULL when unset
+func failureReasonArg(r *models.FailureReason) any {
+	if r == nil {
+		return nil
+	}
+	return string(*r)
 }
 
-func (c *SQLiteClient) GetStatusCodeDistributionByURL(startDate, endDate string) (map[string][]models.StatusCodeCount, error) {
+// Encode a slice column as JSON, storing empty slices as an empty string
+func marshalOptional[T any](values []T) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(values)
+	return string(b), err
+}
+
+func unmarshalOptional[T any](data string, values *[]T) error {
+	if data == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(data), values)
+}
+
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(timestampLayout)
+}
+
+// Store an optional time as a timestamp, or an empty string when unset
+func optionalTimestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTimestamp(*t)
+}
+
+func parseOptionalTimestamp(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Replace the stored certificate chain for an endpoint with the latest one seen
+func (c *SQLiteClient) StoreCertificates(endpointID uuid.UUID, certs []models.Certificate) error {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM endpoint_certificates WHERE endpoint_id = ?", endpointID.String()); err != nil {
+		return err
+	}
+
+	for _, cert := range certs {
+		sansJSON, err := json.Marshal(cert.SANs)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO endpoint_certificates (endpoint_id, position, subject, sans, issuer, not_before, not_after,
+				key_type, hostname_verified, checked_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			endpointID.String(), cert.Position, cert.Subject, string(sansJSON), cert.Issuer,
+			formatTimestamp(cert.NotBefore), formatTimestamp(cert.NotAfter), cert.KeyType,
+			cert.HostnameVerified, formatTimestamp(cert.CheckedAt),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Fetch every stored certificate that expires before the given time, soonest first
+func (c *SQLiteClient) GetExpiringCertificates(before time.Time) ([]models.Certificate, error) {
 	rows, err := c.DB.Query(`
-		SELECT e.url, m.status_code, COUNT(*) as count
-		FROM api_metrics m
-		JOIN monitored_endpoints e ON m.endpoint_id = e.id
-		WHERE m.timestamp BETWEEN ? AND ?
-		GROUP BY e.url, m.status_code
-	`, startDate, endDate)
+		SELECT c.endpoint_id, e.url, c.position, c.subject, c.sans, c.issuer, c.not_before, c.not_after,
+			c.key_type, c.hostname_verified, c.checked_at
+		FROM endpoint_certificates c
+		JOIN monitored_endpoints e ON c.endpoint_id = e.id
+		WHERE c.not_after < ?
+		ORDER BY c.not_after ASC, e.url, c.position
+	`, formatTimestamp(before))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	result := make(map[string][]models.StatusCodeCount)
-
+	var certs []models.Certificate
 	for rows.Next() {
-		var url string
-		var statusCode, count int
+		var cert models.Certificate
+		var sans, notBefore, notAfter, checkedAt string
 
-		if err := rows.Scan(&url, &statusCode, &count); err != nil {
+		err := rows.Scan(&cert.EndpointID, &cert.URL, &cert.Position, &cert.Subject, &sans, &cert.Issuer,
+			&notBefore, &notAfter, &cert.KeyType, &cert.HostnameVerified, &checkedAt)
+		if err != nil {
 			return nil, err
 		}
+		if err := json.Unmarshal([]byte(sans), &cert.SANs); err != nil {
+			return nil, err
+		}
+		cert.NotBefore, _ = time.Parse(time.RFC3339, notBefore)
+		cert.NotAfter, _ = time.Parse(time.RFC3339, notAfter)
+		cert.CheckedAt, _ = time.Parse(time.RFC3339, checkedAt)
 
-		result[url] = append(result[url], models.StatusCodeCount{
-			URL:        url,
-			StatusCode: statusCode,
-			Count:      count,
-		})
+		certs = append(certs, cert)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return result, nil
+	return certs, rows.Err()
 }
 
 func (c *SQLiteClient) DeleteDatabase() error {
@@ -181,25 +666,31 @@ func (c *SQLiteClient) DeleteDatabase() error {
 	if err != nil {
 		return err
 	}
+	_, err = c.DB.Exec("DROP TABLE IF EXISTS endpoint_certificates")
+	if err != nil {
+		return err
+	}
+	_, err = c.DB.Exec("DROP TABLE IF EXISTS auth_profiles")
+	if err != nil {
+		return err
+	}
+	_, err = c.DB.Exec("DROP TABLE IF EXISTS metric_rollups")
+	if err != nil {
+		return err
+	}
+	_, err = c.DB.Exec("DROP TABLE IF EXISTS rollup_progress")
+	if err != nil {
+		return err
+	}
+	_, err = c.DB.Exec("DROP TABLE IF EXISTS schema_version")
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
+// Create the schema from scratch, such as after DeleteDatabase
 func (c *SQLiteClient) CreateDatabase() error {
-	_, err := c.DB.Exec(`
-	CREATE TABLE IF NOT EXISTS monitored_endpoints (
-		id TEXT PRIMARY KEY,
-		url TEXT,
-		frequency INTEGER,
-		headers TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS api_metrics (
-		id TEXT PRIMARY KEY,
-		endpoint_id TEXT,
-		timestamp DATETIME,
-		status_code INTEGER,
-		latency_ms INTEGER,
-		FOREIGN KEY(endpoint_id) REFERENCES monitored_endpoints(id)
-	);`)
+	_, err := Migrate(c.DB, c.Secrets, false)
 	return err
 }
@@ -1,23 +1,52 @@
 package db
 
 import (
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
 	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
 )
 
 type MockDBClient struct {
-	StoreEndpointFunc                  func(models.MonitoredEndpoint) error
-	StoreMetricFunc                    func(models.Metric) error
-	GetAllEndpointsFunc                func() ([]models.MonitoredEndpoint, error)
-	GetAllMetricsFunc                  func(startDate, endDate string) ([]models.Metric, error)
-	GetStatusCodeDistributionByURLFunc func(startDate, endDate string) (map[string][]models.StatusCodeCount, error)
-	DeleteDatabaseFunc                 func() error
-	CreateDatabaseFunc                 func() error
+	StoreEndpointFunc                     func(models.MonitoredEndpoint) error
+	UpdateEndpointFunc                    func(models.MonitoredEndpoint) error
+	StoreMetricFunc                       func(models.Metric) error
+	GetAllEndpointsFunc                   func() ([]models.MonitoredEndpoint, error)
+	GetEndpointFunc                       func(id uuid.UUID) (models.MonitoredEndpoint, error)
+	SetEndpointPausedFunc                 func(id uuid.UUID, paused bool) error
+	GetEndpointByPingTokenFunc            func(token string) (models.MonitoredEndpoint, error)
+	SetPingStateFunc                      func(id uuid.UUID, state models.PingState) error
+	RollUpMetricsFunc                     func(now time.Time, settle time.Duration) error
+	GetRollupsFunc                        func(resolution models.Resolution, start, end time.Time) ([]models.Rollup, error)
+	RolledUntilFunc                       func(resolution models.Resolution) (time.Time, error)
+	GetLatencyPercentilesFunc             func(interval time.Duration, start, end time.Time) ([]models.EndpointLatency, error)
+	DeleteExpiredFunc                     func(resolution models.Resolution, endpointID uuid.UUID, before time.Time, limit int) (int64, error)
+	CompactFunc                           func() error
+	DeleteEndpointFunc                    func(id uuid.UUID) error
+	StoreAuthProfileFunc                  func(p models.AuthProfile) error
+	GetAuthProfileFunc                    func(id uuid.UUID) (models.AuthProfile, error)
+	GetAllAuthProfilesFunc                func() ([]models.AuthProfile, error)
+	DeleteAuthProfileFunc                 func(id uuid.UUID) error
+	GetAllMetricsFunc                     func(startDate, endDate string, failureReason *models.FailureReason, excludeRetried bool) ([]models.Metric, error)
+	GetMetricsAfterFunc                   func(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error)
+	GetStatusCodeDistributionByURLFunc    func(start, end time.Time, failureReason *models.FailureReason) (map[string][]models.StatusCodeCount, error)
+	GetFailureReasonDistributionByURLFunc func(start, end time.Time, failureReason *models.FailureReason) (map[string][]models.FailureReasonCount, error)
+	GetLatencyBreakdownByURLFunc          func(start, end time.Time, excludeRetried bool) (map[string][]models.LatencyBreakdown, error)
+	StoreCertificatesFunc                 func(endpointID uuid.UUID, certs []models.Certificate) error
+	GetExpiringCertificatesFunc           func(before time.Time) ([]models.Certificate, error)
+	DeleteDatabaseFunc                    func() error
+	CreateDatabaseFunc                    func() error
 }
 
 func (m *MockDBClient) StoreEndpoint(ep models.MonitoredEndpoint) error {
 	return m.StoreEndpointFunc(ep)
 }
 
+func (m *MockDBClient) UpdateEndpoint(ep models.MonitoredEndpoint) error {
+	return m.UpdateEndpointFunc(ep)
+}
+
 func (m *MockDBClient) StoreMetric(metric models.Metric) error {
 	return m.StoreMetricFunc(metric)
 }
@@ -26,12 +55,92 @@ func (m *MockDBClient) GetAllEndpoints() ([]models.MonitoredEndpoint, error) {
 	return m.GetAllEndpointsFunc()
 }
 
-func (m *MockDBClient) GetAllMetrics(startDate, endDate string) ([]models.Metric, error) {
-	return m.GetAllMetricsFunc(startDate, endDate)
+func (m *MockDBClient) GetEndpoint(id uuid.UUID) (models.MonitoredEndpoint, error) {
+	return m.GetEndpointFunc(id)
+}
+
+func (m *MockDBClient) SetEndpointPaused(id uuid.UUID, paused bool) error {
+	return m.SetEndpointPausedFunc(id, paused)
+}
+
+func (m *MockDBClient) GetEndpointByPingToken(token string) (models.MonitoredEndpoint, error) {
+	return m.GetEndpointByPingTokenFunc(token)
+}
+
+func (m *MockDBClient) SetPingState(id uuid.UUID, state models.PingState) error {
+	return m.SetPingStateFunc(id, state)
+}
+
+func (m *MockDBClient) RollUpMetrics(now time.Time, settle time.Duration) error {
+	return m.RollUpMetricsFunc(now, settle)
+}
+
+func (m *MockDBClient) GetRollups(resolution models.Resolution, start, end time.Time) ([]models.Rollup, error) {
+	return m.GetRollupsFunc(resolution, start, end)
+}
+
+func (m *MockDBClient) RolledUntil(resolution models.Resolution) (time.Time, error) {
+	return m.RolledUntilFunc(resolution)
+}
+
+func (m *MockDBClient) GetLatencyPercentiles(interval time.Duration, start, end time.Time) ([]models.EndpointLatency, error) {
+	return m.GetLatencyPercentilesFunc(interval, start, end)
+}
+
+func (m *MockDBClient) DeleteExpired(resolution models.Resolution, endpointID uuid.UUID, before time.Time, limit int) (int64, error) {
+	return m.DeleteExpiredFunc(resolution, endpointID, before, limit)
+}
+
+func (m *MockDBClient) Compact() error {
+	return m.CompactFunc()
+}
+
+func (m *MockDBClient) DeleteEndpoint(id uuid.UUID) error {
+	return m.DeleteEndpointFunc(id)
+}
+
+func (m *MockDBClient) StoreAuthProfile(p models.AuthProfile) error {
+	return m.StoreAuthProfileFunc(p)
+}
+
+func (m *MockDBClient) GetAuthProfile(id uuid.UUID) (models.AuthProfile, error) {
+	return m.GetAuthProfileFunc(id)
+}
+
+func (m *MockDBClient) GetAllAuthProfiles() ([]models.AuthProfile, error) {
+	return m.GetAllAuthProfilesFunc()
+}
+
+func (m *MockDBClient) DeleteAuthProfile(id uuid.UUID) error {
+	return m.DeleteAuthProfileFunc(id)
+}
+
+func (m *MockDBClient) GetAllMetrics(startDate, endDate string, failureReason *models.FailureReason, excludeRetried bool) ([]models.Metric, error) {
+	return m.GetAllMetricsFunc(startDate, endDate, failureReason, excludeRetried)
+}
+
+func (m *MockDBClient) GetMetricsAfter(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error) {
+	return m.GetMetricsAfterFunc(cursor, filter, limit)
+}
+
+func (m *MockDBClient) GetStatusCodeDistributionByURL(start, end time.Time, failureReason *models.FailureReason) (map[string][]models.StatusCodeCount, error) {
+	return m.GetStatusCodeDistributionByURLFunc(start, end, failureReason)
+}
+
+func (m *MockDBClient) GetFailureReasonDistributionByURL(start, end time.Time, failureReason *models.FailureReason) (map[string][]models.FailureReasonCount, error) {
+	return m.GetFailureReasonDistributionByURLFunc(start, end, failureReason)
+}
+
+func (m *MockDBClient) GetLatencyBreakdownByURL(start, end time.Time, excludeRetried bool) (map[string][]models.LatencyBreakdown, error) {
+	return m.GetLatencyBreakdownByURLFunc(start, end, excludeRetried)
+}
+
+func (m *MockDBClient) StoreCertificates(endpointID uuid.UUID, certs []models.Certificate) error {
+	return m.StoreCertificatesFunc(endpointID, certs)
 }
 
-func (m *MockDBClient) GetStatusCodeDistributionByURL(startDate, endDate string) (map[string][]models.StatusCodeCount, error) {
-	return m.GetStatusCodeDistributionByURLFunc(startDate, endDate)
+func (m *MockDBClient) GetExpiringCertificates(before time.Time) ([]models.Certificate, error) {
+	return m.GetExpiringCertificatesFunc(before)
 }
 
 func (m *MockDBClient) DeleteDatabase() error {
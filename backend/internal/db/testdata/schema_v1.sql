@@ -0,0 +1,25 @@
+-- A database as created by the first release, before any migrations, with
+-- rows written the way that release wrote them
+CREATE TABLE IF NOT EXISTS monitored_endpoints (
+	id TEXT PRIMARY KEY,
+	url TEXT,
+	frequency INTEGER,
+	headers TEXT
+);
+
+CREATE TABLE IF NOT EXISTS api_metrics (
+	id TEXT PRIMARY KEY,
+	endpoint_id TEXT,
+	timestamp DATETIME,
+	status_code INTEGER,
+	latency_ms INTEGER,
+	FOREIGN KEY(endpoint_id) REFERENCES monitored_endpoints(id)
+);
+
+INSERT INTO monitored_endpoints (id, url, frequency, headers) VALUES
+	('6f1c2b7e-8a4d-4f3e-9b2a-1c5d7e9f0a11', 'https://api.github.com', 30, '{"User-Agent":"Pulseboard-Poller","Authorization":"Bearer legacy-token"}'),
+	('0b8e5a3c-2d7f-4c1e-8a6b-9f3d5e7c1a22', 'https://httpstat.us/503', 60, '{}');
+
+INSERT INTO api_metrics (id, endpoint_id, timestamp, status_code, latency_ms) VALUES
+	('a1b2c3d4-0000-4000-8000-000000000001', '6f1c2b7e-8a4d-4f3e-9b2a-1c5d7e9f0a11', '2024-06-01T12:00:00Z', 200, 120),
+	('a1b2c3d4-0000-4000-8000-000000000002', '0b8e5a3c-2d7f-4c1e-8a6b-9f3d5e7c1a22', '2024-06-01T13:00:30+01:00', 503, 340);
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Handler function to list auth profiles with their secrets redacted
+func ListAuthProfiles(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for auth profiles from %s", r.RemoteAddr)
+		setJSONHeaders(w)
+
+		profiles, err := dbClient.GetAllAuthProfiles()
+		if err != nil {
+			log.Printf("Database error while listing auth profiles: %v", err)
+			http.Error(w, "Internal server error while fetching auth profiles", http.StatusInternalServerError)
+			return
+		}
+
+		redacted := make([]models.AuthProfile, 0, len(profiles))
+		for _, p := range profiles {
+			redacted = append(redacted, p.Redacted())
+		}
+
+		writeJSON(w, http.StatusOK, redacted)
+	}
+}
+
+// Handler function to fetch a single auth profile by ID
+func GetAuthProfile(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for auth profile %s from %s", r.PathValue("id"), r.RemoteAddr)
+		setJSONHeaders(w)
+
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		p, err := dbClient.GetAuthProfile(id)
+		if err != nil {
+			writeAuthProfileError(w, "fetching", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, p.Redacted())
+	}
+}
+
+// Handler function to create an auth profile
+func CreateAuthProfile(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request to create an auth profile from %s", r.RemoteAddr)
+		setJSONHeaders(w)
+
+		p, ok := decodeAuthProfile(w, r, nil)
+		if !ok {
+			return
+		}
+		p.ID = uuid.New()
+
+		if err := dbClient.StoreAuthProfile(p); err != nil {
+			log.Printf("Database error while creating auth profile: %v", err)
+			http.Error(w, "Internal server error while storing auth profile", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Created %s auth profile %s", p.Type, p.ID)
+		writeJSON(w, http.StatusCreated, p.Redacted())
+	}
+}
+
+// Handler function to replace an auth profile. Secrets sent back with their
+// redacted placeholder keep their stored value. Endpoints using the profile
+// pick up the change on their next check.
+func UpdateAuthProfile(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request to update auth profile %s from %s", r.PathValue("id"), r.RemoteAddr)
+		setJSONHeaders(w)
+
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		existing, err := dbClient.GetAuthProfile(id)
+		if err != nil {
+			writeAuthProfileError(w, "fetching", err)
+			return
+		}
+
+		p, ok := decodeAuthProfile(w, r, &existing)
+		if !ok {
+			return
+		}
+		p.ID = id
+
+		if err := dbClient.StoreAuthProfile(p); err != nil {
+			log.Printf("Database error while updating auth profile %s: %v", id, err)
+			http.Error(w, "Internal server error while storing auth profile", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Updated auth profile %s", id)
+		writeJSON(w, http.StatusOK, p.Redacted())
+	}
+}
+
+// Handler function to delete an auth profile no endpoint uses
+func DeleteAuthProfile(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request to delete auth profile %s from %s", r.PathValue("id"), r.RemoteAddr)
+		setJSONHeaders(w)
+
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := dbClient.DeleteAuthProfile(id); err != nil {
+			writeAuthProfileError(w, "deleting", err)
+			return
+		}
+
+		log.Printf("Deleted auth profile %s", id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Decode and validate a profile from the request body, writing a 400 if it
+// can't be used. Redacted secrets are filled from stored when given.
+func decodeAuthProfile(w http.ResponseWriter, r *http.Request, stored *models.AuthProfile) (models.AuthProfile, bool) {
+	var p models.AuthProfile
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEndpointBody)).Decode(&p); err != nil {
+		http.Error(w, "Invalid auth profile JSON: "+err.Error(), http.StatusBadRequest)
+		return p, false
+	}
+	if stored != nil {
+		p.KeepSecrets(*stored)
+	}
+	if err := p.Validate(); err != nil {
+		http.Error(w, "Invalid auth profile: "+err.Error(), http.StatusBadRequest)
+		return p, false
+	}
+	return p, true
+}
+
+func writeAuthProfileError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		http.Error(w, "Auth profile not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrInUse):
+		http.Error(w, "Auth profile is still used by an endpoint", http.StatusConflict)
+	default:
+		log.Printf("Database error while %s auth profile: %v", action, err)
+		http.Error(w, "Internal server error while "+action+" auth profile", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestCreateAuthProfile(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "creates a bearer profile", body: `{"name":"api","type":"bearer","token":"abc123"}`, expectedCode: http.StatusCreated},
+		{name: "rejects an unknown type", body: `{"name":"api","type":"digest"}`, expectedCode: http.StatusBadRequest},
+		{name: "rejects a missing token", body: `{"name":"api","type":"bearer"}`, expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored []models.AuthProfile
+			mock := &db.MockDBClient{
+				StoreAuthProfileFunc: func(p models.AuthProfile) error {
+					stored = append(stored, p)
+					return nil
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/authprofiles", strings.NewReader(tt.body))
+			rr := serveEndpoint("POST /authprofiles", CreateAuthProfile(mock), req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+			}
+			if rr.Code != http.StatusCreated {
+				return
+			}
+			if len(stored) != 1 || stored[0].Token != "abc123" || stored[0].ID == uuid.Nil {
+				t.Errorf("unexpected stored profiles: %+v", stored)
+			}
+			if strings.Contains(rr.Body.String(), "abc123") {
+				t.Errorf("expected the token to be redacted, got %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdateAuthProfileKeepsRedactedSecrets(t *testing.T) {
+	id := uuid.New()
+	var stored models.AuthProfile
+	mock := &db.MockDBClient{
+		GetAuthProfileFunc: func(uuid.UUID) (models.AuthProfile, error) {
+			return models.AuthProfile{ID: id, Name: "api", Type: models.AuthBasic, Username: "user", Password: "hunter2"}, nil
+		},
+		StoreAuthProfileFunc: func(p models.AuthProfile) error {
+			stored = p
+			return nil
+		},
+	}
+
+	body := `{"name":"renamed","type":"basic","username":"user","password":"[REDACTED]"}`
+	req := httptest.NewRequest(http.MethodPut, "/authprofiles/"+id.String(), strings.NewReader(body))
+	rr := serveEndpoint("PUT /authprofiles/{id}", UpdateAuthProfile(mock), req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if stored.ID != id || stored.Name != "renamed" || stored.Password != "hunter2" {
+		t.Errorf("unexpected stored profile: %+v", stored)
+	}
+}
+
+func TestDeleteAuthProfileInUse(t *testing.T) {
+	mock := &db.MockDBClient{
+		DeleteAuthProfileFunc: func(uuid.UUID) error {
+			return db.ErrInUse
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/authprofiles/"+uuid.NewString(), nil)
+	rr := serveEndpoint("DELETE /authprofiles/{id}", DeleteAuthProfile(mock), req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected status 409, got %d", rr.Code)
+	}
+}
+
+func TestCreateEndpointRejectsUnknownAuthProfile(t *testing.T) {
+	mock := &db.MockDBClient{
+		GetAuthProfileFunc: func(uuid.UUID) (models.AuthProfile, error) {
+			return models.AuthProfile{}, db.ErrNotFound
+		},
+		StoreEndpointFunc: func(models.MonitoredEndpoint) error {
+			t.Error("expected the endpoint not to be stored")
+			return nil
+		},
+	}
+
+	body := `{"url":"https://example.com","frequency_seconds":30,"auth_profile_id":"` + uuid.NewString() + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/endpoints", strings.NewReader(body))
+	rr := serveEndpoint("POST /endpoints", CreateEndpoint(mock, &fakeScheduler{}), req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+)
+
+// Window used when no days parameter is given
+const defaultExpiryWindowDays = 30
+
+// Handler function to list monitored certificates expiring within `days` days
+func GetExpiringCertificates(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for expiring certificates from %s", r.RemoteAddr)
+		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Make this configurable
+		w.Header().Set("Content-Type", "application/json")
+
+		days := defaultExpiryWindowDays
+		if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+			parsed, err := strconv.Atoi(daysStr)
+			if err != nil || parsed < 0 {
+				http.Error(w, "days must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			days = parsed
+		}
+
+		before := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+		certs, err := dbClient.GetExpiringCertificates(before)
+		if err != nil {
+			log.Printf("Database error while fetching expiring certificates: %v", err)
+			http.Error(w, "Internal server error while fetching certificates", http.StatusInternalServerError)
+			return
+		}
+
+		// If no certificates, return an empty array with 200 OK
+		if len(certs) == 0 {
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write([]byte("[]")); err != nil {
+				log.Printf("Error writing empty response: %v", err)
+			}
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(certs); err != nil {
+			log.Printf("Error encoding certificates to JSON: %v", err)
+			http.Error(w, "Internal server error while encoding certificates", http.StatusInternalServerError)
+		}
+	}
+}
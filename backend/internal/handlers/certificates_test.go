@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestGetExpiringCertificates(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		mockReturn   []models.Certificate
+		mockError    error
+		expectedCode int
+		expectedDays int
+	}{
+		{
+			name:  "returns certificates within the default window",
+			query: "",
+			mockReturn: []models.Certificate{
+				{EndpointID: uuid.New(), URL: "https://example.com", Subject: "CN=example.com", NotAfter: time.Now().Add(48 * time.Hour)},
+			},
+			expectedCode: http.StatusOK,
+			expectedDays: defaultExpiryWindowDays,
+		},
+		{
+			name:         "uses the requested window",
+			query:        "?days=7",
+			mockReturn:   []models.Certificate{},
+			expectedCode: http.StatusOK,
+			expectedDays: 7,
+		},
+		{
+			name:         "rejects an invalid window",
+			query:        "?days=soon",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "returns 500 on DB error",
+			mockError:    errors.New("db failure"),
+			expectedCode: http.StatusInternalServerError,
+			expectedDays: defaultExpiryWindowDays,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requestedBefore time.Time
+			mock := &db.MockDBClient{
+				GetExpiringCertificatesFunc: func(before time.Time) ([]models.Certificate, error) {
+					requestedBefore = before
+					return tt.mockReturn, tt.mockError
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/certificates/expiring"+tt.query, nil)
+			rr := httptest.NewRecorder()
+
+			handler := GetExpiringCertificates(mock)
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			if tt.expectedDays > 0 {
+				window := time.Until(requestedBefore)
+				expected := time.Duration(tt.expectedDays) * 24 * time.Hour
+				if window > expected || window < expected-time.Minute {
+					t.Errorf("expected a %d day window, got %s", tt.expectedDays, window)
+				}
+			}
+
+			if rr.Code == http.StatusOK {
+				var decoded []models.Certificate
+				if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+					t.Errorf("error decoding JSON: %v", err)
+				}
+				if len(decoded) != len(tt.mockReturn) {
+					t.Errorf("expected %d certificates, got %d", len(tt.mockReturn), len(decoded))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Largest endpoint definition accepted in a request body
+const maxEndpointBody = 1 << 20
+
+// What the endpoint handlers need from the running poller so changes take
+// effect without a restart
+type EndpointScheduler interface {
+	Add(ep models.MonitoredEndpoint)
+	Update(ep models.MonitoredEndpoint)
+	Remove(id uuid.UUID)
+}
+
+// Handler function to list every monitored endpoint
+func ListEndpoints(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for endpoints from %s", r.RemoteAddr)
+		setJSONHeaders(w)
+
+		endpoints, err := dbClient.GetAllEndpoints()
+		if err != nil {
+			log.Printf("Database error while listing endpoints: %v", err)
+			http.Error(w, "Internal server error while fetching endpoints", http.StatusInternalServerError)
+			return
+		}
+		redacted := make([]models.MonitoredEndpoint, 0, len(endpoints))
+		for _, ep := range endpoints {
+			redacted = append(redacted, ep.Redacted())
+		}
+
+		writeJSON(w, http.StatusOK, redacted)
+	}
+}
+
+// Handler function to fetch a single endpoint by ID
+func GetEndpoint(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for endpoint %s from %s", r.PathValue("id"), r.RemoteAddr)
+		setJSONHeaders(w)
+
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		ep, err := dbClient.GetEndpoint(id)
+		if err != nil {
+			writeEndpointError(w, "fetching", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, ep.Redacted())
+	}
+}
+
+// Handler function to create an endpoint and start polling it
+func CreateEndpoint(dbClient db.DBClient, scheduler EndpointScheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request to create an endpoint from %s", r.RemoteAddr)
+		setJSONHeaders(w)
+
+		ep, ok := decodeEndpoint(w, r)
+		if !ok || !authProfileExists(w, dbClient, ep) {
+			return
+		}
+		ep.ID = uuid.New()
+		if err := preparePings(&ep, models.MonitoredEndpoint{}); err != nil {
+			log.Printf("Error generating ping token: %v", err)
+			http.Error(w, "Internal server error while creating endpoint", http.StatusInternalServerError)
+			return
+		}
+
+		if err := dbClient.StoreEndpoint(ep); err != nil {
+			log.Printf("Database error while creating endpoint: %v", err)
+			http.Error(w, "Internal server error while storing endpoint", http.StatusInternalServerError)
+			return
+		}
+		scheduler.Add(ep)
+
+		log.Printf("Created endpoint %s for %s", ep.ID, ep.URL)
+		writeJSON(w, http.StatusCreated, ep.Redacted())
+	}
+}
+
+// Handler function to replace an endpoint's settings. The paused state is left
+// as it is; use the pause and resume handlers to change it. Headers and proxy
+// passwords sent back with their redacted placeholder keep their stored value,
+// and heartbeat monitors keep their ping URL.
+func UpdateEndpoint(dbClient db.DBClient, scheduler EndpointScheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request to update endpoint %s from %s", r.PathValue("id"), r.RemoteAddr)
+		setJSONHeaders(w)
+
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		existing, err := dbClient.GetEndpoint(id)
+		if err != nil {
+			writeEndpointError(w, "fetching", err)
+			return
+		}
+
+		ep, ok := decodeEndpoint(w, r)
+		if !ok {
+			return
+		}
+		ep.ID = id
+		if err := keepRedactedHeaders(ep.Headers, existing.Headers); err != nil {
+			http.Error(w, "Invalid endpoint: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ep.ProxyURL, err = keepRedactedProxyURL(ep.ProxyURL, existing.ProxyURL); err != nil {
+			http.Error(w, "Invalid endpoint: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		for i, step := range ep.Steps {
+			var stored map[string]string
+			for _, old := range existing.Steps {
+				if old.Name == step.Name {
+					stored = old.Headers
+				}
+			}
+			if err := keepRedactedHeaders(ep.Steps[i].Headers, stored); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid endpoint: step %q: %v", step.Name, err), http.StatusBadRequest)
+				return
+			}
+		}
+		if !authProfileExists(w, dbClient, ep) {
+			return
+		}
+		if err := preparePings(&ep, existing); err != nil {
+			log.Printf("Error generating ping token: %v", err)
+			http.Error(w, "Internal server error while updating endpoint", http.StatusInternalServerError)
+			return
+		}
+
+		if err := dbClient.UpdateEndpoint(ep); err != nil {
+			writeEndpointError(w, "updating", err)
+			return
+		}
+		// Read it back for the paused and ping state, which a pause or ping
+		// may have changed since it was fetched
+		if ep, err = dbClient.GetEndpoint(id); err != nil {
+			writeEndpointError(w, "fetching", err)
+			return
+		}
+		scheduler.Update(ep)
+
+		log.Printf("Updated endpoint %s", id)
+		writeJSON(w, http.StatusOK, ep.Redacted())
+	}
+}
+
+// Handler function to delete an endpoint and its history
+func DeleteEndpoint(dbClient db.DBClient, scheduler EndpointScheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request to delete endpoint %s from %s", r.PathValue("id"), r.RemoteAddr)
+		setJSONHeaders(w)
+
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		// Stop polling first so an in-flight check can't store a metric for
+		// the deleted endpoint
+		scheduler.Remove(id)
+		if err := dbClient.DeleteEndpoint(id); err != nil {
+			writeEndpointError(w, "deleting", err)
+			return
+		}
+
+		log.Printf("Deleted endpoint %s", id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Handler function to stop polling an endpoint without deleting it
+func PauseEndpoint(dbClient db.DBClient, scheduler EndpointScheduler) http.HandlerFunc {
+	return setPaused(dbClient, scheduler, true)
+}
+
+// Handler function to start polling a paused endpoint again
+func ResumeEndpoint(dbClient db.DBClient, scheduler EndpointScheduler) http.HandlerFunc {
+	return setPaused(dbClient, scheduler, false)
+}
+
+func setPaused(dbClient db.DBClient, scheduler EndpointScheduler, paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request to set endpoint %s paused=%v from %s", r.PathValue("id"), paused, r.RemoteAddr)
+		setJSONHeaders(w)
+
+		id, ok := pathID(w, r)
+		if !ok {
+			return
+		}
+
+		if err := dbClient.SetEndpointPaused(id, paused); err != nil {
+			writeEndpointError(w, "updating", err)
+			return
+		}
+
+		ep, err := dbClient.GetEndpoint(id)
+		if err != nil {
+			writeEndpointError(w, "fetching", err)
+			return
+		}
+		scheduler.Update(ep)
+
+		log.Printf("Set endpoint %s paused=%v", id, paused)
+		writeJSON(w, http.StatusOK, ep.Redacted())
+	}
+}
+
+// Handler function answering CORS preflight requests for the endpoint and
+// auth profile routes
+func EndpointsPreflight() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setJSONHeaders(w)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func setJSONHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Make this configurable
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// Parse the {id} path value, writing a 400 if it isn't a UUID
+func pathID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "id must be a valid UUID", http.StatusBadRequest)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// Decode and validate an endpoint from the request body, writing a 400 if
+// it can't be used
+func decodeEndpoint(w http.ResponseWriter, r *http.Request) (models.MonitoredEndpoint, bool) {
+	var ep models.MonitoredEndpoint
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEndpointBody)).Decode(&ep); err != nil {
+		http.Error(w, "Invalid endpoint JSON: "+err.Error(), http.StatusBadRequest)
+		return ep, false
+	}
+	// A transaction is listed under its first step's URL unless given one
+	if ep.Kind() == models.CheckTransaction && ep.URL == "" && len(ep.Steps) > 0 {
+		ep.URL = ep.Steps[0].URL
+	}
+	if err := ep.Validate(); err != nil {
+		http.Error(w, "Invalid endpoint: "+err.Error(), http.StatusBadRequest)
+		return ep, false
+	}
+	return ep, true
+}
+
+// Replace redacted placeholders with the stored header values, so secrets
+// don't have to be sent again to change other settings. Header names match
+// whatever their case, and a placeholder with nothing stored is an error.
+func keepRedactedHeaders(headers, stored map[string]string) error {
+	for k, v := range headers {
+		if v != models.RedactedValue {
+			continue
+		}
+		value, ok := storedHeader(stored, k)
+		if !ok {
+			return fmt.Errorf("header %s is redacted but has no stored value", k)
+		}
+		headers[k] = value
+	}
+	return nil
+}
+
+// Put the stored password back in a proxy URL sent with the redacted
+// placeholder as its password, as keepRedactedHeaders does for headers
+func keepRedactedProxyURL(proxyURL, stored string) (string, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.User == nil {
+		return proxyURL, nil
+	}
+	if password, _ := u.User.Password(); password != models.RedactedValue {
+		return proxyURL, nil
+	}
+	old, err := url.Parse(stored)
+	if err != nil || old.User == nil {
+		return "", fmt.Errorf("proxy url password is redacted but has no stored value")
+	}
+	password, ok := old.User.Password()
+	if !ok {
+		return "", fmt.Errorf("proxy url password is redacted but has no stored value")
+	}
+	u.User = url.UserPassword(u.User.Username(), password)
+	return u.String(), nil
+}
+
+func storedHeader(stored map[string]string, name string) (string, bool) {
+	if value, ok := stored[name]; ok {
+		return value, true
+	}
+	for k, value := range stored {
+		if strings.EqualFold(k, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// Check the endpoint's auth profile exists, writing a 400 if it doesn't
+func authProfileExists(w http.ResponseWriter, dbClient db.DBClient, ep models.MonitoredEndpoint) bool {
+	if ep.AuthProfileID == nil {
+		return true
+	}
+	if _, err := dbClient.GetAuthProfile(*ep.AuthProfileID); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "Invalid endpoint: auth profile not found", http.StatusBadRequest)
+		} else {
+			log.Printf("Database error while fetching auth profile: %v", err)
+			http.Error(w, "Internal server error while fetching auth profile", http.StatusInternalServerError)
+		}
+		return false
+	}
+	return true
+}
+
+func writeEndpointError(w http.ResponseWriter, action string, err error) {
+	if errors.Is(err, db.ErrNotFound) {
+		http.Error(w, "Endpoint not found", http.StatusNotFound)
+		return
+	}
+	log.Printf("Database error while %s endpoint: %v", action, err)
+	http.Error(w, "Internal server error while "+action+" endpoint", http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response to JSON: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// How often a comment is written to keep idle proxies from closing the stream
+var sseKeepAliveInterval = 15 * time.Second
+
+// Handler function to stream live metrics as Server-Sent Events. It takes the
+// same filter and backfill query parameters as the WebSocket feed and resumes
+// from the Last-Event-ID header when the browser reconnects.
+func StreamEvents(metricsHub *hub.Hub, dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received SSE connection from %s", r.RemoteAddr)
+		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Make this configurable
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		query := r.URL.Query()
+		now := time.Now()
+		cursor, err := hub.BackfillStart(query.Get("since"), query.Get("minutes"), now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+			if cursor, err = models.ParseMetricCursor(lastEventID); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if oldest := now.Add(-hub.MaxBackfill); cursor.Timestamp.Before(oldest) {
+				cursor = models.MetricCursor{Timestamp: oldest}
+			}
+		}
+		filter, err := hub.FilterFromQuery(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// The stream is only started once the first page of history has been
+		// read, so a database error can still be reported
+		started := false
+		beginStream := func() {
+			if started {
+				return
+			}
+			started = true
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+			fmt.Fprint(w, "retry: 3000\n\n")
+		}
+
+		// History is replayed a page at a time before subscribing, and
+		// anything also caught up after subscribing is skipped below
+		sub, replayed, err := metricsHub.Replay(dbClient, cursor, filter, func(metrics []models.Metric) error {
+			beginStream()
+			for _, m := range metrics {
+				if err := writeEvent(w, m); err != nil {
+					return err
+				}
+			}
+			flusher.Flush()
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error sending SSE backfill: %v", err)
+			if !started {
+				http.Error(w, "Internal server error while fetching metrics", http.StatusInternalServerError)
+			}
+			return
+		}
+		defer metricsHub.Unsubscribe(sub)
+		beginStream()
+		flusher.Flush()
+
+		ticker := time.NewTicker(sseKeepAliveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case metric, ok := <-sub.C:
+				if !ok {
+					log.Printf("Dropping slow SSE client %s", r.RemoteAddr)
+					return
+				}
+				if _, ok := replayed[metric.ID]; ok {
+					delete(replayed, metric.ID)
+					continue
+				}
+				if err := writeEvent(w, metric); err != nil {
+					log.Printf("Error writing SSE event: %v", err)
+					return
+				}
+				flusher.Flush()
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				log.Printf("SSE connection from %s closed", r.RemoteAddr)
+				return
+			}
+		}
+	}
+}
+
+// Write one metric as an event. The payload matches the WebSocket feed and the
+// event ID is the metric's cursor, which resumption replays from just after.
+func writeEvent(w http.ResponseWriter, m models.Metric) error {
+	data, err := json.Marshal([]models.Metric{m})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", m.Cursor(), data)
+	return err
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+type sseEvent struct {
+	id      string
+	data    string
+	comment string
+}
+
+// Read the next event or comment from an SSE stream
+func readEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if ev != (sseEvent{}) {
+				return ev
+			}
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		case strings.HasPrefix(line, ": "):
+			ev.comment = strings.TrimPrefix(line, ": ")
+		}
+	}
+}
+
+// Page of history after a cursor, as the database would return it. history
+// must be in cursor order.
+func pageAfter(history []models.Metric, cursor models.MetricCursor, filter hub.Filter, limit int) []models.Metric {
+	var page []models.Metric
+	for _, m := range history {
+		if len(page) == limit {
+			break
+		}
+		after := m.Timestamp.After(cursor.Timestamp) || m.Timestamp.Equal(cursor.Timestamp) && m.ID.String() > cursor.ID.String()
+		if after && filter.Matches(m) {
+			page = append(page, m)
+		}
+	}
+	return page
+}
+
+func openStream(t *testing.T, metricsHub *hub.Hub, mock db.DBClient, query string, header http.Header) *bufio.Reader {
+	t.Helper()
+
+	server := httptest.NewServer(StreamEvents(metricsHub, mock))
+	t.Cleanup(server.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events"+query, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+func TestStreamEventsReplaysThenStreamsLive(t *testing.T) {
+	endpointID := uuid.New()
+	ts := time.Now().Add(-time.Minute).UTC().Truncate(time.Second).Add(123 * time.Millisecond)
+	history := []models.Metric{
+		{ID: uuid.New(), EndpointID: endpointID, Timestamp: ts, StatusCode: 200},
+		{ID: uuid.New(), EndpointID: uuid.New(), Timestamp: ts, StatusCode: 200},
+	}
+	mock := &db.MockDBClient{
+		GetMetricsAfterFunc: func(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error) {
+			return pageAfter(history, cursor, filter, limit), nil
+		},
+	}
+
+	metricsHub := hub.New(4)
+	stream := openStream(t, metricsHub, mock, "?endpoint_id="+endpointID.String(), nil)
+
+	ev := readEvent(t, stream)
+	if ev.id != ts.Format(time.RFC3339Nano)+"/"+history[0].ID.String() {
+		t.Errorf("unexpected event id %q", ev.id)
+	}
+	var replayed []models.Metric
+	if err := json.Unmarshal([]byte(ev.data), &replayed); err != nil || len(replayed) != 1 || replayed[0].ID != history[0].ID {
+		t.Fatalf("unexpected replayed event %q", ev.data)
+	}
+
+	// Metrics already replayed or outside the filter are not sent again
+	metricsHub.Publish(history[0])
+	metricsHub.Publish(models.Metric{ID: uuid.New(), EndpointID: uuid.New()})
+	live := models.Metric{ID: uuid.New(), EndpointID: endpointID, Timestamp: ts.Add(time.Second)}
+	metricsHub.Publish(live)
+
+	ev = readEvent(t, stream)
+	var got []models.Metric
+	if err := json.Unmarshal([]byte(ev.data), &got); err != nil || len(got) != 1 || got[0].ID != live.ID {
+		t.Errorf("expected only the live metric, got %q", ev.data)
+	}
+}
+
+func TestStreamEventsResumesFromLastEventID(t *testing.T) {
+	var requested models.MetricCursor
+	mock := &db.MockDBClient{
+		GetMetricsAfterFunc: func(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error) {
+			if requested.Timestamp.IsZero() {
+				requested = cursor
+			}
+			return nil, nil
+		},
+	}
+
+	last := models.MetricCursor{Timestamp: time.Now().Add(-time.Minute).UTC().Truncate(time.Millisecond), ID: uuid.New()}
+	header := http.Header{"Last-Event-Id": {last.String()}}
+	openStream(t, hub.New(4), mock, "?minutes=60", header)
+
+	if !requested.Timestamp.Equal(last.Timestamp) || requested.ID != last.ID {
+		t.Errorf("expected backfill after %s, got %s", last, requested)
+	}
+}
+
+func TestStreamEventsSendsKeepAlive(t *testing.T) {
+	previous := sseKeepAliveInterval
+	sseKeepAliveInterval = 10 * time.Millisecond
+	t.Cleanup(func() { sseKeepAliveInterval = previous })
+
+	stream := openStream(t, hub.New(4), &db.MockDBClient{
+		GetMetricsAfterFunc: func(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error) {
+			return nil, nil
+		},
+	}, "", nil)
+
+	if ev := readEvent(t, stream); ev.comment != "keep-alive" {
+		t.Errorf("expected keep-alive comment, got %+v", ev)
+	}
+}
+
+func TestStreamEventsRejectsInvalidParameters(t *testing.T) {
+	handler := StreamEvents(hub.New(4), &db.MockDBClient{})
+
+	for _, query := range []string{"?since=yesterday", "?status_class=9xx"} {
+		req := httptest.NewRequest(http.MethodGet, "/events"+query, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", query, rr.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Last-Event-ID", "2025-01-01T12:00:00Z/not-a-uuid")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a malformed Last-Event-ID, got %d", rr.Code)
+	}
+}
+
+func TestStreamEventsReportsBackfillErrors(t *testing.T) {
+	handler := StreamEvents(hub.New(4), &db.MockDBClient{
+		GetMetricsAfterFunc: func(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error) {
+			return nil, errors.New("db failure")
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when history can't be read, got %d", rr.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
@@ -58,12 +59,18 @@ func GenerateTestData(dbClient db.DBClient) http.HandlerFunc {
 		// Generate random metrics for each endpoint
 		for _, ep := range endpoints {
 			for i := 0; i < 20; i++ {
+				statusCode := []int{200, 201, 400, 401, 500, 503}[rand.Intn(6)]
 				metric := models.Metric{
 					ID:         uuid.New(),
 					EndpointID: ep.ID,
 					Timestamp:  time.Now().Add(-24 * time.Hour).Add(time.Duration(i) * time.Hour), // Start at -24 hours and move forward
-					StatusCode: []int{200, 201, 400, 401, 500, 503}[rand.Intn(6)],
+					StatusCode: statusCode,
 					LatencyMS:  rand.Intn(1000),
+					Success:    ep.IsExpectedStatus(statusCode),
+				}
+				if !metric.Success {
+					metric.FailureReason = models.FailureUnexpectedStatus
+					metric.ErrorMessage = fmt.Sprintf("unexpected status code %d", statusCode)
 				}
 				if err := dbClient.StoreMetric(metric); err != nil {
 					http.Error(w, "Failed to store metric: "+err.Error(), http.StatusInternalServerError)
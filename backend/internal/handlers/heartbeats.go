@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Handler function recording a ping from a heartbeat monitor's job. Start
+// pings mark the job as running; success and fail pings are stored as
+// metrics alongside polled checks. The request body, if any, is kept as the
+// ping's log.
+func ReceivePing(dbClient db.DBClient, scheduler EndpointScheduler, metricsHub *hub.Hub, kind models.PingKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Make this configurable
+
+		ep, err := dbClient.GetEndpointByPingToken(r.PathValue("token"))
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				http.Error(w, "Unknown ping token", http.StatusNotFound)
+				return
+			}
+			log.Printf("Database error while fetching heartbeat monitor: %v", err)
+			http.Error(w, "Internal server error while fetching heartbeat monitor", http.StatusInternalServerError)
+			return
+		}
+
+		payload, err := io.ReadAll(io.LimitReader(r.Body, models.MaxPingLog))
+		if err != nil {
+			http.Error(w, "Error reading ping body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Jobs don't know their monitor is paused, so their pings are
+		// accepted and dropped rather than failing the job
+		if ep.Paused {
+			w.Write([]byte("OK\n"))
+			return
+		}
+
+		now := time.Now().Truncate(time.Millisecond) // Match the precision stored in the DB
+		state := models.PingState{LastPingAt: &now}
+		if kind == models.PingStart {
+			state.RunningSince = &now
+			state.StartLog = string(payload)
+		} else {
+			metric := pingMetric(ep, kind, string(payload), now)
+			if err := dbClient.StoreMetric(metric); err != nil {
+				log.Printf("Database error while storing ping for %s: %v", ep.ID, err)
+				http.Error(w, "Internal server error while storing ping", http.StatusInternalServerError)
+				return
+			}
+			metricsHub.Publish(metric)
+		}
+
+		if err := dbClient.SetPingState(ep.ID, state); err != nil {
+			log.Printf("Database error while storing ping for %s: %v", ep.ID, err)
+			http.Error(w, "Internal server error while storing ping", http.StatusInternalServerError)
+			return
+		}
+		// Restart the monitor's wait for its next ping
+		ep.PingState = state
+		scheduler.Update(ep)
+
+		log.Printf("Received %s ping for heartbeat monitor %s", kind, ep.ID)
+		w.Write([]byte("OK\n"))
+	}
+}
+
+// Metric for a success or fail ping. Its latency is how long the job ran
+// when it sent a start ping first.
+func pingMetric(ep models.MonitoredEndpoint, kind models.PingKind, payload string, now time.Time) models.Metric {
+	metric := models.Metric{
+		ID:         uuid.New(),
+		EndpointID: ep.ID,
+		Timestamp:  now,
+		URL:        ep.URL,
+		Success:    kind == models.PingSuccess,
+		Attempts:   1,
+		Ping:       kind,
+		PingLog:    payload,
+	}
+	if ep.RunningSince != nil {
+		metric.LatencyMS = int(now.Sub(*ep.RunningSince).Milliseconds())
+		if ep.StartLog != "" {
+			metric.PingLog = ep.StartLog
+			if payload != "" {
+				metric.PingLog += "\n" + payload
+			}
+		}
+	}
+	if kind == models.PingFail {
+		metric.FailureReason = models.FailureJobFailed
+		metric.ErrorMessage = "job reported a failure"
+	}
+	return metric
+}
+
+// Give a heartbeat monitor its ping token and URL, keeping those of the
+// monitor it replaces. Ping state can only be changed by pinging, so any
+// sent with the endpoint is dropped.
+func preparePings(ep *models.MonitoredEndpoint, existing models.MonitoredEndpoint) error {
+	ep.PingToken = ""
+	ep.PingState = models.PingState{}
+	if ep.Kind() != models.CheckHeartbeat {
+		return nil
+	}
+
+	if existing.Kind() == models.CheckHeartbeat && existing.PingToken != "" {
+		ep.PingToken = existing.PingToken
+		ep.PingState = existing.PingState
+	} else {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		ep.PingToken = hex.EncodeToString(b)
+	}
+	ep.URL = ep.PingPath()
+	return nil
+}
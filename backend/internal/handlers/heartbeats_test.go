@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestReceivePing(t *testing.T) {
+	monitor := models.MonitoredEndpoint{ID: uuid.New(), Type: models.CheckHeartbeat, URL: "/ping/abc123", Frequency: time.Hour, PingToken: "abc123"}
+	var metrics []models.Metric
+	mock := &db.MockDBClient{
+		GetEndpointByPingTokenFunc: func(token string) (models.MonitoredEndpoint, error) {
+			if token != monitor.PingToken {
+				return models.MonitoredEndpoint{}, db.ErrNotFound
+			}
+			return monitor, nil
+		},
+		SetPingStateFunc: func(id uuid.UUID, state models.PingState) error {
+			monitor.PingState = state
+			return nil
+		},
+		StoreMetricFunc: func(m models.Metric) error {
+			metrics = append(metrics, m)
+			return nil
+		},
+	}
+	scheduler := &fakeScheduler{}
+	metricsHub := hub.New(hub.DefaultBufferSize)
+
+	ping := func(path string, kind models.PingKind, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		return serveEndpoint("/ping/{token}"+strings.TrimPrefix(path, "/ping/abc123"), ReceivePing(mock, scheduler, metricsHub, kind), req)
+	}
+
+	// A start ping marks the job as running without storing a metric
+	if rr := ping("/ping/abc123/start", models.PingStart, "starting backup"); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if monitor.RunningSince == nil || monitor.StartLog != "starting backup" || len(metrics) != 0 {
+		t.Fatalf("expected the job to be running, got %+v and %d metrics", monitor.PingState, len(metrics))
+	}
+
+	// Finishing stores a metric with both logs and clears the running state
+	if rr := ping("/ping/abc123/fail", models.PingFail, "disk full"); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(metrics) != 1 || metrics[0].Success || metrics[0].FailureReason != models.FailureJobFailed || metrics[0].PingLog != "starting backup\ndisk full" {
+		t.Fatalf("expected a failed job metric, got %+v", metrics)
+	}
+	if monitor.RunningSince != nil || monitor.LastPingAt == nil {
+		t.Errorf("expected the job to have finished, got %+v", monitor.PingState)
+	}
+
+	if rr := ping("/ping/abc123", models.PingSuccess, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(metrics) != 2 || !metrics[1].Success || metrics[1].Ping != models.PingSuccess || metrics[1].URL != monitor.URL {
+		t.Errorf("expected a successful ping metric, got %+v", metrics)
+	}
+	if len(scheduler.updated) != 3 {
+		t.Errorf("expected each ping to restart the monitor's wait, got %d updates", len(scheduler.updated))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ping/unknown", nil)
+	if rr := serveEndpoint("/ping/{token}", ReceivePing(mock, scheduler, metricsHub, models.PingSuccess), req); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an unknown token, got %d", rr.Code)
+	}
+
+	// Paused monitors accept pings without recording them
+	monitor.Paused = true
+	if rr := ping("/ping/abc123", models.PingSuccess, ""); rr.Code != http.StatusOK || len(metrics) != 2 {
+		t.Errorf("expected a paused monitor's ping to be dropped, got status %d and %d metrics", rr.Code, len(metrics))
+	}
+}
+
+func TestUpdateHeartbeatKeepsPingURL(t *testing.T) {
+	id := uuid.New()
+	lastPing := time.Now().Add(-time.Minute)
+	existing := models.MonitoredEndpoint{
+		ID: id, Type: models.CheckHeartbeat, URL: "/ping/abc123", Frequency: time.Hour, PingToken: "abc123",
+		PingState: models.PingState{LastPingAt: &lastPing},
+	}
+	var stored models.MonitoredEndpoint
+	mock := &db.MockDBClient{
+		GetEndpointFunc: func(uuid.UUID) (models.MonitoredEndpoint, error) { return existing, nil },
+		UpdateEndpointFunc: func(ep models.MonitoredEndpoint) error {
+			stored = ep
+			return nil
+		},
+	}
+
+	body := `{"type":"heartbeat","frequency_seconds":86400,"ping_token":"chosen","last_ping_at":"2020-01-01T00:00:00Z"}`
+	req := httptest.NewRequest(http.MethodPut, "/endpoints/"+id.String(), strings.NewReader(body))
+	rr := serveEndpoint("PUT /endpoints/{id}", UpdateEndpoint(mock, &fakeScheduler{}), req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if stored.PingToken != "abc123" || stored.URL != "/ping/abc123" || stored.LastPingAt == nil || !stored.LastPingAt.Equal(lastPing) {
+		t.Errorf("expected the ping token and state to be kept, got %+v", stored)
+	}
+	if stored.Frequency != 24*time.Hour {
+		t.Errorf("expected the new period to be stored, got %s", stored.Frequency)
+	}
+}
@@ -18,8 +18,19 @@ func GetLatencyMetrics(dbClient db.DBClient) http.HandlerFunc {
 		startDateStr := r.URL.Query().Get("startDate")
 		endDateStr := r.URL.Query().Get("endDate")
 
+		failureReason, err := failureReasonParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		excludeRetried, err := excludeRetriedParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Fetch the latest metrics from the database
-		metrics, err := dbClient.GetAllMetrics(startDateStr, endDateStr)
+		metrics, err := dbClient.GetAllMetrics(startDateStr, endDateStr, failureReason, excludeRetried)
 		if err != nil {
 			log.Printf("Database error while fetching metrics: %v", err)
 			http.Error(w, "Internal server error while fetching metrics", http.StatusInternalServerError)
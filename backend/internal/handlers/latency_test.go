@@ -59,7 +59,7 @@ func TestGetLatencyMetrics(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &db.MockDBClient{
-				GetAllMetricsFunc: func(start, end string) ([]models.Metric, error) {
+				GetAllMetricsFunc: func(start, end string, failureReason *models.FailureReason, excludeRetried bool) ([]models.Metric, error) {
 					return tt.mockReturn, tt.mockError
 				},
 			}
@@ -88,3 +88,44 @@ func TestGetLatencyMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestGetLatencyMetricsFailureReasonFilter(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode int
+		expected     *models.FailureReason
+	}{
+		{name: "no filter", query: "", expectedCode: http.StatusOK},
+		{name: "filters by reason", query: "&failureReason=timeout", expectedCode: http.StatusOK, expected: ptr(models.FailureTimeout)},
+		{name: "none selects successes", query: "&failureReason=none", expectedCode: http.StatusOK, expected: ptr(models.FailureNone)},
+		{name: "rejects unknown reasons", query: "&failureReason=gremlins", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *models.FailureReason
+			mock := &db.MockDBClient{
+				GetAllMetricsFunc: func(start, end string, failureReason *models.FailureReason, excludeRetried bool) ([]models.Metric, error) {
+					got = failureReason
+					return nil, nil
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/getlatency?startDate=2025-01-01T00:00:00Z&endDate=2025-12-31T23:59:59Z"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			GetLatencyMetrics(mock).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+			if (got == nil) != (tt.expected == nil) || (got != nil && *got != *tt.expected) {
+				t.Errorf("expected filter %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+)
+
+// Handler function to get the per-phase latency breakdown for stacked charts
+func GetLatencyBreakdown(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for latency breakdown from %s", r.RemoteAddr)
+		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Make this configurable
+		w.Header().Set("Content-Type", "application/json")
+
+		start, end, err := dateRangeParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		excludeRetried, err := excludeRetriedParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Fetch the phase timings from the database, averaged per bucket
+		breakdown, err := dbClient.GetLatencyBreakdownByURL(start, end, excludeRetried)
+		if err != nil {
+			log.Printf("Database error while fetching latency breakdown: %v", err)
+			http.Error(w, "Internal server error while fetching metrics", http.StatusInternalServerError)
+			return
+		}
+
+		// If no metrics, return an empty object with 200 OK
+		if len(breakdown) == 0 {
+			log.Println("No latency breakdown metrics found in the database")
+			w.WriteHeader(http.StatusOK)
+			if _, err := w.Write([]byte("{}")); err != nil {
+				log.Printf("Error writing empty response: %v", err)
+			}
+			return
+		}
+
+		// Convert metrics to JSON and send response
+		if err := json.NewEncoder(w).Encode(breakdown); err != nil {
+			log.Printf("Error encoding latency breakdown to JSON: %v", err)
+			http.Error(w, "Internal server error while encoding metrics", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+func TestGetLatencyBreakdown(t *testing.T) {
+	tests := []struct {
+		name              string
+		mockReturn        map[string][]models.LatencyBreakdown
+		mockError         error
+		expectedCode      int
+		expectedBodyCheck func(string) bool
+	}{
+		{
+			name: "returns latency breakdown successfully",
+			mockReturn: map[string][]models.LatencyBreakdown{
+				"https://example.com": {
+					{
+						Timestamp:    time.Now(),
+						PhaseTimings: models.PhaseTimings{DNSMS: 3, ConnectMS: 10, TLSMS: 25, TTFBMS: 80, TransferMS: 4},
+					},
+				},
+			},
+			expectedCode: http.StatusOK,
+			expectedBodyCheck: func(body string) bool {
+				return len(body) > 0 && body != "{}"
+			},
+		},
+		{
+			name:         "returns empty object when no data",
+			mockReturn:   map[string][]models.LatencyBreakdown{},
+			expectedCode: http.StatusOK,
+			expectedBodyCheck: func(body string) bool {
+				return body == "{}"
+			},
+		},
+		{
+			name:         "returns 500 on DB error",
+			mockError:    errors.New("db failure"),
+			expectedCode: http.StatusInternalServerError,
+			expectedBodyCheck: func(body string) bool {
+				return body != ""
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &db.MockDBClient{
+				GetLatencyBreakdownByURLFunc: func(start, end time.Time, excludeRetried bool) (map[string][]models.LatencyBreakdown, error) {
+					return tt.mockReturn, tt.mockError
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/latencybreakdown?startDate=2025-01-01T00:00:00Z&endDate=2025-12-31T23:59:59Z", nil)
+			rr := httptest.NewRecorder()
+
+			handler := GetLatencyBreakdown(mock)
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Errorf("expected status %d, got %d", tt.expectedCode, rr.Code)
+			}
+
+			body := rr.Body.String()
+			if !tt.expectedBodyCheck(body) {
+				t.Errorf("unexpected response body: %s", body)
+			}
+
+			if tt.expectedCode == http.StatusOK && len(tt.mockReturn) > 0 {
+				var decoded map[string][]map[string]any
+				if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+					t.Fatalf("error decoding JSON: %v", err)
+				}
+				point := decoded["https://example.com"][0]
+				for _, field := range []string{"dns_ms", "connect_ms", "tls_ms", "ttfb_ms", "transfer_ms"} {
+					if _, ok := point[field]; !ok {
+						t.Errorf("expected %s in response", field)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGetLatencyBreakdownExcludeRetried(t *testing.T) {
+	tests := []struct {
+		query        string
+		expectedCode int
+		expected     bool
+	}{
+		{query: "", expectedCode: http.StatusOK, expected: false},
+		{query: "&excludeRetried=true", expectedCode: http.StatusOK, expected: true},
+		{query: "&excludeRetried=maybe", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		var got bool
+		mock := &db.MockDBClient{
+			GetLatencyBreakdownByURLFunc: func(start, end time.Time, excludeRetried bool) (map[string][]models.LatencyBreakdown, error) {
+				got = excludeRetried
+				return nil, nil
+			},
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/latencybreakdown?startDate=2025-01-01T00:00:00Z&endDate=2025-12-31T23:59:59Z"+tt.query, nil)
+		rr := httptest.NewRecorder()
+		GetLatencyBreakdown(mock).ServeHTTP(rr, req)
+
+		if rr.Code != tt.expectedCode {
+			t.Fatalf("%q: expected status %d, got %d", tt.query, tt.expectedCode, rr.Code)
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected excludeRetried=%v, got %v", tt.query, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Handler function to get latency percentiles, min, max, mean and sample
+// count per endpoint for each bucket of an interval over a date range. The
+// interval defaults to the resolution chosen for the range.
+func GetLatencyPercentiles(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for latency percentiles from %s", r.RemoteAddr)
+		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Make this configurable
+		w.Header().Set("Content-Type", "application/json")
+
+		start, end, err := dateRangeParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := r.URL.Query().Get("interval")
+		if name == "" {
+			name = string(models.ChooseResolution(start, end))
+		}
+		interval, err := models.ParseLatencyInterval(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if end.Sub(start)/interval >= models.MaxLatencyBuckets {
+			http.Error(w, fmt.Sprintf("the range covers more than %d buckets, use a longer interval", models.MaxLatencyBuckets), http.StatusBadRequest)
+			return
+		}
+
+		endpoints, err := dbClient.GetLatencyPercentiles(interval, start, end)
+		if err != nil {
+			log.Printf("Database error while fetching latency percentiles: %v", err)
+			http.Error(w, "Internal server error while fetching metrics", http.StatusInternalServerError)
+			return
+		}
+
+		result := models.LatencyPercentiles{Interval: name, Endpoints: endpoints}
+		if result.Endpoints == nil {
+			result.Endpoints = []models.EndpointLatency{}
+		}
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Printf("Error encoding latency percentiles to JSON: %v", err)
+			http.Error(w, "Internal server error while encoding metrics", http.StatusInternalServerError)
+		}
+	}
+}
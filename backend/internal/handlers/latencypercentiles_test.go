@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestGetLatencyPercentiles(t *testing.T) {
+	bucket := models.LatencyBucket{
+		BucketStart: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Count:       300, SuccessCount: 299, MinLatencyMS: 40, MaxLatencyMS: 2100, AvgLatencyMS: 95.5,
+		P50MS: 80, P90MS: 150, P95MS: 210, P99MS: 1800,
+	}
+	endpointID := uuid.New()
+
+	tests := []struct {
+		name             string
+		query            string
+		mockReturn       []models.EndpointLatency
+		mockError        error
+		expectedCode     int
+		expectedInterval time.Duration
+		expectedName     string
+	}{
+		{
+			name:             "uses the interval asked for",
+			query:            "startDate=2025-01-01T00:00:00Z&endDate=2025-01-02T00:00:00Z&interval=5m",
+			mockReturn:       []models.EndpointLatency{{EndpointID: endpointID, URL: "https://example.com", Buckets: []models.LatencyBucket{bucket}}},
+			expectedCode:     http.StatusOK,
+			expectedInterval: 5 * time.Minute,
+			expectedName:     "5m",
+		},
+		{
+			name:             "defaults to the resolution for the range",
+			query:            "startDate=2025-01-01T00:00:00Z&endDate=2025-04-01T00:00:00Z",
+			expectedCode:     http.StatusOK,
+			expectedInterval: 24 * time.Hour,
+			expectedName:     "1d",
+		},
+		{
+			name:         "rejects an unknown interval",
+			query:        "startDate=2025-01-01T00:00:00Z&endDate=2025-01-02T00:00:00Z&interval=10m",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "rejects too many buckets",
+			query:        "startDate=2024-01-01T00:00:00Z&endDate=2025-01-01T00:00:00Z&interval=1m",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "rejects an invalid date",
+			query:        "startDate=yesterday&endDate=2025-01-02T00:00:00Z",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "returns 500 on DB error",
+			query:        "startDate=2025-01-01T00:00:00Z&endDate=2025-01-02T00:00:00Z&interval=1h",
+			mockError:    errors.New("db failure"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotInterval time.Duration
+			mock := &db.MockDBClient{
+				GetLatencyPercentilesFunc: func(interval time.Duration, start, end time.Time) ([]models.EndpointLatency, error) {
+					gotInterval = interval
+					return tt.mockReturn, tt.mockError
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/latencypercentiles?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			GetLatencyPercentiles(mock).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+			}
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+			if gotInterval != tt.expectedInterval {
+				t.Errorf("expected interval %v, got %v", tt.expectedInterval, gotInterval)
+			}
+
+			var decoded map[string]any
+			if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+				t.Fatalf("error decoding JSON: %v", err)
+			}
+			if decoded["interval"] != tt.expectedName {
+				t.Errorf("expected interval %q, got %v", tt.expectedName, decoded["interval"])
+			}
+			endpoints, ok := decoded["endpoints"].([]any)
+			if !ok || len(endpoints) != len(tt.mockReturn) {
+				t.Fatalf("unexpected endpoints %v", decoded["endpoints"])
+			}
+			if len(tt.mockReturn) > 0 {
+				endpoint := endpoints[0].(map[string]any)
+				if endpoint["endpoint_id"] != endpointID.String() || endpoint["url"] != "https://example.com" {
+					t.Errorf("expected the endpoint ID and URL, got %v", endpoint)
+				}
+				point := endpoint["buckets"].([]any)[0].(map[string]any)
+				for _, field := range []string{"count", "min_latency_ms", "max_latency_ms", "avg_latency_ms", "p50_ms", "p90_ms", "p95_ms", "p99_ms"} {
+					if _, ok := point[field]; !ok {
+						t.Errorf("expected %s in response", field)
+					}
+				}
+			}
+		})
+	}
+}
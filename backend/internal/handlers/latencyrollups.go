@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Handler function to get latency rollups for charts over long ranges. The
+// resolution is the finest that keeps the range to a chart's worth of
+// buckets unless one is asked for.
+func GetLatencyRollups(dbClient db.DBClient) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for latency rollups from %s", r.RemoteAddr)
+		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Make this configurable
+		w.Header().Set("Content-Type", "application/json")
+
+		start, end, err := dateRangeParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resolution, err := resolutionParam(r, start, end)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rollups, err := dbClient.GetRollups(resolution, start, end)
+		if err != nil {
+			log.Printf("Database error while fetching latency rollups: %v", err)
+			http.Error(w, "Internal server error while fetching metrics", http.StatusInternalServerError)
+			return
+		}
+
+		result := models.LatencyRollups{Resolution: resolution, Endpoints: make(map[string][]models.LatencyBucket)}
+		for _, rollup := range rollups {
+			result.Endpoints[rollup.URL] = append(result.Endpoints[rollup.URL], rollup.Summary())
+		}
+
+		if err := json.NewEncoder(w).Encode(result); err != nil {
+			log.Printf("Error encoding latency rollups to JSON: %v", err)
+			http.Error(w, "Internal server error while encoding metrics", http.StatusInternalServerError)
+		}
+	}
+}
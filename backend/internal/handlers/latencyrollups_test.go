@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+func TestGetLatencyRollups(t *testing.T) {
+	bucketStart := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	rollup := models.Rollup{URL: "https://example.com", BucketStart: bucketStart}
+	for _, latency := range []int{100, 200, 300} {
+		rollup.Add(models.Metric{LatencyMS: latency, Success: true})
+	}
+
+	tests := []struct {
+		name               string
+		query              string
+		mockReturn         []models.Rollup
+		mockError          error
+		expectedCode       int
+		expectedResolution models.Resolution
+	}{
+		{
+			name:               "picks minutes for a day",
+			query:              "startDate=2025-01-01T00:00:00Z&endDate=2025-01-02T00:00:00Z",
+			mockReturn:         []models.Rollup{rollup},
+			expectedCode:       http.StatusOK,
+			expectedResolution: models.ResolutionMinute,
+		},
+		{
+			name:               "picks days for 90 days",
+			query:              "startDate=2025-01-01T00:00:00Z&endDate=2025-04-01T00:00:00Z",
+			expectedCode:       http.StatusOK,
+			expectedResolution: models.ResolutionDay,
+		},
+		{
+			name:               "uses the resolution asked for",
+			query:              "startDate=2025-01-01T00:00:00Z&endDate=2025-04-01T00:00:00Z&resolution=1h",
+			expectedCode:       http.StatusOK,
+			expectedResolution: models.ResolutionHour,
+		},
+		{
+			name:         "rejects an unknown resolution",
+			query:        "startDate=2025-01-01T00:00:00Z&endDate=2025-01-02T00:00:00Z&resolution=5s",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "rejects a missing date",
+			query:        "startDate=2025-01-01T00:00:00Z",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "rejects a reversed range",
+			query:        "startDate=2025-01-02T00:00:00Z&endDate=2025-01-01T00:00:00Z",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "returns 500 on DB error",
+			query:        "startDate=2025-01-01T00:00:00Z&endDate=2025-01-02T00:00:00Z",
+			mockError:    errors.New("db failure"),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotResolution models.Resolution
+			mock := &db.MockDBClient{
+				GetRollupsFunc: func(resolution models.Resolution, start, end time.Time) ([]models.Rollup, error) {
+					gotResolution = resolution
+					return tt.mockReturn, tt.mockError
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/latencyrollups?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			GetLatencyRollups(mock).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedCode, rr.Code, rr.Body.String())
+			}
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+			if gotResolution != tt.expectedResolution {
+				t.Errorf("expected resolution %s, got %s", tt.expectedResolution, gotResolution)
+			}
+
+			var decoded models.LatencyRollups
+			if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+				t.Fatalf("error decoding JSON: %v", err)
+			}
+			if decoded.Resolution != tt.expectedResolution || len(decoded.Endpoints) != len(tt.mockReturn) {
+				t.Errorf("unexpected response %+v", decoded)
+			}
+			if len(tt.mockReturn) > 0 {
+				buckets := decoded.Endpoints["https://example.com"]
+				if len(buckets) != 1 || buckets[0].Count != 3 || buckets[0].AvgLatencyMS != 200 || buckets[0].P99MS < 290 {
+					t.Errorf("unexpected buckets %+v", buckets)
+				}
+			}
+		})
+	}
+}
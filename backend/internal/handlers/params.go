@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Read the optional failureReason query parameter. Returns nil when it isn't set.
+func failureReasonParam(r *http.Request) (*models.FailureReason, error) {
+	raw := r.URL.Query().Get("failureReason")
+	if raw == "" {
+		return nil, nil
+	}
+
+	reason, err := models.ParseFailureReason(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &reason, nil
+}
+
+// Read the optional excludeRetried query parameter, false when it isn't set
+func excludeRetriedParam(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get("excludeRetried")
+	if raw == "" {
+		return false, nil
+	}
+
+	exclude, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("excludeRetried must be true or false")
+	}
+	return exclude, nil
+}
+
+// Read the startDate and endDate query parameters as RFC 3339 times
+func dateRangeParams(r *http.Request) (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, r.URL.Query().Get("startDate"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("startDate must be an RFC 3339 time")
+	}
+	end, err := time.Parse(time.RFC3339, r.URL.Query().Get("endDate"))
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("endDate must be an RFC 3339 time")
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("endDate must not be before startDate")
+	}
+	return start, end, nil
+}
+
+// Read the optional resolution query parameter, choosing one to suit the
+// date range when it isn't set
+func resolutionParam(r *http.Request, start, end time.Time) (models.Resolution, error) {
+	raw := r.URL.Query().Get("resolution")
+	if raw == "" {
+		return models.ChooseResolution(start, end), nil
+	}
+	return models.ParseResolution(raw)
+}
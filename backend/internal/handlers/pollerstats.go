@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Anything that can report the poller's concurrency stats
+type PollerStatsSource interface {
+	Stats() models.PollerStats
+}
+
+// Handler function to report poller concurrency, including how many checks
+// were delayed because every slot was busy
+func GetPollerStats(source PollerStatsSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for poller stats from %s", r.RemoteAddr)
+		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Make this configurable
+		w.Header().Set("Content-Type", "application/json")
+
+		writeJSON(w, http.StatusOK, source.Stats())
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Anything that can report how pruning expired data is going
+type PrunerStatusSource interface {
+	Status() models.PruneStatus
+}
+
+// Handler function to report the default retention policy and the progress
+// of the current or last prune
+func GetPrunerStatus(source PrunerStatusSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for pruner status from %s", r.RemoteAddr)
+		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Make this configurable
+		w.Header().Set("Content-Type", "application/json")
+
+		writeJSON(w, http.StatusOK, source.Status())
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+type fixedPrunerStatus models.PruneStatus
+
+func (s fixedPrunerStatus) Status() models.PruneStatus {
+	return models.PruneStatus(s)
+}
+
+func TestGetPrunerStatus(t *testing.T) {
+	started := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	source := fixedPrunerStatus{
+		Defaults:  models.DefaultRetention,
+		Running:   true,
+		Phase:     "raw",
+		StartedAt: &started,
+		Deleted:   models.PruneCounts{Raw: 1500},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/pruner/status", nil)
+	rr := httptest.NewRecorder()
+	GetPrunerStatus(source).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var decoded models.PruneStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("error decoding JSON: %v", err)
+	}
+	if !decoded.Running || decoded.Phase != "raw" || decoded.Deleted.Raw != 1500 || decoded.Defaults != models.DefaultRetention {
+		t.Errorf("unexpected status %+v", decoded)
+	}
+}
@@ -15,13 +15,35 @@ func GetStatusCodeDistribution(dbClient db.DBClient) http.HandlerFunc {
 		w.Header().Set("Access-Control-Allow-Origin", "*") // TODO: Make this configurable
 		w.Header().Set("Content-Type", "application/json")
 
-		startDateStr := r.URL.Query().Get("startDate")
-		endDateStr := r.URL.Query().Get("endDate")
+		start, end, err := dateRangeParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		log.Printf("Start date: %s, End date: %s", startDateStr, endDateStr)
+		log.Printf("Start date: %s, End date: %s", start, end)
 
-		// Fetch the latest metrics from the database
-		metrics, err := dbClient.GetStatusCodeDistributionByURL(startDateStr, endDateStr)
+		failureReason, err := failureReasonParam(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Fetch the metrics from the database, counted by status code or by
+		// failure reason. Long ranges are counted from rollups.
+		var metrics any
+		var count int
+		switch r.URL.Query().Get("groupBy") {
+		case "", "status_code":
+			byStatus, queryErr := dbClient.GetStatusCodeDistributionByURL(start, end, failureReason)
+			metrics, count, err = byStatus, len(byStatus), queryErr
+		case "failure_reason":
+			byReason, queryErr := dbClient.GetFailureReasonDistributionByURL(start, end, failureReason)
+			metrics, count, err = byReason, len(byReason), queryErr
+		default:
+			http.Error(w, "groupBy must be status_code or failure_reason", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			log.Printf("Database error while fetching status code distribution: %v", err)
 			http.Error(w, "Internal server error while fetching metrics", http.StatusInternalServerError)
@@ -29,7 +51,7 @@ func GetStatusCodeDistribution(dbClient db.DBClient) http.HandlerFunc {
 		}
 
 		// If no metrics, return an empty array with 200 OK
-		if len(metrics) == 0 {
+		if count == 0 {
 			log.Println("No status code distribution metrics found in the database")
 			w.WriteHeader(http.StatusOK)
 			if _, err := w.Write([]byte("[]")); err != nil {
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/AdamGriffiths31/pulseboard/internal/db"
 	"github.com/AdamGriffiths31/pulseboard/internal/models"
@@ -53,7 +54,7 @@ func TestGetStatusCodeDistribution(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			mock := &db.MockDBClient{
-				GetStatusCodeDistributionByURLFunc: func(start, end string) (map[string][]models.StatusCodeCount, error) {
+				GetStatusCodeDistributionByURLFunc: func(start, end time.Time, failureReason *models.FailureReason) (map[string][]models.StatusCodeCount, error) {
 					return tt.mockReturn, tt.mockError
 				},
 			}
@@ -82,3 +83,59 @@ func TestGetStatusCodeDistribution(t *testing.T) {
 		})
 	}
 }
+
+func TestGetStatusCodeDistributionGroupedByFailureReason(t *testing.T) {
+	var gotReason *models.FailureReason
+	mock := &db.MockDBClient{
+		GetFailureReasonDistributionByURLFunc: func(start, end time.Time, failureReason *models.FailureReason) (map[string][]models.FailureReasonCount, error) {
+			gotReason = failureReason
+			return map[string][]models.FailureReasonCount{
+				"https://example.com": {
+					{URL: "https://example.com", FailureReason: models.FailureTimeout, Count: 3},
+					{URL: "https://example.com", FailureReason: models.FailureDNS, Count: 1},
+				},
+			}, nil
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/statuscodedistribution?startDate=2025-01-01T00:00:00Z&endDate=2025-12-31T23:59:59Z&groupBy=failure_reason", nil)
+	rr := httptest.NewRecorder()
+	GetStatusCodeDistribution(mock).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var decoded map[string][]models.FailureReasonCount
+	if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("error decoding JSON: %v", err)
+	}
+	if len(decoded["https://example.com"]) != 2 || decoded["https://example.com"][0].FailureReason != models.FailureTimeout {
+		t.Errorf("unexpected response: %+v", decoded)
+	}
+	if gotReason != nil {
+		t.Errorf("expected no failure reason filter, got %v", *gotReason)
+	}
+
+	// The failure reason filter applies when grouping by reason too
+	req = httptest.NewRequest(http.MethodGet, "/statuscodedistribution?startDate=2025-01-01T00:00:00Z&endDate=2025-12-31T23:59:59Z&groupBy=failure_reason&failureReason=timeout", nil)
+	GetStatusCodeDistribution(mock).ServeHTTP(httptest.NewRecorder(), req)
+	if gotReason == nil || *gotReason != models.FailureTimeout {
+		t.Errorf("expected the timeout filter to be passed on, got %v", gotReason)
+	}
+}
+
+func TestGetStatusCodeDistributionRejectsInvalidParameters(t *testing.T) {
+	handler := GetStatusCodeDistribution(&db.MockDBClient{})
+
+	dates := "?startDate=2025-01-01T00:00:00Z&endDate=2025-12-31T23:59:59Z"
+	for _, query := range []string{dates + "&groupBy=colour", dates + "&failureReason=gremlins", "?startDate=yesterday", ""} {
+		req := httptest.NewRequest(http.MethodGet, "/statuscodedistribution"+query, nil)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %d", query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package hub
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Filter narrows the metrics a subscriber receives. Endpoint IDs and URL
+// patterns both select endpoints, so a metric matches if it hits either list.
+// Every other populated field must also match. An empty filter matches all.
+type Filter struct {
+	EndpointIDs   []uuid.UUID `json:"endpoint_ids,omitempty"`
+	URLPatterns   []string    `json:"url_patterns,omitempty"`
+	StatusClasses []string    `json:"status_classes,omitempty"`
+	MinLatencyMS  int         `json:"min_latency_ms,omitempty"`
+
+	patterns []*regexp.Regexp
+	classes  map[int]bool
+}
+
+// Check the filter is well formed and prepare it for matching
+func (f *Filter) Compile() error {
+	if f.MinLatencyMS < 0 {
+		return fmt.Errorf("min_latency_ms must not be negative")
+	}
+
+	f.patterns = nil
+	for _, p := range f.URLPatterns {
+		re, err := globToRegexp(p)
+		if err != nil {
+			return fmt.Errorf("invalid url pattern %q: %w", p, err)
+		}
+		f.patterns = append(f.patterns, re)
+	}
+
+	f.classes = make(map[int]bool)
+	for _, c := range f.StatusClasses {
+		class, err := parseStatusClass(c)
+		if err != nil {
+			return err
+		}
+		f.classes[class] = true
+	}
+
+	return nil
+}
+
+// Report whether a metric passes the filter. Compile must have been called.
+func (f *Filter) Matches(m models.Metric) bool {
+	if len(f.EndpointIDs) > 0 || len(f.patterns) > 0 {
+		if !f.matchesEndpoint(m) {
+			return false
+		}
+	}
+
+	if len(f.classes) > 0 && !f.classes[m.StatusCode/100] {
+		return false
+	}
+
+	return m.LatencyMS >= f.MinLatencyMS
+}
+
+// Leading digits of the status classes the filter allows, in order. Compile
+// must have been called.
+func (f *Filter) Classes() []int {
+	classes := make([]int, 0, len(f.classes))
+	for class := range f.classes {
+		classes = append(classes, class)
+	}
+	slices.Sort(classes)
+	return classes
+}
+
+// Return a new filter with the criteria from other added to f
+func (f Filter) Merge(other Filter) Filter {
+	merged := Filter{
+		EndpointIDs:   appendUnique(f.EndpointIDs, other.EndpointIDs),
+		URLPatterns:   appendUnique(f.URLPatterns, other.URLPatterns),
+		StatusClasses: appendUnique(f.StatusClasses, normaliseClasses(other.StatusClasses)),
+		MinLatencyMS:  f.MinLatencyMS,
+	}
+	if other.MinLatencyMS > 0 {
+		merged.MinLatencyMS = other.MinLatencyMS
+	}
+	return merged
+}
+
+// Return a new filter with the criteria from other removed from f. Removing an
+// empty filter clears everything.
+func (f Filter) Without(other Filter) Filter {
+	if other.IsEmpty() {
+		return Filter{}
+	}
+
+	result := Filter{
+		EndpointIDs:   removeAll(f.EndpointIDs, other.EndpointIDs),
+		URLPatterns:   removeAll(f.URLPatterns, other.URLPatterns),
+		StatusClasses: removeAll(f.StatusClasses, normaliseClasses(other.StatusClasses)),
+		MinLatencyMS:  f.MinLatencyMS,
+	}
+	if other.MinLatencyMS > 0 {
+		result.MinLatencyMS = 0
+	}
+	return result
+}
+
+func (f Filter) IsEmpty() bool {
+	return len(f.EndpointIDs) == 0 && len(f.URLPatterns) == 0 &&
+		len(f.StatusClasses) == 0 && f.MinLatencyMS == 0
+}
+
+func (f *Filter) matchesEndpoint(m models.Metric) bool {
+	for _, id := range f.EndpointIDs {
+		if id == m.EndpointID {
+			return true
+		}
+	}
+	for _, re := range f.patterns {
+		if re.MatchString(m.URL) {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert a glob where * matches any run of characters into an anchored regexp
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("pattern is empty")
+	}
+	quoted := regexp.QuoteMeta(pattern)
+	return regexp.Compile("^" + strings.ReplaceAll(quoted, `\*`, ".*") + "$")
+}
+
+// Parse a status class such as "2xx" into its leading digit
+func parseStatusClass(class string) (int, error) {
+	c := strings.ToLower(class)
+	if len(c) != 3 || c[1:] != "xx" || c[0] < '1' || c[0] > '5' {
+		return 0, fmt.Errorf("invalid status class %q, expected one of 1xx-5xx", class)
+	}
+	return int(c[0] - '0'), nil
+}
+
+func normaliseClasses(classes []string) []string {
+	out := make([]string, 0, len(classes))
+	for _, c := range classes {
+		out = append(out, strings.ToLower(c))
+	}
+	return out
+}
+
+func appendUnique[T comparable](base, extra []T) []T {
+	out := append([]T(nil), base...)
+	for _, v := range extra {
+		found := false
+		for _, existing := range out {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func removeAll[T comparable](base, remove []T) []T {
+	var out []T
+	for _, v := range base {
+		drop := false
+		for _, r := range remove {
+			if v == r {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestFilterMatches(t *testing.T) {
+	endpointID := uuid.New()
+	metric := models.Metric{
+		EndpointID: endpointID,
+		URL:        "https://api.github.com/status",
+		StatusCode: 503,
+		LatencyMS:  750,
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected bool
+	}{
+		{name: "empty filter matches everything", filter: Filter{}, expected: true},
+		{name: "matching endpoint ID", filter: Filter{EndpointIDs: []uuid.UUID{endpointID}}, expected: true},
+		{name: "other endpoint ID", filter: Filter{EndpointIDs: []uuid.UUID{uuid.New()}}, expected: false},
+		{name: "matching url pattern", filter: Filter{URLPatterns: []string{"https://api.github.com/*"}}, expected: true},
+		{name: "non matching url pattern", filter: Filter{URLPatterns: []string{"*httpstat.us*"}}, expected: false},
+		{
+			name:     "endpoint ID or url pattern",
+			filter:   Filter{EndpointIDs: []uuid.UUID{uuid.New()}, URLPatterns: []string{"*github*"}},
+			expected: true,
+		},
+		{name: "matching status class", filter: Filter{StatusClasses: []string{"2xx", "5XX"}}, expected: true},
+		{name: "non matching status class", filter: Filter{StatusClasses: []string{"2xx"}}, expected: false},
+		{name: "latency above threshold", filter: Filter{MinLatencyMS: 500}, expected: true},
+		{name: "latency below threshold", filter: Filter{MinLatencyMS: 1000}, expected: false},
+		{
+			name:     "all criteria must hold",
+			filter:   Filter{EndpointIDs: []uuid.UUID{endpointID}, StatusClasses: []string{"4xx"}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.filter
+			if err := f.Compile(); err != nil {
+				t.Fatalf("unexpected compile error: %v", err)
+			}
+			if got := f.Matches(metric); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFilterCompileRejectsInvalidInput(t *testing.T) {
+	filters := []Filter{
+		{StatusClasses: []string{"6xx"}},
+		{StatusClasses: []string{"200"}},
+		{URLPatterns: []string{""}},
+		{MinLatencyMS: -1},
+	}
+
+	for _, f := range filters {
+		if err := f.Compile(); err == nil {
+			t.Errorf("expected error compiling %+v", f)
+		}
+	}
+}
+
+func TestFilterMergeAndWithout(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+
+	f := Filter{EndpointIDs: []uuid.UUID{a}}
+	f = f.Merge(Filter{EndpointIDs: []uuid.UUID{a, b}, StatusClasses: []string{"5XX"}, MinLatencyMS: 200})
+
+	if len(f.EndpointIDs) != 2 || len(f.StatusClasses) != 1 || f.MinLatencyMS != 200 {
+		t.Fatalf("unexpected merged filter: %+v", f)
+	}
+
+	f = f.Without(Filter{EndpointIDs: []uuid.UUID{a}, StatusClasses: []string{"5xx"}})
+	if len(f.EndpointIDs) != 1 || f.EndpointIDs[0] != b || len(f.StatusClasses) != 0 || f.MinLatencyMS != 200 {
+		t.Fatalf("unexpected filter after removal: %+v", f)
+	}
+
+	if !f.Without(Filter{}).IsEmpty() {
+		t.Error("expected removing an empty filter to clear everything")
+	}
+}
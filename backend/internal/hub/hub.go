@@ -0,0 +1,114 @@
+package hub
+
+import (
+	"sync"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// DefaultBufferSize is how many metrics a subscriber may fall behind before it is dropped
+const DefaultBufferSize = 64
+
+// Hub fans out metrics published by the poller to every connected subscriber
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscriber]struct{}
+	bufferSize  int
+}
+
+// Subscriber receives published metrics on C until it unsubscribes or is dropped
+type Subscriber struct {
+	C  <-chan models.Metric
+	ch chan models.Metric
+
+	mu     sync.RWMutex
+	filter Filter
+}
+
+func New(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{
+		subscribers: make(map[*Subscriber]struct{}),
+		bufferSize:  bufferSize,
+	}
+}
+
+// Register a new subscriber with its own buffered channel
+func (h *Hub) Subscribe() *Subscriber {
+	ch := make(chan models.Metric, h.bufferSize)
+	s := &Subscriber{C: ch, ch: ch}
+
+	h.mu.Lock()
+	h.subscribers[s] = struct{}{}
+	h.mu.Unlock()
+
+	return s
+}
+
+// Remove a subscriber and close its channel. Safe to call more than once.
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s)
+}
+
+// Publish a metric to every subscriber without blocking. A subscriber whose
+// buffer is full is dropped so a slow client can never stall the poller.
+func (h *Hub) Publish(m models.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subscribers {
+		if !s.Matches(m) {
+			continue
+		}
+		select {
+		case s.ch <- m:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Number of currently registered subscribers
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+func (h *Hub) remove(s *Subscriber) {
+	if _, ok := h.subscribers[s]; !ok {
+		return
+	}
+	delete(h.subscribers, s)
+	close(s.ch)
+}
+
+// Current filter for the subscriber
+func (s *Subscriber) Filter() Filter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filter
+}
+
+// Replace the subscriber's filter. Takes effect from the next published metric.
+func (s *Subscriber) SetFilter(f Filter) error {
+	if err := f.Compile(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.filter = f
+	s.mu.Unlock()
+	return nil
+}
+
+// Report whether a metric passes the subscriber's current filter
+func (s *Subscriber) Matches(m models.Metric) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.filter.Matches(m)
+}
@@ -0,0 +1,62 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestPublishDeliversToAllSubscribers(t *testing.T) {
+	h := New(4)
+	a := h.Subscribe()
+	b := h.Subscribe()
+
+	metric := models.Metric{ID: uuid.New(), StatusCode: 200, LatencyMS: 42}
+	h.Publish(metric)
+
+	for _, s := range []*Subscriber{a, b} {
+		select {
+		case got := <-s.C:
+			if got.ID != metric.ID {
+				t.Errorf("expected metric %s, got %s", metric.ID, got.ID)
+			}
+		default:
+			t.Fatal("expected a metric to be delivered")
+		}
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	h := New(1)
+	slow := h.Subscribe()
+	fast := h.Subscribe()
+
+	h.Publish(models.Metric{ID: uuid.New()})
+	<-fast.C
+	h.Publish(models.Metric{ID: uuid.New()})
+
+	if h.Len() != 1 {
+		t.Fatalf("expected 1 subscriber after drop, got %d", h.Len())
+	}
+
+	<-slow.C
+	if _, ok := <-slow.C; ok {
+		t.Error("expected slow subscriber channel to be closed")
+	}
+	if _, ok := <-fast.C; !ok {
+		t.Error("expected fast subscriber to still receive metrics")
+	}
+}
+
+func TestUnsubscribeIsIdempotent(t *testing.T) {
+	h := New(1)
+	s := h.Subscribe()
+
+	h.Unsubscribe(s)
+	h.Unsubscribe(s)
+
+	if h.Len() != 0 {
+		t.Errorf("expected no subscribers, got %d", h.Len())
+	}
+}
@@ -0,0 +1,96 @@
+package hub
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// How much history a new live client is sent before live events
+	DefaultBackfill = 15 * time.Minute
+	// Upper bound on replayed history, whether from minutes or since
+	MaxBackfill = 24 * time.Hour
+)
+
+// Build a filter from query parameters so clients that can't send messages,
+// such as EventSource, can still narrow the stream. Repeated parameters and
+// comma separated values are both accepted for endpoint_id and status_class.
+func FilterFromQuery(q url.Values) (Filter, error) {
+	var f Filter
+
+	for _, raw := range splitValues(q["endpoint_id"]) {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid endpoint_id %q", raw)
+		}
+		f.EndpointIDs = append(f.EndpointIDs, id)
+	}
+
+	f.URLPatterns = q["url_pattern"]
+	f.StatusClasses = normaliseClasses(splitValues(q["status_class"]))
+
+	if raw := q.Get("min_latency_ms"); raw != "" {
+		ms, err := strconv.Atoi(raw)
+		if err != nil {
+			return Filter{}, fmt.Errorf("invalid min_latency_ms %q", raw)
+		}
+		f.MinLatencyMS = ms
+	}
+
+	if err := f.Compile(); err != nil {
+		return Filter{}, err
+	}
+	return f, nil
+}
+
+// Work out the cursor replayed history starts after. A resume cursor (since),
+// the last metric's timestamp and ID as formatted by models.MetricCursor,
+// takes priority over a window in minutes, and both are clamped to
+// MaxBackfill. A bare timestamp is accepted for since as well.
+func BackfillStart(since, minutes string, now time.Time) (models.MetricCursor, error) {
+	oldest := models.MetricCursor{Timestamp: now.Add(-MaxBackfill)}
+
+	if since != "" {
+		cursor, err := models.ParseMetricCursor(since)
+		if err != nil {
+			return models.MetricCursor{}, fmt.Errorf("invalid since parameter: %w", err)
+		}
+		if cursor.Timestamp.Before(oldest.Timestamp) {
+			cursor = oldest
+		}
+		return cursor, nil
+	}
+
+	window := DefaultBackfill
+	if minutes != "" {
+		m, err := strconv.Atoi(minutes)
+		if err != nil || m < 0 {
+			return models.MetricCursor{}, fmt.Errorf("invalid minutes parameter: %q", minutes)
+		}
+		window = time.Duration(m) * time.Minute
+	}
+
+	start := now.Add(-window)
+	if start.Before(oldest.Timestamp) {
+		return oldest, nil
+	}
+	return models.MetricCursor{Timestamp: start}, nil
+}
+
+func splitValues(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package hub
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestFilterFromQuery(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	q := url.Values{
+		"endpoint_id":    {a.String() + "," + b.String()},
+		"url_pattern":    {"*github*", "*httpstat.us*"},
+		"status_class":   {"2XX", "5xx"},
+		"min_latency_ms": {"250"},
+	}
+
+	f, err := FilterFromQuery(q)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(f.EndpointIDs) != 2 || len(f.URLPatterns) != 2 || len(f.StatusClasses) != 2 || f.MinLatencyMS != 250 {
+		t.Errorf("unexpected filter: %+v", f)
+	}
+
+	invalid := []url.Values{
+		{"endpoint_id": {"not-a-uuid"}},
+		{"status_class": {"7xx"}},
+		{"min_latency_ms": {"fast"}},
+	}
+	for _, q := range invalid {
+		if _, err := FilterFromQuery(q); err == nil {
+			t.Errorf("expected error for %v", q)
+		}
+	}
+}
+
+func TestBackfillStart(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	lastID := uuid.New()
+
+	tests := []struct {
+		name       string
+		since      string
+		minutes    string
+		expected   time.Time
+		expectedID uuid.UUID
+		wantErr    bool
+	}{
+		{name: "defaults to the last 15 minutes", expected: now.Add(-DefaultBackfill)},
+		{name: "custom minutes", minutes: "5", expected: now.Add(-5 * time.Minute)},
+		{name: "since takes priority", minutes: "5", since: "2025-06-01T11:30:00Z", expected: now.Add(-30 * time.Minute)},
+		{name: "since is a cursor", since: "2025-06-01T11:30:00.25Z/" + lastID.String(), expected: now.Add(-30*time.Minute + 250*time.Millisecond), expectedID: lastID},
+		{name: "since is clamped", since: "2020-01-01T00:00:00Z/" + lastID.String(), expected: now.Add(-MaxBackfill)},
+		{name: "invalid since", since: "yesterday", wantErr: true},
+		{name: "invalid minutes", minutes: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BackfillStart(tt.since, tt.minutes, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Timestamp.Equal(tt.expected) || got.ID != tt.expectedID {
+				t.Errorf("expected %s/%s, got %s", tt.expected, tt.expectedID, got)
+			}
+		})
+	}
+}
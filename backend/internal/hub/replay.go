@@ -0,0 +1,74 @@
+package hub
+
+import (
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Most stored metrics read and sent at once when replaying history
+const ReplayPageSize = 500
+
+// Where replayed history is read from, such as the database
+type MetricSource interface {
+	GetMetricsAfter(cursor models.MetricCursor, filter Filter, limit int) ([]models.Metric, error)
+}
+
+// Send stored metrics matching a compiled filter from after a cursor, a page
+// at a time, then subscribe to live metrics with the same filter.
+//
+// Subscribing only once the history has been sent means a long replay can't
+// fill the subscriber's buffer and get it dropped. A final catch-up is read
+// after subscribing so nothing stored in between is missed. The IDs of the
+// metrics sent since the last page before subscribing are returned, as those
+// can be published after the subscription starts, so the caller can skip
+// them when they arrive live. The caller must unsubscribe unless an error is
+// returned.
+func (h *Hub) Replay(src MetricSource, cursor models.MetricCursor, filter Filter, send func([]models.Metric) error) (*Subscriber, map[uuid.UUID]struct{}, error) {
+	recent := make(map[uuid.UUID]struct{})
+	record := func(page []models.Metric) {
+		for _, m := range page {
+			recent[m.ID] = struct{}{}
+		}
+	}
+
+	// Only the last page before subscribing can hold metrics not yet published
+	cursor, err := replayPages(src, cursor, filter, send, func(page []models.Metric) {
+		clear(recent)
+		record(page)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sub := h.Subscribe()
+	if err := sub.SetFilter(filter); err != nil {
+		h.Unsubscribe(sub)
+		return nil, nil, err
+	}
+	if _, err := replayPages(src, cursor, filter, send, record); err != nil {
+		h.Unsubscribe(sub)
+		return nil, nil, err
+	}
+	return sub, recent, nil
+}
+
+// Send pages of stored metrics until a short page shows there are no more,
+// passing each to sent and returning the cursor of the last metric sent
+func replayPages(src MetricSource, cursor models.MetricCursor, filter Filter, send func([]models.Metric) error, sent func([]models.Metric)) (models.MetricCursor, error) {
+	for {
+		page, err := src.GetMetricsAfter(cursor, filter, ReplayPageSize)
+		if err != nil {
+			return cursor, err
+		}
+		if len(page) > 0 {
+			if err := send(page); err != nil {
+				return cursor, err
+			}
+			sent(page)
+			cursor = page[len(page)-1].Cursor()
+		}
+		if len(page) < ReplayPageSize {
+			return cursor, nil
+		}
+	}
+}
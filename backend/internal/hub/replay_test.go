@@ -0,0 +1,70 @@
+package hub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Stored metrics in cursor order, paged as the database pages them
+type pagedSource struct {
+	metrics []models.Metric
+	reads   int
+	onRead  func()
+}
+
+func (s *pagedSource) GetMetricsAfter(cursor models.MetricCursor, filter Filter, limit int) ([]models.Metric, error) {
+	s.reads++
+	if s.onRead != nil {
+		s.onRead()
+	}
+	var page []models.Metric
+	for _, m := range s.metrics {
+		if len(page) < limit && m.Timestamp.After(cursor.Timestamp) && filter.Matches(m) {
+			page = append(page, m)
+		}
+	}
+	return page, nil
+}
+
+func TestReplaySendsPagesBeforeSubscribing(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	src := &pagedSource{}
+	for i := range 2*ReplayPageSize + 1 {
+		src.metrics = append(src.metrics, models.Metric{ID: uuid.New(), Timestamp: start.Add(time.Duration(i+1) * time.Second), StatusCode: 200})
+	}
+
+	h := New(1)
+	// Nothing is subscribed while the history is read, so it can't be dropped
+	src.onRead = func() {
+		if src.reads <= 3 && h.Len() != 0 {
+			t.Error("expected history to be read before subscribing")
+		}
+	}
+
+	var filter Filter
+	filter.Compile()
+	sent := 0
+	sub, recent, err := h.Replay(src, models.MetricCursor{Timestamp: start}, filter, func(page []models.Metric) error {
+		if len(page) > ReplayPageSize {
+			t.Errorf("expected at most a page at a time, got %d", len(page))
+		}
+		sent += len(page)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Unsubscribe(sub)
+
+	// Three pages, then an empty catch-up after subscribing
+	if sent != len(src.metrics) || src.reads != 4 || h.Len() != 1 {
+		t.Errorf("expected every metric sent once over 4 reads, got %d metrics over %d reads", sent, src.reads)
+	}
+	last := src.metrics[len(src.metrics)-1].ID
+	if _, ok := recent[last]; !ok || len(recent) != 1 {
+		t.Errorf("expected only the last page to be skipped when published, got %v", recent)
+	}
+}
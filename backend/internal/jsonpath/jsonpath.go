@@ -0,0 +1,118 @@
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound is returned when a path is valid but the document doesn't contain it
+var ErrNotFound = errors.New("path not found")
+
+// A single step of a path, either an object key or an array index
+type segment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// Path is a compiled JSONPath expression. Only the subset needed for checks is
+// supported: a leading $, dotted keys, quoted bracket keys and array indexes,
+// for example $.data.items[0]['display name'].
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// Compile a JSONPath expression
+func Compile(expr string) (*Path, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("jsonpath %q must start with $", expr)
+	}
+
+	p := &Path{expr: expr}
+	rest := expr[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end == -1 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("jsonpath %q has an empty key", expr)
+			}
+			p.segments = append(p.segments, segment{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("jsonpath %q has an unclosed bracket", expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				p.segments = append(p.segments, segment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("jsonpath %q has an invalid index %q", expr, inner)
+			}
+			p.segments = append(p.segments, segment{index: index, isIndex: true})
+		default:
+			return nil, fmt.Errorf("jsonpath %q is invalid at %q", expr, rest)
+		}
+	}
+
+	return p, nil
+}
+
+// Find the value at the path in a document decoded with encoding/json.
+// Negative indexes count back from the end of an array.
+func (p *Path) Lookup(doc any) (any, error) {
+	current := doc
+	for _, seg := range p.segments {
+		if seg.isIndex {
+			arr, ok := current.([]any)
+			if !ok {
+				return nil, ErrNotFound
+			}
+			i := seg.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, ErrNotFound
+			}
+			current = arr[i]
+			continue
+		}
+
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, ErrNotFound
+		}
+		value, ok := obj[seg.key]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		current = value
+	}
+	return current, nil
+}
+
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Compile and look up a path in one step
+func Lookup(doc any, expr string) (any, error) {
+	p, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return p.Lookup(doc)
+}
@@ -0,0 +1,56 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	var doc any
+	raw := `{"status":"ok","data":{"items":[{"id":1},{"id":2,"display name":"second"}]},"count":2}`
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr     string
+		expected any
+		err      error
+	}{
+		{expr: "$.status", expected: "ok"},
+		{expr: "$.count", expected: float64(2)},
+		{expr: "$.data.items[0].id", expected: float64(1)},
+		{expr: "$.data.items[-1]['display name']", expected: "second"},
+		{expr: `$["status"]`, expected: "ok"},
+		{expr: "$.missing", err: ErrNotFound},
+		{expr: "$.data.items[5]", err: ErrNotFound},
+		{expr: "$.status.nested", err: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := Lookup(doc, tt.expr)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("expected error %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompileRejectsInvalidPaths(t *testing.T) {
+	for _, expr := range []string{"", "status", "$.", "$.items[", "$.items[x]", "$items"} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("expected error compiling %q", expr)
+		}
+	}
+}
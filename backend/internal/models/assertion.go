@@ -0,0 +1,87 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/jsonpath"
+)
+
+type AssertionType string
+
+const (
+	AssertContains       AssertionType = "contains"        // Body contains Value
+	AssertNotContains    AssertionType = "not_contains"    // Body does not contain Value
+	AssertRegex          AssertionType = "regex"           // Body matches the pattern in Value
+	AssertJSONPathEquals AssertionType = "jsonpath_equals" // Value at the JSONPath in Target equals Value
+	AssertJSONPathExists AssertionType = "jsonpath_exists" // JSONPath in Target exists
+	AssertHeaderPresent  AssertionType = "header_present"  // Header named Target is present
+	AssertHeaderMatches  AssertionType = "header_matches"  // Header named Target matches the pattern in Value
+	AssertMaxBodySize    AssertionType = "max_body_size"   // Body is at most Value bytes
+	AssertCertExpiry     AssertionType = "cert_expiry"     // TLS leaf certificate is valid for at least Value more days
+)
+
+// Check made against the response of an HTTP check
+type Assertion struct {
+	Type   AssertionType `json:"type"`
+	Target string        `json:"target,omitempty"` // JSONPath expression or header name
+	Value  string        `json:"value,omitempty"`  // Expected text, pattern, value or size
+}
+
+// Outcome of a single assertion, stored with each metric
+type AssertionResult struct {
+	Assertion
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// Check an assertion is well formed
+func (a Assertion) Validate() error {
+	switch a.Type {
+	case AssertContains, AssertNotContains:
+		if a.Value == "" {
+			return fmt.Errorf("%s assertion needs a value", a.Type)
+		}
+	case AssertRegex:
+		if _, err := regexp.Compile(a.Value); err != nil {
+			return fmt.Errorf("regex assertion has an invalid pattern: %w", err)
+		}
+	case AssertJSONPathEquals, AssertJSONPathExists:
+		if _, err := jsonpath.Compile(a.Target); err != nil {
+			return err
+		}
+	case AssertHeaderPresent:
+		if a.Target == "" {
+			return fmt.Errorf("header_present assertion needs a header name")
+		}
+	case AssertHeaderMatches:
+		if a.Target == "" {
+			return fmt.Errorf("header_matches assertion needs a header name")
+		}
+		if _, err := regexp.Compile(a.Value); err != nil {
+			return fmt.Errorf("header_matches assertion has an invalid pattern: %w", err)
+		}
+	case AssertMaxBodySize:
+		if n, err := strconv.Atoi(a.Value); err != nil || n < 0 {
+			return fmt.Errorf("max_body_size assertion needs a size in bytes")
+		}
+	case AssertCertExpiry:
+		if n, err := strconv.Atoi(a.Value); err != nil || n < 0 {
+			return fmt.Errorf("cert_expiry assertion needs a number of days")
+		}
+	default:
+		return fmt.Errorf("unknown assertion type %q", a.Type)
+	}
+	return nil
+}
+
+// Report whether every assertion result passed
+func AllPassed(results []AssertionResult) bool {
+	for _, r := range results {
+		if !r.Passed {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+type AuthType string
+
+const (
+	AuthBasic             AuthType = "basic"                     // Username and password
+	AuthBearer            AuthType = "bearer"                    // Static bearer token
+	AuthClientCredentials AuthType = "oauth2_client_credentials" // Token fetched from TokenURL and cached until expiry
+	AuthMTLS              AuthType = "mtls"                      // Client certificate and key
+)
+
+// Credentials that one or more endpoints use for their checks
+type AuthProfile struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Type AuthType  `json:"type"`
+
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+
+	Token string `json:"token,omitempty"`
+
+	TokenURL     string   `json:"token_url,omitempty"`
+	ClientID     string   `json:"client_id,omitempty"`
+	ClientSecret string   `json:"client_secret,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+
+	ClientCert string `json:"client_cert,omitempty"` // PEM
+	ClientKey  string `json:"client_key,omitempty"`  // PEM
+}
+
+// Check a profile has the fields its type needs
+func (p AuthProfile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	switch p.Type {
+	case AuthBasic:
+		if p.Username == "" {
+			return fmt.Errorf("basic auth needs a username")
+		}
+	case AuthBearer:
+		if p.Token == "" {
+			return fmt.Errorf("bearer auth needs a token")
+		}
+	case AuthClientCredentials:
+		u, err := url.Parse(p.TokenURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("client credentials need an http or https token_url")
+		}
+		if p.ClientID == "" || p.ClientSecret == "" {
+			return fmt.Errorf("client credentials need a client_id and client_secret")
+		}
+	case AuthMTLS:
+		if _, err := tls.X509KeyPair([]byte(p.ClientCert), []byte(p.ClientKey)); err != nil {
+			return fmt.Errorf("invalid client certificate or key: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown auth type %q", p.Type)
+	}
+	return nil
+}
+
+// Copy of the profile with its secrets replaced, safe to return from the API
+func (p AuthProfile) Redacted() AuthProfile {
+	for _, secret := range []*string{&p.Password, &p.Token, &p.ClientSecret, &p.ClientKey} {
+		if *secret != "" {
+			*secret = RedactedValue
+		}
+	}
+	return p
+}
+
+// Fill secrets sent back as the redacted placeholder from the stored profile
+func (p *AuthProfile) KeepSecrets(stored AuthProfile) {
+	pairs := []struct{ dst, src *string }{
+		{&p.Password, &stored.Password},
+		{&p.Token, &stored.Token},
+		{&p.ClientSecret, &stored.ClientSecret},
+		{&p.ClientKey, &stored.ClientKey},
+	}
+	for _, pair := range pairs {
+		if *pair.dst == RedactedValue {
+			*pair.dst = *pair.src
+		}
+	}
+}
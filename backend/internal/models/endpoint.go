@@ -0,0 +1,340 @@
+package models
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	MinFrequency = 5 * time.Second
+	MaxFrequency = 24 * time.Hour
+
+	DefaultTimeout      = 5 * time.Second
+	MaxTimeout          = 2 * time.Minute
+	DefaultMaxRedirects = 10
+	MaxRedirectLimit    = 30
+
+	MaxRetries      = 5
+	MaxRetryBackoff = time.Minute
+	MaxConfirmAfter = 10
+)
+
+// JSON shape of an endpoint, with the frequency in whole seconds
+type endpointJSON struct {
+	endpointAlias
+	FrequencySeconds int `json:"frequency_seconds"`
+}
+
+// Same fields as MonitoredEndpoint without its JSON methods
+type endpointAlias MonitoredEndpoint
+
+func (ep MonitoredEndpoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(endpointJSON{
+		endpointAlias:    endpointAlias(ep),
+		FrequencySeconds: int(ep.Frequency / time.Second),
+	})
+}
+
+func (ep *MonitoredEndpoint) UnmarshalJSON(data []byte) error {
+	var raw endpointJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*ep = MonitoredEndpoint(raw.endpointAlias)
+	ep.Frequency = time.Duration(raw.FrequencySeconds) * time.Second
+	return nil
+}
+
+// Check an endpoint is complete and its settings are usable
+func (ep MonitoredEndpoint) Validate() error {
+	// A heartbeat's URL is its ping path, set when it is created
+	if ep.Kind() != CheckHeartbeat {
+		if err := ep.validateURL(); err != nil {
+			return err
+		}
+	}
+
+	if ep.Frequency < MinFrequency || ep.Frequency > MaxFrequency {
+		return fmt.Errorf("frequency must be between %s and %s", MinFrequency, MaxFrequency)
+	}
+
+	if ep.Method != "" && strings.ContainsAny(ep.Method, " \t\r\n/") {
+		return fmt.Errorf("invalid method %q", ep.Method)
+	}
+
+	for _, r := range ep.ExpectedStatus {
+		if r.Min < 100 || r.Max > 599 || r.Max < r.Min {
+			return fmt.Errorf("invalid expected status range %d-%d", r.Min, r.Max)
+		}
+	}
+
+	if ep.Retry.Retries < 0 || ep.Retry.Retries > MaxRetries {
+		return fmt.Errorf("retries must be between 0 and %d", MaxRetries)
+	}
+	if ep.Retry.BackoffMS < 0 || time.Duration(ep.Retry.BackoffMS)*time.Millisecond > MaxRetryBackoff {
+		return fmt.Errorf("retry backoff must be between 0 and %s", MaxRetryBackoff)
+	}
+	// Backoff is slept between attempts, so it must not hold a check past
+	// when the next one is due
+	if total := ep.Retry.TotalBackoff(); total > ep.Frequency {
+		return fmt.Errorf("retry backoff adds up to %s, longer than the %s frequency", total, ep.Frequency)
+	}
+	if ep.Retry.ConfirmAfter < 0 || ep.Retry.ConfirmAfter > MaxConfirmAfter {
+		return fmt.Errorf("confirm_after must be between 0 and %d", MaxConfirmAfter)
+	}
+
+	if ep.TimeoutMS < 0 || time.Duration(ep.TimeoutMS)*time.Millisecond > MaxTimeout {
+		return fmt.Errorf("timeout must be between 0 and %s", MaxTimeout)
+	}
+	if ep.MaxRedirects < 0 || ep.MaxRedirects > MaxRedirectLimit {
+		return fmt.Errorf("max_redirects must be between 0 and %d", MaxRedirectLimit)
+	}
+
+	if ep.ProxyURL != "" {
+		proxy, err := url.Parse(ep.ProxyURL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy url: %w", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("proxy url must use http, https or socks5")
+		}
+		if proxy.Host == "" {
+			return fmt.Errorf("proxy url must include a host")
+		}
+	}
+
+	if ep.CABundle != "" {
+		if ep.TLSSkipVerify {
+			return fmt.Errorf("ca_bundle has no effect when tls_skip_verify is set")
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM([]byte(ep.CABundle)) {
+			return fmt.Errorf("ca_bundle contains no PEM certificates")
+		}
+	}
+
+	for i, a := range ep.Assertions {
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("assertion %d: %w", i, err)
+		}
+	}
+
+	if ep.Retention != nil {
+		if err := ep.Retention.Validate(true); err != nil {
+			return err
+		}
+	}
+
+	if err := ep.validateKindSettings(); err != nil {
+		return err
+	}
+
+	switch ep.Kind() {
+	case CheckHTTP, CheckTCP, CheckDNS, CheckTLS, CheckGRPC, CheckWebSocket:
+		if len(ep.Steps) > 0 {
+			return fmt.Errorf("steps are only used by transaction endpoints")
+		}
+	case CheckTransaction:
+		if ep.Body != "" || len(ep.ExpectedStatus) > 0 || len(ep.Assertions) > 0 {
+			return fmt.Errorf("transactions set the body, expected status and assertions on each step")
+		}
+		if err := validateSteps(ep.Steps); err != nil {
+			return err
+		}
+	case CheckHeartbeat:
+		if err := ep.validateHeartbeat(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown endpoint type %q", ep.Type)
+	}
+
+	return nil
+}
+
+// URL schemes used by each kind of check that isn't made over HTTP
+var kindSchemes = map[CheckType][]string{
+	CheckTCP:       {"tcp"},
+	CheckDNS:       {"dns"},
+	CheckTLS:       {"tls"},
+	CheckGRPC:      {"grpc", "grpcs"},
+	CheckWebSocket: {"ws", "wss"},
+}
+
+// Check the URL suits the kind of check
+func (ep MonitoredEndpoint) validateURL() error {
+	u, err := url.Parse(ep.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if schemes, ok := kindSchemes[ep.Kind()]; ok {
+		if !slices.Contains(schemes, u.Scheme) {
+			return fmt.Errorf("%s checks need a %s:// url", ep.Kind(), strings.Join(schemes, ":// or "))
+		}
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url must use http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url must include a host")
+	}
+	if (u.Scheme == "tcp" || u.Scheme == "grpc") && u.Port() == "" {
+		return fmt.Errorf("%s url must include a port", u.Scheme)
+	}
+	return nil
+}
+
+// Check settings that only apply to one kind of check are valid and only
+// set on that kind
+func (ep MonitoredEndpoint) validateKindSettings() error {
+	kind := ep.Kind()
+	_, network := kindSchemes[kind]
+
+	if network && kind != CheckWebSocket && ep.ProxyURL != "" {
+		return fmt.Errorf("proxy_url is only used by HTTP and WebSocket checks")
+	}
+	for _, a := range ep.Assertions {
+		if network && (kind != CheckTLS || a.Type != AssertCertExpiry) {
+			return fmt.Errorf("%s checks don't support %s assertions", kind, a.Type)
+		}
+	}
+
+	if ep.BannerMatch != "" {
+		if kind != CheckTCP {
+			return fmt.Errorf("banner_match is only used by tcp checks")
+		}
+		if _, err := regexp.Compile(ep.BannerMatch); err != nil {
+			return fmt.Errorf("banner_match has an invalid pattern: %w", err)
+		}
+	}
+
+	if ep.DNSRecordType != "" || ep.DNSExpected != "" || ep.DNSResolver != "" {
+		if kind != CheckDNS {
+			return fmt.Errorf("dns settings are only used by dns checks")
+		}
+		if !slices.Contains(DNSRecordTypes, ep.RecordType()) {
+			return fmt.Errorf("dns_record_type must be one of %s", strings.Join(DNSRecordTypes, ", "))
+		}
+		if ep.DNSResolver != "" {
+			host, _, err := net.SplitHostPort(ep.ResolverAddress())
+			if err != nil || host == "" || strings.ContainsAny(host, "/ ") {
+				return fmt.Errorf("dns_resolver must be a host or host:port")
+			}
+		}
+	}
+
+	if ep.GRPCService != "" && kind != CheckGRPC {
+		return fmt.Errorf("grpc_service is only used by grpc checks")
+	}
+
+	if ep.WSMessage != "" || ep.WSExpect != "" {
+		if kind != CheckWebSocket {
+			return fmt.Errorf("ws_message and ws_expect are only used by websocket checks")
+		}
+		if _, err := regexp.Compile(ep.WSExpect); err != nil {
+			return fmt.Errorf("ws_expect has an invalid pattern: %w", err)
+		}
+	}
+
+	if ep.GraceSeconds != 0 {
+		if kind != CheckHeartbeat {
+			return fmt.Errorf("grace_seconds is only used by heartbeat monitors")
+		}
+		if ep.GraceSeconds < 0 || time.Duration(ep.GraceSeconds)*time.Second > MaxGrace {
+			return fmt.Errorf("grace_seconds must be between 0 and %d", int(MaxGrace.Seconds()))
+		}
+	}
+
+	if ep.MinTLSVersion != "" {
+		if kind != CheckTLS {
+			return fmt.Errorf("min_tls_version is only used by tls checks")
+		}
+		if _, err := ParseTLSVersion(ep.MinTLSVersion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shown in place of sensitive header values in API responses
+const RedactedValue = "[REDACTED]"
+
+// Headers always treated as secrets
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// Report whether a header carries credentials, either by name or because it
+// looks like a token or key
+func IsSensitiveHeader(name string) bool {
+	if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, hint := range []string{"token", "secret", "password", "api-key", "apikey"} {
+		if strings.Contains(lower, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// Copy of the endpoint with sensitive header values and the proxy password
+// replaced, safe to return from the API
+func (ep MonitoredEndpoint) Redacted() MonitoredEndpoint {
+	ep.Headers = redactHeaders(ep.Headers)
+	ep.ProxyURL = redactProxyURL(ep.ProxyURL)
+	if len(ep.Steps) > 0 {
+		steps := make([]TransactionStep, len(ep.Steps))
+		for i, step := range ep.Steps {
+			step.Headers = redactHeaders(step.Headers)
+			steps[i] = step
+		}
+		ep.Steps = steps
+	}
+	return ep
+}
+
+func redactHeaders(headers map[string]string) map[string]string {
+	if len(headers) == 0 {
+		return headers
+	}
+	redacted := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if IsSensitiveHeader(k) {
+			v = RedactedValue
+		}
+		redacted[k] = v
+	}
+	return redacted
+}
+
+// Report whether a proxy URL carries a password, which makes it a secret
+func ProxyHasPassword(proxyURL string) bool {
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.User == nil {
+		return false
+	}
+	_, ok := u.User.Password()
+	return ok
+}
+
+func redactProxyURL(proxyURL string) string {
+	if !ProxyHasPassword(proxyURL) {
+		return proxyURL
+	}
+	u, _ := url.Parse(proxyURL)
+	u.User = url.UserPassword(u.User.Username(), RedactedValue)
+	return u.String()
+}
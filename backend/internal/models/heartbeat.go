@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultGrace = time.Minute
+	MaxGrace     = 24 * time.Hour
+
+	// Largest log payload kept from a ping, longer ones are cut short
+	MaxPingLog = 10 << 10
+)
+
+// Kinds of ping a heartbeat monitor's job sends
+type PingKind string
+
+const (
+	PingStart   PingKind = "start"   // The job has started
+	PingSuccess PingKind = "success" // The job finished successfully
+	PingFail    PingKind = "fail"    // The job finished with an error
+)
+
+// Where a heartbeat monitor's job is up to, updated by its pings rather than
+// by editing the endpoint
+type PingState struct {
+	LastPingAt   *time.Time `json:"last_ping_at,omitempty"`
+	RunningSince *time.Time `json:"running_since,omitempty"` // Set by a start ping until the job finishes
+	StartLog     string     `json:"-"`                       // Payload of the start ping, kept with the finishing ping's log
+}
+
+// Path the job pings, relative to the API server
+func (ep MonitoredEndpoint) PingPath() string {
+	return "/ping/" + ep.PingToken
+}
+
+// How late a ping can be before the monitor is down, defaulting to a minute
+func (ep MonitoredEndpoint) Grace() time.Duration {
+	if ep.GraceSeconds <= 0 {
+		return DefaultGrace
+	}
+	return time.Duration(ep.GraceSeconds) * time.Second
+}
+
+// When a ping must arrive by. A running job must finish within the grace
+// time of starting, otherwise the next ping is due a period after the last.
+// A monitor that has never been pinged gets a period from now.
+func (ep MonitoredEndpoint) PingDeadline(now time.Time) time.Time {
+	switch {
+	case ep.RunningSince != nil:
+		return ep.RunningSince.Add(ep.Grace())
+	case ep.LastPingAt != nil:
+		return ep.LastPingAt.Add(ep.Frequency + ep.Grace())
+	default:
+		return now.Add(ep.Frequency + ep.Grace())
+	}
+}
+
+// Heartbeat monitors are pinged rather than making requests, so request
+// settings can't be used with them
+func (ep MonitoredEndpoint) validateHeartbeat() error {
+	unused := []struct {
+		name string
+		set  bool
+	}{
+		{"steps", len(ep.Steps) > 0},
+		{"method", ep.Method != ""},
+		{"body", ep.Body != ""},
+		{"headers", len(ep.Headers) > 0},
+		{"expected_status", len(ep.ExpectedStatus) > 0},
+		{"assertions", len(ep.Assertions) > 0},
+		{"retries", ep.Retry.Retries > 0},
+		{"timeout_ms", ep.TimeoutMS > 0},
+		{"proxy_url", ep.ProxyURL != ""},
+		{"tls_skip_verify", ep.TLSSkipVerify},
+		{"ca_bundle", ep.CABundle != ""},
+		{"auth_profile_id", ep.AuthProfileID != nil},
+	}
+	for _, setting := range unused {
+		if setting.set {
+			return fmt.Errorf("heartbeat monitors don't make requests, so %s isn't used", setting.name)
+		}
+	}
+	return nil
+}
@@ -1,16 +1,89 @@
 package models
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// What kind of check an endpoint runs
+type CheckType string
+
+const (
+	CheckHTTP        CheckType = "http"        // A single HTTP request
+	CheckTransaction CheckType = "transaction" // An ordered list of HTTP steps
+	CheckTCP         CheckType = "tcp"         // Connect to tcp://host:port, optionally matching a banner
+	CheckDNS         CheckType = "dns"         // Resolve dns://name and compare the answer
+	CheckTLS         CheckType = "tls"         // TLS handshake with tls://host[:port], without a request
+	CheckGRPC        CheckType = "grpc"        // grpc.health.v1.Health/Check on grpc://host:port, or grpcs:// over TLS
+	CheckWebSocket   CheckType = "websocket"   // Open a ws:// or wss:// connection, optionally exchanging a message
+	CheckHeartbeat   CheckType = "heartbeat"   // Wait for a job to ping /ping/{token} instead of polling
+)
+
 type MonitoredEndpoint struct {
-	ID        uuid.UUID
-	URL       string
-	Frequency time.Duration
-	Headers   map[string]string
+	ID             uuid.UUID         `json:"id"`
+	Type           CheckType         `json:"type,omitempty"` // Defaults to http
+	URL            string            `json:"url"`
+	Frequency      time.Duration     `json:"-"` // Sent as frequency_seconds, see MarshalJSON
+	Headers        map[string]string `json:"headers,omitempty"`
+	Method         string            `json:"method,omitempty"`          // HTTP method, defaults to GET
+	Body           string            `json:"body,omitempty"`            // Optional request body
+	ContentType    string            `json:"content_type,omitempty"`    // Content-Type sent with Body
+	ExpectedStatus []StatusRange     `json:"expected_status,omitempty"` // Status codes that count as up, defaults to 2xx and 3xx
+	Assertions     []Assertion       `json:"assertions,omitempty"`      // Checks made against the response
+	Retry          RetryPolicy       `json:"retry"`                     // How failed checks are retried and confirmed
+	TimeoutMS      int               `json:"timeout_ms,omitempty"`      // Request timeout, defaults to 5 seconds
+	MaxRedirects   int               `json:"max_redirects,omitempty"`   // Redirects followed before failing, defaults to 10
+	NoRedirects    bool              `json:"no_redirects,omitempty"`    // Record redirects without following them
+	ProxyURL       string            `json:"proxy_url,omitempty"`       // http, https or socks5 proxy for the check
+	TLSSkipVerify  bool              `json:"tls_skip_verify,omitempty"` // Accept any certificate
+	CABundle       string            `json:"ca_bundle,omitempty"`       // PEM certificates trusted instead of the system roots
+	AuthProfileID  *uuid.UUID        `json:"auth_profile_id,omitempty"` // Credentials applied to each request
+	Steps          []TransactionStep `json:"steps,omitempty"`           // Requests made by a transaction check
+	BannerMatch    string            `json:"banner_match,omitempty"`    // Pattern the banner sent by a TCP server must match
+	DNSRecordType  string            `json:"dns_record_type,omitempty"` // Record a DNS check looks up, defaults to A
+	DNSExpected    string            `json:"dns_expected,omitempty"`    // Answer a DNS check must include
+	DNSResolver    string            `json:"dns_resolver,omitempty"`    // host[:port] of a resolver to use instead of the system one
+	MinTLSVersion  string            `json:"min_tls_version,omitempty"` // Oldest protocol a TLS check accepts, e.g. 1.2
+	GRPCService    string            `json:"grpc_service,omitempty"`    // Service a gRPC health check asks about, empty for the whole server
+	WSMessage      string            `json:"ws_message,omitempty"`      // Text message a WebSocket check sends once connected
+	WSExpect       string            `json:"ws_expect,omitempty"`       // Pattern a message received by a WebSocket check must match
+	PingToken      string            `json:"ping_token,omitempty"`      // Identifies a heartbeat monitor in its ping URL, generated on creation
+	GraceSeconds   int               `json:"grace_seconds,omitempty"`   // How late a heartbeat ping can be, defaults to a minute
+	Retention      *RetentionPolicy  `json:"retention,omitempty"`       // Overrides how long the endpoint's data is kept
+	Paused         bool              `json:"paused"`                    // Paused endpoints are not polled
+	PingState                        // Set by a heartbeat monitor's pings
+}
+
+// How a failed check is retried before it is recorded, and how many
+// consecutive failures it takes before the endpoint counts as down
+type RetryPolicy struct {
+	Retries      int `json:"retries"`       // Extra attempts after a failure
+	BackoffMS    int `json:"backoff_ms"`    // Wait before the first retry, doubled for each one after
+	ConfirmAfter int `json:"confirm_after"` // Consecutive failed checks before a failure is confirmed
+}
+
+// Wait before the given retry, counting from 1
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	return time.Duration(p.BackoffMS) * time.Millisecond << (retry - 1)
+}
+
+// Wait before every retry added up, the longest a check can spend backing off
+func (p RetryPolicy) TotalBackoff() time.Duration {
+	var total time.Duration
+	for retry := 1; retry <= p.Retries; retry++ {
+		total += p.Backoff(retry)
+	}
+	return total
+}
+
+// Inclusive range of HTTP status codes
+type StatusRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
 }
 
 type Metric struct {
@@ -20,10 +93,292 @@ type Metric struct {
 	StatusCode int       `json:"status_code"`
 	LatencyMS  int       `json:"latency_ms"`
 	URL        string    `json:"url"`
+	Success    bool      `json:"success"`
+	PhaseTimings
+
+	// URLs the check was redirected to, in order
+	RedirectChain []string `json:"redirect_chain,omitempty"`
+
+	// Protocol negotiated by an HTTPS or TLS check, e.g. TLS 1.3
+	TLSVersion string `json:"tls_version,omitempty"`
+
+	// Health reported to a gRPC check, e.g. SERVING or NOT_SERVING
+	GRPCStatus string `json:"grpc_status,omitempty"`
+
+	// WebSocket checks: time to complete the opening handshake, time from
+	// then until the first message arrived, and the close code the server
+	// sent, if any
+	HandshakeMS    int `json:"handshake_ms,omitempty"`
+	FirstMessageMS int `json:"first_message_ms,omitempty"`
+	CloseCode      int `json:"close_code,omitempty"`
+
+	// Heartbeat monitors: the ping this metric records, empty for a missed
+	// ping, and the log the job sent with it
+	Ping    PingKind `json:"ping,omitempty"`
+	PingLog string   `json:"ping_log,omitempty"`
+
+	// Requests made for this check, 1 when the first attempt was recorded
+	Attempts int `json:"attempts"`
+	// A failure not yet seen on enough consecutive checks to count as down
+	Unconfirmed bool `json:"unconfirmed,omitempty"`
+
+	// Why the check failed, empty when it succeeded
+	FailureReason FailureReason `json:"failure_reason,omitempty"`
+	ErrorMessage  string        `json:"error_message,omitempty"`
+
+	AssertionResults []AssertionResult `json:"assertion_results,omitempty"`
+
+	// Outcome of each step of a transaction check, up to the first failure
+	Steps []StepResult `json:"steps,omitempty"`
+
+	// Peer certificate chain seen by an HTTPS check. Stored per endpoint
+	// rather than with the metric, so it isn't part of the metric payload.
+	Certificates []Certificate `json:"-"`
+}
+
+// Position in the stored metrics, which are ordered by timestamp and then ID
+// so metrics stored in the same millisecond each have their own place
+type MetricCursor struct {
+	Timestamp time.Time
+	ID        uuid.UUID // uuid.Nil comes before every metric at Timestamp
+}
+
+// Cursor at a metric, which reading after resumes just past
+func (m Metric) Cursor() MetricCursor {
+	return MetricCursor{Timestamp: m.Timestamp, ID: m.ID}
+}
+
+// Formatted as the timestamp and ID separated by a slash, e.g. for SSE event IDs
+func (c MetricCursor) String() string {
+	return c.Timestamp.UTC().Format(time.RFC3339Nano) + "/" + c.ID.String()
+}
+
+// Parse a cursor formatted by String. A timestamp on its own is accepted as
+// the cursor before every metric at that time.
+func ParseMetricCursor(s string) (MetricCursor, error) {
+	timestamp, id, hasID := strings.Cut(s, "/")
+	var c MetricCursor
+	var err error
+	if c.Timestamp, err = time.Parse(time.RFC3339, timestamp); err != nil {
+		return MetricCursor{}, fmt.Errorf("invalid cursor %q: %w", s, err)
+	}
+	if hasID {
+		if c.ID, err = uuid.Parse(id); err != nil {
+			return MetricCursor{}, fmt.Errorf("invalid cursor %q: %w", s, err)
+		}
+	}
+	return c, nil
+}
+
+// Certificate presented by a monitored endpoint
+type Certificate struct {
+	EndpointID       uuid.UUID `json:"endpoint_id"`
+	URL              string    `json:"url"`
+	Position         int       `json:"position"` // Index in the chain, 0 is the leaf
+	Subject          string    `json:"subject"`
+	SANs             []string  `json:"sans"`
+	Issuer           string    `json:"issuer"`
+	NotBefore        time.Time `json:"not_before"`
+	NotAfter         time.Time `json:"not_after"`
+	KeyType          string    `json:"key_type"`          // e.g. RSA-2048, ECDSA-P-256, Ed25519
+	HostnameVerified bool      `json:"hostname_verified"` // Leaf matches the endpoint host
+	CheckedAt        time.Time `json:"checked_at"`
+}
+
+// Time spent in each phase of an HTTP check, in milliseconds
+type PhaseTimings struct {
+	DNSMS      int `json:"dns_ms"`
+	ConnectMS  int `json:"connect_ms"`
+	TLSMS      int `json:"tls_ms"`
+	TTFBMS     int `json:"ttfb_ms"`     // From the request being written to the first response byte
+	TransferMS int `json:"transfer_ms"` // From the first response byte to the end of the body
+}
+
+func (p *PhaseTimings) add(other PhaseTimings) {
+	p.DNSMS += other.DNSMS
+	p.ConnectMS += other.ConnectMS
+	p.TLSMS += other.TLSMS
+	p.TTFBMS += other.TTFBMS
+	p.TransferMS += other.TransferMS
+}
+
+// Average of timings summed over a number of checks
+func (p PhaseTimings) Average(count int) PhaseTimings {
+	if count == 0 {
+		return PhaseTimings{}
+	}
+	return PhaseTimings{
+		DNSMS:      p.DNSMS / count,
+		ConnectMS:  p.ConnectMS / count,
+		TLSMS:      p.TLSMS / count,
+		TTFBMS:     p.TTFBMS / count,
+		TransferMS: p.TransferMS / count,
+	}
+}
+
+// Average phase timings of the checks in one bucket, for stacked latency charts
+type LatencyBreakdown struct {
+	Timestamp time.Time `json:"timestamp"` // Start of the bucket
+	Count     int       `json:"count"`     // Checks averaged
+	PhaseTimings
 }
 
 type StatusCodeCount struct {
 	URL        string `json:"url"`
-	StatusCode int    `json:"status_code"`
+	StatusCode int    `json:"status_code"` // Zero for checks made without HTTP
+	Success    bool   `json:"success"`
 	Count      int    `json:"count"`
 }
+
+type FailureReasonCount struct {
+	URL           string        `json:"url"`
+	FailureReason FailureReason `json:"failure_reason"`
+	Count         int           `json:"count"`
+}
+
+// Classification of why a check failed
+type FailureReason string
+
+const (
+	FailureNone               FailureReason = ""
+	FailureDNS                FailureReason = "dns_failure"
+	FailureConnectionRefused  FailureReason = "connection_refused"
+	FailureConnectionReset    FailureReason = "connection_reset"
+	FailureTimeout            FailureReason = "timeout"
+	FailureTLS                FailureReason = "tls_error"
+	FailureTooManyRedirects   FailureReason = "too_many_redirects"
+	FailureInvalidRequest     FailureReason = "invalid_request"
+	FailureUnexpectedStatus   FailureReason = "unexpected_status"
+	FailureAssertion          FailureReason = "assertion_failed"
+	FailureNetwork            FailureReason = "network_error"
+	FailureAuth               FailureReason = "auth_failure"        // Credentials for the check couldn't be obtained
+	FailureExtraction         FailureReason = "extraction_failed"   // A transaction step's response lacked a value to extract
+	FailureUnexpectedResponse FailureReason = "unexpected_response" // A TCP banner, DNS answer, gRPC health status or WebSocket message didn't match
+	FailureMissedPing         FailureReason = "missed_ping"         // A heartbeat monitor wasn't pinged in time
+	FailureJobFailed          FailureReason = "job_failed"          // A heartbeat monitor's job sent a fail ping
+)
+
+// Every failure reason a metric can be stored with
+var FailureReasons = []FailureReason{
+	FailureDNS, FailureConnectionRefused, FailureConnectionReset, FailureTimeout, FailureTLS,
+	FailureTooManyRedirects, FailureInvalidRequest, FailureUnexpectedStatus, FailureAssertion, FailureNetwork,
+	FailureAuth, FailureExtraction, FailureUnexpectedResponse, FailureMissedPing, FailureJobFailed,
+}
+
+// Parse a failure reason from a query parameter. "none" selects successful checks.
+func ParseFailureReason(s string) (FailureReason, error) {
+	if s == "none" {
+		return FailureNone, nil
+	}
+	for _, r := range FailureReasons {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown failure reason %q", s)
+}
+
+// Kind of check the endpoint runs
+func (ep MonitoredEndpoint) Kind() CheckType {
+	if ep.Type == "" {
+		return CheckHTTP
+	}
+	return ep.Type
+}
+
+// HTTP method to use for the check
+func (ep MonitoredEndpoint) HTTPMethod() string {
+	if ep.Method == "" {
+		return "GET"
+	}
+	return strings.ToUpper(ep.Method)
+}
+
+// Request timeout for the endpoint
+func (ep MonitoredEndpoint) Timeout() time.Duration {
+	if ep.TimeoutMS <= 0 {
+		return DefaultTimeout
+	}
+	return time.Duration(ep.TimeoutMS) * time.Millisecond
+}
+
+// Number of redirects followed before the check fails
+func (ep MonitoredEndpoint) RedirectLimit() int {
+	if ep.MaxRedirects <= 0 {
+		return DefaultMaxRedirects
+	}
+	return ep.MaxRedirects
+}
+
+// Report whether a status code counts as up for this endpoint
+func (ep MonitoredEndpoint) IsExpectedStatus(code int) bool {
+	if len(ep.ExpectedStatus) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, r := range ep.ExpectedStatus {
+		if code >= r.Min && code <= r.Max {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse a list of status codes and ranges such as "200-299,401"
+func ParseStatusRanges(spec string) ([]StatusRange, error) {
+	var ranges []StatusRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lo, hi, isRange := strings.Cut(part, "-")
+		low, err := parseStatusCode(lo)
+		if err != nil {
+			return nil, err
+		}
+		high := low
+		if isRange {
+			if high, err = parseStatusCode(hi); err != nil {
+				return nil, err
+			}
+		}
+		if high < low {
+			return nil, fmt.Errorf("invalid status range %q", part)
+		}
+		ranges = append(ranges, StatusRange{Min: low, Max: high})
+	}
+	return ranges, nil
+}
+
+// Format status ranges in the form accepted by ParseStatusRanges
+func FormatStatusRanges(ranges []StatusRange) string {
+	parts := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Min == r.Max {
+			parts = append(parts, strconv.Itoa(r.Min))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", r.Min, r.Max))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseStatusCode(s string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || code < 100 || code > 599 {
+		return 0, fmt.Errorf("invalid status code %q", s)
+	}
+	return code, nil
+}
+
+// Snapshot of the poller's concurrency limits and how often checks waited
+// for a free slot
+type PollerStats struct {
+	MaxConcurrent int   `json:"max_concurrent"`
+	MaxPerHost    int   `json:"max_per_host"`
+	InFlight      int   `json:"in_flight"`
+	ChecksRun     int64 `json:"checks_run"`
+	ChecksDelayed int64 `json:"checks_delayed"` // Checks that couldn't start straight away
+	AvgDelayMS    int64 `json:"avg_delay_ms"`   // Average wait of the delayed checks
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseStatusRanges(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected []StatusRange
+		wantErr  bool
+	}{
+		{spec: "", expected: nil},
+		{spec: "200", expected: []StatusRange{{Min: 200, Max: 200}}},
+		{spec: "200-299, 401", expected: []StatusRange{{Min: 200, Max: 299}, {Min: 401, Max: 401}}},
+		{spec: "299-200", wantErr: true},
+		{spec: "abc", wantErr: true},
+		{spec: "700", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseStatusRanges(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			roundTrip, err := ParseStatusRanges(FormatStatusRanges(got))
+			if err != nil || !reflect.DeepEqual(roundTrip, got) {
+				t.Errorf("expected %v to round trip, got %v", got, roundTrip)
+			}
+		})
+	}
+}
+
+func TestParseMetricCursor(t *testing.T) {
+	at := time.Date(2025, 1, 1, 12, 0, 0, 123000000, time.UTC)
+	id := uuid.New()
+
+	tests := []struct {
+		cursor   string
+		expected MetricCursor
+		wantErr  bool
+	}{
+		{cursor: MetricCursor{Timestamp: at, ID: id}.String(), expected: MetricCursor{Timestamp: at, ID: id}},
+		{cursor: "2025-01-01T12:00:00.123Z", expected: MetricCursor{Timestamp: at}},
+		{cursor: "2025-01-01T12:00:00.123Z/nope", wantErr: true},
+		{cursor: "yesterday", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cursor, func(t *testing.T) {
+			got, err := ParseMetricCursor(tt.cursor)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.Timestamp.Equal(tt.expected.Timestamp) || got.ID != tt.expected.ID {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsExpectedStatus(t *testing.T) {
+	defaults := MonitoredEndpoint{}
+	if !defaults.IsExpectedStatus(204) || !defaults.IsExpectedStatus(301) || defaults.IsExpectedStatus(401) {
+		t.Error("expected 2xx and 3xx to be up by default")
+	}
+
+	authProbe := MonitoredEndpoint{ExpectedStatus: []StatusRange{{Min: 401, Max: 401}}}
+	if !authProbe.IsExpectedStatus(401) || authProbe.IsExpectedStatus(200) {
+		t.Error("expected only 401 to be up for the auth probe")
+	}
+}
+
+func TestAssertionValidate(t *testing.T) {
+	valid := []Assertion{
+		{Type: AssertContains, Value: "ok"},
+		{Type: AssertRegex, Value: `^\{`},
+		{Type: AssertJSONPathEquals, Target: "$.status", Value: "ok"},
+		{Type: AssertHeaderMatches, Target: "Content-Type", Value: "json"},
+		{Type: AssertMaxBodySize, Value: "1024"},
+	}
+	for _, a := range valid {
+		if err := a.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %v", a, err)
+		}
+	}
+
+	invalid := []Assertion{
+		{Type: "equals"},
+		{Type: AssertContains},
+		{Type: AssertRegex, Value: "("},
+		{Type: AssertJSONPathExists, Target: "status"},
+		{Type: AssertHeaderPresent},
+		{Type: AssertMaxBodySize, Value: "big"},
+	}
+	for _, a := range invalid {
+		if err := a.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", a)
+		}
+	}
+}
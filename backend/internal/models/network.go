@@ -0,0 +1,48 @@
+package models
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Record types a DNS check can look up
+var DNSRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT"}
+
+// Protocol versions accepted by min_tls_version
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Record type the DNS check looks up
+func (ep MonitoredEndpoint) RecordType() string {
+	if ep.DNSRecordType == "" {
+		return "A"
+	}
+	return strings.ToUpper(ep.DNSRecordType)
+}
+
+// Address of the resolver a DNS check queries, defaulting to port 53. Empty
+// when the system resolver is used.
+func (ep MonitoredEndpoint) ResolverAddress() string {
+	if ep.DNSResolver == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(ep.DNSResolver); err == nil {
+		return ep.DNSResolver
+	}
+	return net.JoinHostPort(ep.DNSResolver, "53")
+}
+
+// Parse a protocol version such as "1.2"
+func ParseTLSVersion(s string) (uint16, error) {
+	v, ok := tlsVersions[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown TLS version %q, expected 1.0, 1.1, 1.2 or 1.3", s)
+	}
+	return v, nil
+}
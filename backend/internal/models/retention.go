@@ -0,0 +1,95 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Longest anything can be kept for, about ten years
+const MaxRetentionDays = 3650
+
+// How many days of each kind of data are kept before the pruner deletes it.
+// Day rollups are kept for good.
+type RetentionPolicy struct {
+	RawDays    int `json:"raw_days,omitempty"`    // Raw metrics
+	MinuteDays int `json:"minute_days,omitempty"` // Minute rollups
+	HourDays   int `json:"hour_days,omitempty"`   // Hour rollups
+}
+
+// Kept unless the server or an endpoint says otherwise
+var DefaultRetention = RetentionPolicy{RawDays: 7, MinuteDays: 30, HourDays: 365}
+
+// Policy with any days set in an override replacing these
+func (p RetentionPolicy) With(override *RetentionPolicy) RetentionPolicy {
+	if override == nil {
+		return p
+	}
+	if override.RawDays > 0 {
+		p.RawDays = override.RawDays
+	}
+	if override.MinuteDays > 0 {
+		p.MinuteDays = override.MinuteDays
+	}
+	if override.HourDays > 0 {
+		p.HourDays = override.HourDays
+	}
+	return p
+}
+
+// Oldest time kept of metrics, or of rollups at a resolution. Zero for day
+// rollups, which aren't pruned.
+func (p RetentionPolicy) Cutoff(r Resolution, now time.Time) time.Time {
+	var days int
+	switch r {
+	case ResolutionRaw:
+		days = p.RawDays
+	case ResolutionMinute:
+		days = p.MinuteDays
+	case ResolutionHour:
+		days = p.HourDays
+	default:
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -days)
+}
+
+// Check every period is set to between a day and MaxRetentionDays, or left
+// at zero when unset is allowed
+func (p RetentionPolicy) Validate(allowUnset bool) error {
+	periods := []struct {
+		name string
+		days int
+	}{
+		{"raw_days", p.RawDays},
+		{"minute_days", p.MinuteDays},
+		{"hour_days", p.HourDays},
+	}
+	for _, period := range periods {
+		if period.days == 0 && allowUnset {
+			continue
+		}
+		if period.days < 1 || period.days > MaxRetentionDays {
+			return fmt.Errorf("retention %s must be between 1 and %d", period.name, MaxRetentionDays)
+		}
+	}
+	return nil
+}
+
+// Rows the pruner has deleted from each kind of data
+type PruneCounts struct {
+	Raw    int64 `json:"raw"`
+	Minute int64 `json:"minute"`
+	Hour   int64 `json:"hour"`
+}
+
+// Where the pruner is up to, for the API
+type PruneStatus struct {
+	Defaults   RetentionPolicy `json:"defaults"`
+	Running    bool            `json:"running"`
+	Phase      string          `json:"phase,omitempty"` // What a running prune is deleting, e.g. raw or 1m, or compact
+	StartedAt  *time.Time      `json:"started_at,omitempty"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+	NextRunAt  *time.Time      `json:"next_run_at,omitempty"`
+	Deleted    PruneCounts     `json:"deleted"` // By the current run, or the last one if none is running
+	LastError  string          `json:"last_error,omitempty"`
+}
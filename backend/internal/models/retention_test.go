@@ -0,0 +1,59 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetentionPolicyWith(t *testing.T) {
+	got := DefaultRetention.With(&RetentionPolicy{RawDays: 90})
+	if got != (RetentionPolicy{RawDays: 90, MinuteDays: 30, HourDays: 365}) {
+		t.Errorf("expected only raw_days to change, got %+v", got)
+	}
+	if got := DefaultRetention.With(nil); got != DefaultRetention {
+		t.Errorf("expected the defaults without an override, got %+v", got)
+	}
+}
+
+func TestRetentionPolicyCutoff(t *testing.T) {
+	now := time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		resolution Resolution
+		expected   time.Time
+	}{
+		{ResolutionRaw, time.Date(2025, 3, 24, 12, 0, 0, 0, time.UTC)},
+		{ResolutionMinute, time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{ResolutionHour, time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)},
+		{ResolutionDay, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		if got := DefaultRetention.Cutoff(tt.resolution, now); !got.Equal(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.resolution, tt.expected, got)
+		}
+	}
+}
+
+func TestRetentionPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     RetentionPolicy
+		allowUnset bool
+		wantErr    bool
+	}{
+		{name: "defaults", policy: DefaultRetention},
+		{name: "unset override", policy: RetentionPolicy{MinuteDays: 60}, allowUnset: true},
+		{name: "unset default", policy: RetentionPolicy{MinuteDays: 60}, wantErr: true},
+		{name: "negative", policy: RetentionPolicy{RawDays: -1}, allowUnset: true, wantErr: true},
+		{name: "too long", policy: RetentionPolicy{HourDays: MaxRetentionDays + 1}, allowUnset: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.allowUnset)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package models
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/sketch"
+	"github.com/google/uuid"
+)
+
+// Width of the buckets metrics are rolled up into
+type Resolution string
+
+const (
+	ResolutionMinute Resolution = "1m"
+	ResolutionHour   Resolution = "1h"
+	ResolutionDay    Resolution = "1d"
+
+	// Metrics as recorded, before they are rolled up
+	ResolutionRaw Resolution = "raw"
+)
+
+// Every resolution from finest to coarsest. Each is rolled up from the one
+// before it, and the finest from raw metrics.
+var Resolutions = []Resolution{ResolutionMinute, ResolutionHour, ResolutionDay}
+
+// Most buckets a chart should need, so a day of minutes or 60 days of hours
+const MaxChartBuckets = 1440
+
+func ParseResolution(s string) (Resolution, error) {
+	for _, r := range Resolutions {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown resolution %q", s)
+}
+
+func (r Resolution) Duration() time.Duration {
+	switch r {
+	case ResolutionMinute:
+		return time.Minute
+	case ResolutionHour:
+		return time.Hour
+	default:
+		return 24 * time.Hour
+	}
+}
+
+// Start of the bucket a time falls in. Buckets are aligned to UTC.
+func (r Resolution) Truncate(t time.Time) time.Time {
+	return t.UTC().Truncate(r.Duration())
+}
+
+// Finest resolution that covers a date range in at most MaxChartBuckets
+// buckets, so long ranges are read from fewer, coarser rollups
+func ChooseResolution(start, end time.Time) Resolution {
+	for _, r := range Resolutions {
+		if end.Sub(start) <= MaxChartBuckets*r.Duration() {
+			return r
+		}
+	}
+	return ResolutionDay
+}
+
+// Bucket widths latency percentiles can be reported in
+var LatencyIntervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// Most buckets per endpoint one request for latency percentiles can cover
+const MaxLatencyBuckets = 10000
+
+func ParseLatencyInterval(s string) (time.Duration, error) {
+	interval, ok := LatencyIntervals[s]
+	if !ok {
+		return 0, fmt.Errorf("interval must be 1m, 5m, 1h or 1d")
+	}
+	return interval, nil
+}
+
+// Coarsest resolution whose buckets fit evenly into an interval, which
+// latency percentiles for that interval are read from
+func SourceResolution(interval time.Duration) Resolution {
+	for i := len(Resolutions) - 1; i > 0; i-- {
+		if interval%Resolutions[i].Duration() == 0 {
+			return Resolutions[i]
+		}
+	}
+	return Resolutions[0]
+}
+
+// Aggregate of an endpoint's metrics over one bucket
+type Rollup struct {
+	EndpointID   uuid.UUID
+	URL          string
+	BucketStart  time.Time
+	Count        int
+	SuccessCount int
+	MinLatencyMS int
+	MaxLatencyMS int
+	SumLatencyMS int64
+	Latency      sketch.Sketch // Distribution of latencies, for percentiles
+	Outcomes     Outcomes      // Confirmed checks by status code and failure reason
+	Phases       PhaseSums     // For average phase timings
+}
+
+// Count a metric in the bucket
+func (r *Rollup) Add(m Metric) {
+	r.add(m.LatencyMS, m.LatencyMS, int64(m.LatencyMS), 1)
+	if m.Success {
+		r.SuccessCount++
+	}
+	r.Latency.Add(float64(m.LatencyMS))
+	if !m.Unconfirmed {
+		r.Outcomes.add(Outcome{m.StatusCode, m.FailureReason}, 1)
+	}
+	r.Phases.All.add(m.PhaseTimings)
+	if m.Attempts <= 1 {
+		r.Phases.FirstAttempt.add(m.PhaseTimings)
+		r.Phases.FirstAttempts++
+	}
+}
+
+// Count every metric in a finer bucket
+func (r *Rollup) Merge(other Rollup) {
+	if other.Count == 0 {
+		return
+	}
+	r.add(other.MinLatencyMS, other.MaxLatencyMS, other.SumLatencyMS, other.Count)
+	r.SuccessCount += other.SuccessCount
+	r.Latency.Merge(&other.Latency)
+	for outcome, count := range other.Outcomes {
+		r.Outcomes.add(outcome, count)
+	}
+	r.Phases.All.add(other.Phases.All)
+	r.Phases.FirstAttempt.add(other.Phases.FirstAttempt)
+	r.Phases.FirstAttempts += other.Phases.FirstAttempts
+}
+
+func (r *Rollup) add(minMS, maxMS int, sumMS int64, count int) {
+	if r.Count == 0 || minMS < r.MinLatencyMS {
+		r.MinLatencyMS = minMS
+	}
+	if r.Count == 0 || maxMS > r.MaxLatencyMS {
+		r.MaxLatencyMS = maxMS
+	}
+	r.SumLatencyMS += sumMS
+	r.Count += count
+}
+
+// Status code and failure reason a check ended with
+type Outcome struct {
+	StatusCode    int           `json:"status_code"`
+	FailureReason FailureReason `json:"failure_reason,omitempty"`
+}
+
+// Checks counted by outcome. Stored as a list, since JSON objects can only
+// be keyed by strings.
+type Outcomes map[Outcome]int
+
+func (o *Outcomes) add(outcome Outcome, count int) {
+	if *o == nil {
+		*o = make(Outcomes)
+	}
+	(*o)[outcome] += count
+}
+
+type outcomeCount struct {
+	Outcome
+	Count int `json:"count"`
+}
+
+func (o Outcomes) MarshalJSON() ([]byte, error) {
+	counts := make([]outcomeCount, 0, len(o))
+	for outcome, count := range o {
+		counts = append(counts, outcomeCount{outcome, count})
+	}
+	slices.SortFunc(counts, func(a, b outcomeCount) int {
+		return cmp.Or(cmp.Compare(a.StatusCode, b.StatusCode), cmp.Compare(a.FailureReason, b.FailureReason))
+	})
+	return json.Marshal(counts)
+}
+
+func (o *Outcomes) UnmarshalJSON(data []byte) error {
+	var counts []outcomeCount
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return err
+	}
+	*o = nil
+	for _, c := range counts {
+		o.add(c.Outcome, c.Count)
+	}
+	return nil
+}
+
+// Phase timings summed over the checks in a bucket. Checks recorded from
+// their first attempt are summed apart too, so retried ones can be left out.
+type PhaseSums struct {
+	All           PhaseTimings `json:"all"`
+	FirstAttempt  PhaseTimings `json:"first_attempt"`
+	FirstAttempts int          `json:"first_attempts"`
+}
+
+// Latency summary of one bucket, for charts
+type LatencyBucket struct {
+	BucketStart  time.Time `json:"bucket_start"`
+	Count        int       `json:"count"`
+	SuccessCount int       `json:"success_count"`
+	MinLatencyMS int       `json:"min_latency_ms"`
+	MaxLatencyMS int       `json:"max_latency_ms"`
+	AvgLatencyMS float64   `json:"avg_latency_ms"`
+	P50MS        float64   `json:"p50_ms"`
+	P90MS        float64   `json:"p90_ms"`
+	P95MS        float64   `json:"p95_ms"`
+	P99MS        float64   `json:"p99_ms"`
+}
+
+func (r Rollup) Summary() LatencyBucket {
+	b := LatencyBucket{
+		BucketStart:  r.BucketStart,
+		Count:        r.Count,
+		SuccessCount: r.SuccessCount,
+		MinLatencyMS: r.MinLatencyMS,
+		MaxLatencyMS: r.MaxLatencyMS,
+	}
+	if r.Count > 0 {
+		b.AvgLatencyMS = float64(r.SumLatencyMS) / float64(r.Count)
+	}
+	b.P50MS = r.percentile(0.50)
+	b.P90MS = r.percentile(0.90)
+	b.P95MS = r.percentile(0.95)
+	b.P99MS = r.percentile(0.99)
+	return b
+}
+
+// Estimated percentile, kept within the bucket's exact min and max
+func (r Rollup) percentile(q float64) float64 {
+	if r.Count == 0 {
+		return 0
+	}
+	return min(max(r.Latency.Quantile(q), float64(r.MinLatencyMS)), float64(r.MaxLatencyMS))
+}
+
+// Latency buckets for each endpoint at one resolution, for charts
+type LatencyRollups struct {
+	Resolution Resolution                 `json:"resolution"`
+	Endpoints  map[string][]LatencyBucket `json:"endpoints"` // Keyed by URL
+}
+
+// Latency percentiles for each endpoint in buckets of one interval
+type LatencyPercentiles struct {
+	Interval  string            `json:"interval"`
+	Endpoints []EndpointLatency `json:"endpoints"` // Ordered by URL
+}
+
+// Latency buckets for one endpoint. Endpoints can share a URL, so each is
+// identified by its ID.
+type EndpointLatency struct {
+	EndpointID uuid.UUID       `json:"endpoint_id"`
+	URL        string          `json:"url"`
+	Buckets    []LatencyBucket `json:"buckets"`
+}
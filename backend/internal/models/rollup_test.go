@@ -0,0 +1,119 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChooseResolution(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		span     time.Duration
+		expected Resolution
+	}{
+		{span: time.Hour, expected: ResolutionMinute},
+		{span: 24 * time.Hour, expected: ResolutionMinute},
+		{span: 7 * 24 * time.Hour, expected: ResolutionHour},
+		{span: 60 * 24 * time.Hour, expected: ResolutionHour},
+		{span: 90 * 24 * time.Hour, expected: ResolutionDay},
+		{span: 5 * 365 * 24 * time.Hour, expected: ResolutionDay},
+	}
+
+	for _, tt := range tests {
+		if got := ChooseResolution(start, start.Add(tt.span)); got != tt.expected {
+			t.Errorf("%v: expected %s, got %s", tt.span, tt.expected, got)
+		}
+	}
+}
+
+func TestRollupMergeMatchesAdd(t *testing.T) {
+	latencies := []int{120, 80, 300, 95, 1500, 110}
+
+	var whole, first, second Rollup
+	for i, latency := range latencies {
+		m := Metric{LatencyMS: latency, Success: latency < 1000}
+		whole.Add(m)
+		if i < 2 {
+			first.Add(m)
+		} else {
+			second.Add(m)
+		}
+	}
+	var merged Rollup
+	merged.Merge(first)
+	merged.Merge(Rollup{}) // Empty buckets don't change the minimum
+	merged.Merge(second)
+
+	if merged.Summary() != whole.Summary() {
+		t.Errorf("expected %+v, got %+v", whole.Summary(), merged.Summary())
+	}
+
+	b := whole.Summary()
+	if b.Count != 6 || b.SuccessCount != 5 || b.MinLatencyMS != 80 || b.MaxLatencyMS != 1500 || b.AvgLatencyMS != 367.5 {
+		t.Errorf("unexpected summary %+v", b)
+	}
+	// Percentiles stay within the exact min and max
+	if b.P50MS < 80 || b.P99MS > 1500 || b.P50MS > b.P90MS || b.P90MS > b.P99MS {
+		t.Errorf("unexpected percentiles %+v", b)
+	}
+}
+
+func TestEmptyRollupSummary(t *testing.T) {
+	if b := (Rollup{}).Summary(); b != (LatencyBucket{}) {
+		t.Errorf("expected an empty summary, got %+v", b)
+	}
+}
+
+func TestLatencyIntervals(t *testing.T) {
+	tests := []struct {
+		interval string
+		source   Resolution
+		wantErr  bool
+	}{
+		{interval: "1m", source: ResolutionMinute},
+		{interval: "5m", source: ResolutionMinute},
+		{interval: "1h", source: ResolutionHour},
+		{interval: "1d", source: ResolutionDay},
+		{interval: "30s", wantErr: true},
+		{interval: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		interval, err := ParseLatencyInterval(tt.interval)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error", tt.interval)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.interval, err)
+		}
+		if got := SourceResolution(interval); got != tt.source {
+			t.Errorf("%q: expected source %s, got %s", tt.interval, tt.source, got)
+		}
+	}
+}
+
+func TestOutcomesRoundTrip(t *testing.T) {
+	var r Rollup
+	r.Add(Metric{StatusCode: 200, Success: true})
+	r.Add(Metric{StatusCode: 200, Success: true})
+	r.Add(Metric{FailureReason: FailureTimeout})
+	r.Add(Metric{StatusCode: 500, FailureReason: FailureUnexpectedStatus, Unconfirmed: true})
+
+	data, err := json.Marshal(r.Outcomes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Outcomes
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expected := Outcomes{{StatusCode: 200}: 2, {FailureReason: FailureTimeout}: 1}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("expected unconfirmed checks to be left out and the rest to round-trip, got %s", data)
+	}
+}
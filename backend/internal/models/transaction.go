@@ -0,0 +1,197 @@
+package models
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/jsonpath"
+)
+
+// Most steps a transaction can have
+const MaxTransactionSteps = 20
+
+// Ordered HTTP request made by a transaction check. URL, header values and
+// body can use {{name}} to insert a value extracted by an earlier step.
+type TransactionStep struct {
+	Name           string            `json:"name"`
+	Method         string            `json:"method,omitempty"` // HTTP method, defaults to GET
+	URL            string            `json:"url"`
+	Headers        map[string]string `json:"headers,omitempty"` // Added to the endpoint's headers, replacing any with the same name
+	Body           string            `json:"body,omitempty"`
+	ContentType    string            `json:"content_type,omitempty"`
+	ExpectedStatus []StatusRange     `json:"expected_status,omitempty"` // Defaults to 2xx and 3xx
+	Assertions     []Assertion       `json:"assertions,omitempty"`
+	Extract        []Extraction      `json:"extract,omitempty"` // Values made available to later steps
+}
+
+type ExtractSource string
+
+const (
+	ExtractJSONPath ExtractSource = "jsonpath" // Value at the JSONPath in Expression
+	ExtractHeader   ExtractSource = "header"   // Response header named Expression
+	ExtractRegex    ExtractSource = "regex"    // First capture group of Expression in the body, or the whole match
+)
+
+// Value taken from a step's response and stored as a variable
+type Extraction struct {
+	Name       string        `json:"name"`
+	Source     ExtractSource `json:"source"`
+	Expression string        `json:"expression"`
+}
+
+// Outcome of one transaction step, stored with the transaction's metric
+type StepResult struct {
+	Name       string `json:"name"`
+	Method     string `json:"method"`
+	URL        string `json:"url"` // As configured, before variables are inserted
+	StatusCode int    `json:"status_code"`
+	LatencyMS  int    `json:"latency_ms"`
+	Success    bool   `json:"success"`
+	PhaseTimings
+
+	FailureReason    FailureReason     `json:"failure_reason,omitempty"`
+	ErrorMessage     string            `json:"error_message,omitempty"`
+	AssertionResults []AssertionResult `json:"assertion_results,omitempty"`
+}
+
+var (
+	variablePattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+	variableName    = regexp.MustCompile(`^\w+$`)
+)
+
+// Replace {{name}} references with their values. Unknown names are left as is.
+func ExpandVariables(s string, vars map[string]string) string {
+	return variablePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := variablePattern.FindStringSubmatch(ref)[1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return ref
+	})
+}
+
+// Replace variable values with {{name}} references, so messages that quote an
+// expanded request don't reveal extracted tokens. Longer values are replaced
+// first so one that contains another is hidden whole.
+func RedactVariables(s string, vars map[string]string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int { return cmp.Compare(len(vars[b]), len(vars[a])) })
+	for _, name := range names {
+		if vars[name] != "" {
+			s = strings.ReplaceAll(s, vars[name], "{{"+name+"}}")
+		}
+	}
+	return s
+}
+
+// HTTP method to use for the step
+func (s TransactionStep) HTTPMethod() string {
+	if s.Method == "" {
+		return "GET"
+	}
+	return strings.ToUpper(s.Method)
+}
+
+// Check a transaction's steps are well formed and only use variables
+// extracted by an earlier step
+func validateSteps(steps []TransactionStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("transaction needs at least one step")
+	}
+	if len(steps) > MaxTransactionSteps {
+		return fmt.Errorf("transaction can have at most %d steps", MaxTransactionSteps)
+	}
+
+	defined := make(map[string]bool)
+	for i, step := range steps {
+		if err := step.validate(defined); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		for _, x := range step.Extract {
+			defined[x.Name] = true
+		}
+	}
+	return nil
+}
+
+func (s TransactionStep) validate(defined map[string]bool) error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	templates := []string{s.URL, s.Body}
+	for _, v := range s.Headers {
+		templates = append(templates, v)
+	}
+	for _, t := range templates {
+		for _, ref := range variablePattern.FindAllStringSubmatch(t, -1) {
+			if !defined[ref[1]] {
+				return fmt.Errorf("variable %q is not extracted by an earlier step", ref[1])
+			}
+		}
+	}
+
+	// Variables can only fill in part of the URL, so it must still parse
+	u, err := url.Parse(variablePattern.ReplaceAllString(s.URL, "x"))
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url must use http or https")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("url must include a host")
+	}
+
+	if s.Method != "" && strings.ContainsAny(s.Method, " \t\r\n/") {
+		return fmt.Errorf("invalid method %q", s.Method)
+	}
+	for _, r := range s.ExpectedStatus {
+		if r.Min < 100 || r.Max > 599 || r.Max < r.Min {
+			return fmt.Errorf("invalid expected status range %d-%d", r.Min, r.Max)
+		}
+	}
+	for i, a := range s.Assertions {
+		if err := a.Validate(); err != nil {
+			return fmt.Errorf("assertion %d: %w", i, err)
+		}
+	}
+	for _, x := range s.Extract {
+		if err := x.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Check an extraction is well formed
+func (x Extraction) Validate() error {
+	if !variableName.MatchString(x.Name) {
+		return fmt.Errorf("extraction name %q must only use letters, digits and underscores", x.Name)
+	}
+
+	switch x.Source {
+	case ExtractJSONPath:
+		if _, err := jsonpath.Compile(x.Expression); err != nil {
+			return fmt.Errorf("extraction %s: %w", x.Name, err)
+		}
+	case ExtractHeader:
+		if x.Expression == "" {
+			return fmt.Errorf("extraction %s needs a header name", x.Name)
+		}
+	case ExtractRegex:
+		if _, err := regexp.Compile(x.Expression); err != nil {
+			return fmt.Errorf("extraction %s has an invalid pattern: %w", x.Name, err)
+		}
+	default:
+		return fmt.Errorf("extraction %s has unknown source %q", x.Name, x.Source)
+	}
+	return nil
+}
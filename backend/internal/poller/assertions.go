@@ -0,0 +1,141 @@
+package poller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/jsonpath"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Only this much of a response body is kept for content assertions. The rest
+// is still read so max_body_size sees the full size.
+const maxAssertionBody = 1 << 20
+
+// What an assertion can be checked against
+type checkResponse struct {
+	header       http.Header
+	body         []byte
+	bodySize     int64                // Full size, even when body was truncated
+	certificates []models.Certificate // Peer chain for HTTPS checks
+	now          time.Time
+	readErr      error // Set when the body couldn't be read
+}
+
+// Run every assertion against a response and its body
+func evaluateAssertions(assertions []models.Assertion, resp checkResponse) []models.AssertionResult {
+	if len(assertions) == 0 {
+		return nil
+	}
+
+	// Parse the body at most once, and only if a JSONPath assertion needs it
+	var doc any
+	var docErr error
+	parsed := false
+
+	results := make([]models.AssertionResult, 0, len(assertions))
+	for _, a := range assertions {
+		if (a.Type == models.AssertJSONPathEquals || a.Type == models.AssertJSONPathExists) && !parsed {
+			docErr = json.Unmarshal(resp.body, &doc)
+			parsed = true
+		}
+
+		passed, message := evaluateAssertion(a, resp, doc, docErr)
+		results = append(results, models.AssertionResult{Assertion: a, Passed: passed, Message: message})
+	}
+	return results
+}
+
+// Evaluate a single assertion, returning whether it passed and why not
+func evaluateAssertion(a models.Assertion, resp checkResponse, doc any, docErr error) (bool, string) {
+	header, body, bodySize := resp.header, resp.body, resp.bodySize
+
+	switch a.Type {
+	case models.AssertContains:
+		if !strings.Contains(string(body), a.Value) {
+			return false, fmt.Sprintf("body does not contain %q", a.Value)
+		}
+	case models.AssertNotContains:
+		if strings.Contains(string(body), a.Value) {
+			return false, fmt.Sprintf("body contains %q", a.Value)
+		}
+	case models.AssertRegex:
+		re, err := regexp.Compile(a.Value)
+		if err != nil {
+			return false, fmt.Sprintf("invalid pattern: %v", err)
+		}
+		if !re.Match(body) {
+			return false, fmt.Sprintf("body does not match %q", a.Value)
+		}
+	case models.AssertJSONPathExists, models.AssertJSONPathEquals:
+		if docErr != nil {
+			return false, fmt.Sprintf("body is not valid JSON: %v", docErr)
+		}
+		value, err := jsonpath.Lookup(doc, a.Target)
+		if err != nil {
+			return false, fmt.Sprintf("%s: %v", a.Target, err)
+		}
+		if a.Type == models.AssertJSONPathEquals {
+			if got := jsonValueString(value); got != a.Value {
+				return false, fmt.Sprintf("%s is %s, expected %s", a.Target, got, a.Value)
+			}
+		}
+	case models.AssertHeaderPresent:
+		if _, ok := header[http.CanonicalHeaderKey(a.Target)]; !ok {
+			return false, fmt.Sprintf("header %s is missing", a.Target)
+		}
+	case models.AssertHeaderMatches:
+		values, ok := header[http.CanonicalHeaderKey(a.Target)]
+		if !ok {
+			return false, fmt.Sprintf("header %s is missing", a.Target)
+		}
+		re, err := regexp.Compile(a.Value)
+		if err != nil {
+			return false, fmt.Sprintf("invalid pattern: %v", err)
+		}
+		if !re.MatchString(strings.Join(values, ", ")) {
+			return false, fmt.Sprintf("header %s does not match %q", a.Target, a.Value)
+		}
+	case models.AssertMaxBodySize:
+		limit, err := strconv.ParseInt(a.Value, 10, 64)
+		if err != nil {
+			return false, fmt.Sprintf("invalid size %q", a.Value)
+		}
+		if bodySize > limit {
+			return false, fmt.Sprintf("body is %d bytes, limit is %d", bodySize, limit)
+		}
+	case models.AssertCertExpiry:
+		days, err := strconv.Atoi(a.Value)
+		if err != nil {
+			return false, fmt.Sprintf("invalid number of days %q", a.Value)
+		}
+		if len(resp.certificates) == 0 {
+			return false, "no TLS certificate was presented"
+		}
+		leaf := resp.certificates[0]
+		if remaining := leaf.NotAfter.Sub(resp.now); remaining < time.Duration(days)*24*time.Hour {
+			return false, fmt.Sprintf("certificate expires %s, within %d days", leaf.NotAfter.Format(time.RFC3339), days)
+		}
+	default:
+		return false, fmt.Sprintf("unknown assertion type %q", a.Type)
+	}
+	return true, ""
+}
+
+// Render a decoded JSON value for comparison. Strings compare as-is, anything
+// else as its JSON encoding, so 42, true and null match "42", "true" and "null".
+func jsonValueString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,92 @@
+package poller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestEvaluateAssertions(t *testing.T) {
+	header := http.Header{"Content-Type": {"application/json"}, "X-Version": {"v2.3.1"}}
+	body := []byte(`{"status":"ok","items":[{"id":7}],"healthy":true}`)
+
+	tests := []struct {
+		name      string
+		assertion models.Assertion
+		passed    bool
+	}{
+		{name: "contains", assertion: models.Assertion{Type: models.AssertContains, Value: `"ok"`}, passed: true},
+		{name: "contains missing", assertion: models.Assertion{Type: models.AssertContains, Value: "error"}, passed: false},
+		{name: "not contains", assertion: models.Assertion{Type: models.AssertNotContains, Value: "error"}, passed: true},
+		{name: "not contains present", assertion: models.Assertion{Type: models.AssertNotContains, Value: "status"}, passed: false},
+		{name: "regex", assertion: models.Assertion{Type: models.AssertRegex, Value: `"id":\d+`}, passed: true},
+		{name: "regex no match", assertion: models.Assertion{Type: models.AssertRegex, Value: `^<html`}, passed: false},
+		{name: "jsonpath equals string", assertion: models.Assertion{Type: models.AssertJSONPathEquals, Target: "$.status", Value: "ok"}, passed: true},
+		{name: "jsonpath equals number", assertion: models.Assertion{Type: models.AssertJSONPathEquals, Target: "$.items[0].id", Value: "7"}, passed: true},
+		{name: "jsonpath equals bool", assertion: models.Assertion{Type: models.AssertJSONPathEquals, Target: "$.healthy", Value: "false"}, passed: false},
+		{name: "jsonpath exists", assertion: models.Assertion{Type: models.AssertJSONPathExists, Target: "$.items"}, passed: true},
+		{name: "jsonpath missing", assertion: models.Assertion{Type: models.AssertJSONPathExists, Target: "$.errors"}, passed: false},
+		{name: "header present", assertion: models.Assertion{Type: models.AssertHeaderPresent, Target: "x-version"}, passed: true},
+		{name: "header missing", assertion: models.Assertion{Type: models.AssertHeaderPresent, Target: "X-Trace"}, passed: false},
+		{name: "header matches", assertion: models.Assertion{Type: models.AssertHeaderMatches, Target: "X-Version", Value: `^v2\.`}, passed: true},
+		{name: "header does not match", assertion: models.Assertion{Type: models.AssertHeaderMatches, Target: "X-Version", Value: `^v3\.`}, passed: false},
+		{name: "body within size", assertion: models.Assertion{Type: models.AssertMaxBodySize, Value: "1024"}, passed: true},
+		{name: "body too large", assertion: models.Assertion{Type: models.AssertMaxBodySize, Value: "10"}, passed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := evaluateAssertions([]models.Assertion{tt.assertion}, checkResponse{header: header, body: body, bodySize: int64(len(body))})
+			if len(results) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(results))
+			}
+			if results[0].Passed != tt.passed {
+				t.Errorf("expected passed=%v, got %+v", tt.passed, results[0])
+			}
+			if !results[0].Passed && results[0].Message == "" {
+				t.Error("expected a failure message")
+			}
+		})
+	}
+}
+
+func TestJSONPathAssertionOnNonJSONBody(t *testing.T) {
+	results := evaluateAssertions(
+		[]models.Assertion{{Type: models.AssertJSONPathExists, Target: "$.status"}},
+		checkResponse{header: http.Header{}, body: []byte("<html>error</html>"), bodySize: 18},
+	)
+	if results[0].Passed {
+		t.Error("expected JSONPath assertion to fail on an HTML body")
+	}
+}
+
+func TestCheckEndpointFailsHealthyStatusWithFailingAssertion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>Internal error</html>"))
+	}))
+	defer server.Close()
+
+	ep := models.MonitoredEndpoint{
+		ID:  uuid.New(),
+		URL: server.URL,
+		Assertions: []models.Assertion{
+			{Type: models.AssertNotContains, Value: "error"},
+			{Type: models.AssertMaxBodySize, Value: "4096"},
+		},
+	}
+
+	metric := checkEndpoint(ep, http.DefaultTransport)
+
+	if metric.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", metric.StatusCode)
+	}
+	if metric.Success {
+		t.Error("expected the check to fail on the assertion")
+	}
+	if len(metric.AssertionResults) != 2 || metric.AssertionResults[0].Passed || !metric.AssertionResults[1].Passed {
+		t.Errorf("unexpected assertion results: %+v", metric.AssertionResults)
+	}
+}
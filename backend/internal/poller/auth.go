@@ -0,0 +1,191 @@
+package poller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+const (
+	// Lifetime assumed for tokens issued without expires_in
+	defaultTokenLifetime = 5 * time.Minute
+	// Tokens are refreshed this long before they expire
+	tokenExpiryMargin = 30 * time.Second
+	tokenTimeout      = 10 * time.Second
+)
+
+// Applies auth profiles to checks, caching OAuth2 tokens until they expire
+type authenticator struct {
+	mu      sync.Mutex
+	tokens  map[[sha256.Size]byte]cachedToken
+	fetches map[[sha256.Size]byte]*tokenFetch // In flight, so checks sharing a profile wait for one request
+}
+
+type cachedToken struct {
+	value   string
+	expires time.Time
+}
+
+// Token request shared by every check that needs it while it runs
+type tokenFetch struct {
+	done  chan struct{} // Closed once value and err are set
+	value string
+	err   error
+}
+
+func newAuthenticator() *authenticator {
+	return &authenticator{
+		tokens:  make(map[[sha256.Size]byte]cachedToken),
+		fetches: make(map[[sha256.Size]byte]*tokenFetch),
+	}
+}
+
+// Copy of the endpoint with the profile's Authorization header added. Mutual
+// TLS is applied by the transport instead, so leaves the endpoint unchanged.
+func (a *authenticator) apply(ctx context.Context, ep models.MonitoredEndpoint, profile *models.AuthProfile, transport http.RoundTripper) (models.MonitoredEndpoint, error) {
+	if profile == nil {
+		return ep, nil
+	}
+
+	var authorization string
+	switch profile.Type {
+	case models.AuthBasic:
+		authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(profile.Username+":"+profile.Password))
+	case models.AuthBearer:
+		authorization = "Bearer " + profile.Token
+	case models.AuthClientCredentials:
+		token, err := a.token(ctx, *profile, transport)
+		if err != nil {
+			return ep, err
+		}
+		authorization = "Bearer " + token
+	default:
+		return ep, nil
+	}
+
+	headers := maps.Clone(ep.Headers)
+	if headers == nil {
+		headers = make(map[string]string, 1)
+	}
+	headers["Authorization"] = authorization
+	ep.Headers = headers
+	return ep, nil
+}
+
+// Forget a profile's cached token, such as after the API rejected it
+func (a *authenticator) invalidate(profile *models.AuthProfile) {
+	if profile == nil || profile.Type != models.AuthClientCredentials {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.tokens, tokenKey(*profile))
+}
+
+// Return a cached client credentials token or fetch a new one. Checks that
+// need a token already being fetched wait for that request instead of making
+// their own.
+func (a *authenticator) token(ctx context.Context, profile models.AuthProfile, transport http.RoundTripper) (string, error) {
+	key := tokenKey(profile)
+
+	a.mu.Lock()
+	if cached, ok := a.tokens[key]; ok && time.Now().Before(cached.expires) {
+		a.mu.Unlock()
+		return cached.value, nil
+	}
+	if f, ok := a.fetches[key]; ok {
+		a.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.value, f.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	f := &tokenFetch{done: make(chan struct{})}
+	a.fetches[key] = f
+	a.mu.Unlock()
+
+	// Other checks are waiting on the request, so it isn't cancelled with
+	// this one. It still times out.
+	token, lifetime, err := fetchToken(context.WithoutCancel(ctx), profile, transport)
+
+	a.mu.Lock()
+	delete(a.fetches, key)
+	if err == nil {
+		a.tokens[key] = cachedToken{value: token, expires: time.Now().Add(lifetime - tokenExpiryMargin)}
+	}
+	a.mu.Unlock()
+
+	f.value, f.err = token, err
+	close(f.done)
+	return token, err
+}
+
+// Cache key covering every setting that affects the token, so editing a
+// profile fetches a new one
+func tokenKey(p models.AuthProfile) [sha256.Size]byte {
+	return sha256.Sum256([]byte(strings.Join([]string{p.TokenURL, p.ClientID, p.ClientSecret, strings.Join(p.Scopes, " ")}, "\n")))
+}
+
+// Request a token with the OAuth2 client credentials grant
+func fetchToken(ctx context.Context, profile models.AuthProfile, transport http.RoundTripper) (string, time.Duration, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(profile.Scopes) > 0 {
+		form.Set("scope", strings.Join(profile.Scopes, " "))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tokenTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, profile.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(profile.ClientID), url.QueryEscape(profile.ClientSecret))
+
+	client := http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("reading token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", 0, fmt.Errorf("decoding token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", 0, fmt.Errorf("token response has no access_token")
+	}
+
+	lifetime := defaultTokenLifetime
+	if token.ExpiresIn > 0 {
+		lifetime = time.Duration(token.ExpiresIn) * time.Second
+	}
+	return token.AccessToken, lifetime, nil
+}
@@ -0,0 +1,251 @@
+package poller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestAuthenticatorStaticCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  models.AuthProfile
+		expected string
+	}{
+		{name: "basic", profile: models.AuthProfile{Type: models.AuthBasic, Username: "user", Password: "pass"}, expected: "Basic dXNlcjpwYXNz"},
+		{name: "bearer", profile: models.AuthProfile{Type: models.AuthBearer, Token: "abc123"}, expected: "Bearer abc123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := models.MonitoredEndpoint{Headers: map[string]string{"Accept": "application/json"}}
+
+			authed, err := newAuthenticator().apply(context.Background(), ep, &tt.profile, http.DefaultTransport)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := authed.Headers["Authorization"]; got != tt.expected {
+				t.Errorf("expected Authorization %q, got %q", tt.expected, got)
+			}
+			if _, ok := ep.Headers["Authorization"]; ok {
+				t.Error("expected the original endpoint headers to be left unchanged")
+			}
+		})
+	}
+}
+
+func TestAuthenticatorCachesClientCredentialsToken(t *testing.T) {
+	var fetches atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if r.FormValue("grant_type") != "client_credentials" || id != "client" || secret != "s3cret" || r.FormValue("scope") != "read write" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fetches.Add(1)
+		w.Write([]byte(`{"access_token":"token-1","token_type":"bearer","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	profile := &models.AuthProfile{
+		Type:         models.AuthClientCredentials,
+		TokenURL:     tokenServer.URL,
+		ClientID:     "client",
+		ClientSecret: "s3cret",
+		Scopes:       []string{"read", "write"},
+	}
+	a := newAuthenticator()
+
+	for range 3 {
+		authed, err := a.apply(context.Background(), models.MonitoredEndpoint{}, profile, http.DefaultTransport)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := authed.Headers["Authorization"]; got != "Bearer token-1" {
+			t.Fatalf("expected the fetched token to be used, got %q", got)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("expected the token to be fetched once, got %d", n)
+	}
+
+	a.invalidate(profile)
+	if _, err := a.apply(context.Background(), models.MonitoredEndpoint{}, profile, http.DefaultTransport); err != nil {
+		t.Fatal(err)
+	}
+	if n := fetches.Load(); n != 2 {
+		t.Errorf("expected an invalidated token to be fetched again, got %d fetches", n)
+	}
+}
+
+func TestSchedulerReportsAuthFailures(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer tokenServer.Close()
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	profileID := uuid.New()
+	var loads atomic.Int32
+	mock := &db.MockDBClient{
+		GetAuthProfileFunc: func(id uuid.UUID) (models.AuthProfile, error) {
+			loads.Add(1)
+			if id != profileID {
+				return models.AuthProfile{}, db.ErrNotFound
+			}
+			return models.AuthProfile{ID: id, Type: models.AuthClientCredentials, TokenURL: tokenServer.URL, ClientID: "client", ClientSecret: "wrong"}, nil
+		},
+	}
+	s := NewScheduler(mock, hub.New(hub.DefaultBufferSize), DefaultLimits)
+	defer s.Stop()
+
+	missing := uuid.New()
+	for _, id := range []uuid.UUID{profileID, missing} {
+		loads.Store(0)
+		ep := models.MonitoredEndpoint{ID: uuid.New(), URL: server.URL, AuthProfileID: &id, Retry: models.RetryPolicy{Retries: 2}}
+		metric, ok := s.checkWithRetries(context.Background(), ep)
+		if !ok {
+			t.Fatal("expected the check to run")
+		}
+		if metric.FailureReason != models.FailureAuth {
+			t.Errorf("expected %q, got %q (%s)", models.FailureAuth, metric.FailureReason, metric.ErrorMessage)
+		}
+		if n := loads.Load(); n != 1 {
+			t.Errorf("expected the profile to be loaded once for every attempt, got %d loads", n)
+		}
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("expected the endpoint not to be requested without credentials, got %d requests", n)
+	}
+}
+
+func TestAuthenticatorSharesTokenFetches(t *testing.T) {
+	var fetches atomic.Int32
+	release := make(chan struct{})
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		<-release
+		w.Write([]byte(`{"access_token":"token-1","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	profile := &models.AuthProfile{Type: models.AuthClientCredentials, TokenURL: tokenServer.URL, ClientID: "client", ClientSecret: "s3cret"}
+	a := newAuthenticator()
+
+	// Checks sharing a profile start while the first token request is running
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			authed, err := a.apply(context.Background(), models.MonitoredEndpoint{}, profile, http.DefaultTransport)
+			if err == nil && authed.Headers["Authorization"] != "Bearer token-1" {
+				err = fmt.Errorf("expected the fetched token to be used, got %q", authed.Headers["Authorization"])
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("expected one token request for every check, got %d", n)
+	}
+}
+
+func TestTransportPoolClientCertificate(t *testing.T) {
+	certPEM, keyPEM := generateClientCert(t)
+	block, _ := pem.Decode([]byte(certPEM))
+	clientCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	profile := &models.AuthProfile{Type: models.AuthMTLS, ClientCert: certPEM, ClientKey: keyPEM}
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: server.URL, TLSSkipVerify: true}
+	pool := newTransportPool(DefaultLimits)
+
+	transport, err := pool.get(ep, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metric := checkEndpoint(ep, transport); metric.FailureReason == models.FailureNone {
+		t.Error("expected the server to reject a check without a client certificate")
+	}
+
+	transport, err = pool.get(ep, profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metric := checkEndpoint(ep, transport); metric.FailureReason != models.FailureNone {
+		t.Errorf("expected the client certificate to be accepted, got %q (%s)", metric.FailureReason, metric.ErrorMessage)
+	}
+}
+
+// Self-signed client certificate and key, PEM encoded
+func generateClientCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pulseboard-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
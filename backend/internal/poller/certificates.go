@@ -0,0 +1,89 @@
+package poller
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Describe a peer certificate chain for storage
+func describeChain(ep models.MonitoredEndpoint, chain []*x509.Certificate, checkedAt time.Time) []models.Certificate {
+	if len(chain) == 0 {
+		return nil
+	}
+
+	host := ""
+	if u, err := url.Parse(ep.URL); err == nil {
+		host = u.Hostname()
+	}
+
+	certs := make([]models.Certificate, 0, len(chain))
+	for i, c := range chain {
+		certs = append(certs, models.Certificate{
+			EndpointID:       ep.ID,
+			URL:              ep.URL,
+			Position:         i,
+			Subject:          c.Subject.String(),
+			SANs:             subjectAltNames(c),
+			Issuer:           c.Issuer.String(),
+			NotBefore:        c.NotBefore,
+			NotAfter:         c.NotAfter,
+			KeyType:          keyType(c),
+			HostnameVerified: i == 0 && host != "" && c.VerifyHostname(host) == nil,
+			CheckedAt:        checkedAt,
+		})
+	}
+	return certs
+}
+
+// Recover the certificate from a failed verification so expired or mismatched
+// certificates are still recorded
+func certificatesFromError(err error) []*x509.Certificate {
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &hostnameErr) && hostnameErr.Certificate != nil {
+		return []*x509.Certificate{hostnameErr.Certificate}
+	}
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &invalidErr) && invalidErr.Cert != nil {
+		return []*x509.Certificate{invalidErr.Cert}
+	}
+	var authorityErr x509.UnknownAuthorityError
+	if errors.As(err, &authorityErr) && authorityErr.Cert != nil {
+		return []*x509.Certificate{authorityErr.Cert}
+	}
+	return nil
+}
+
+func subjectAltNames(c *x509.Certificate) []string {
+	sans := append([]string{}, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, email := range c.EmailAddresses {
+		sans = append(sans, email)
+	}
+	for _, uri := range c.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+func keyType(c *x509.Certificate) string {
+	switch key := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return c.PublicKeyAlgorithm.String()
+	}
+}
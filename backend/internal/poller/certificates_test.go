@@ -0,0 +1,70 @@
+package poller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestCheckEndpointCapturesCertificateChain(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	ep := models.MonitoredEndpoint{
+		ID:  uuid.New(),
+		URL: server.URL,
+		Assertions: []models.Assertion{
+			{Type: models.AssertCertExpiry, Value: "30"},
+		},
+	}
+	metric := checkEndpoint(ep, server.Client().Transport)
+
+	if len(metric.Certificates) == 0 {
+		t.Fatal("expected the peer certificate chain to be captured")
+	}
+	leaf := metric.Certificates[0]
+	if leaf.EndpointID != ep.ID || leaf.Position != 0 {
+		t.Errorf("unexpected leaf certificate: %+v", leaf)
+	}
+	if leaf.KeyType == "" || leaf.Issuer == "" || len(leaf.SANs) == 0 {
+		t.Errorf("expected key type, issuer and SANs, got %+v", leaf)
+	}
+	if !leaf.HostnameVerified {
+		t.Error("expected the test server certificate to verify for 127.0.0.1")
+	}
+	// The httptest certificate is valid for years, so a 30 day window passes
+	if !metric.Success || !metric.AssertionResults[0].Passed {
+		t.Errorf("expected cert_expiry to pass, got %+v", metric.AssertionResults)
+	}
+}
+
+func TestCertExpiryAssertion(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	certs := []models.Certificate{{NotAfter: now.Add(10 * 24 * time.Hour)}}
+
+	tests := []struct {
+		days   string
+		certs  []models.Certificate
+		passed bool
+	}{
+		{days: "7", certs: certs, passed: true},
+		{days: "14", certs: certs, passed: false},
+		{days: "7", certs: nil, passed: false},
+	}
+
+	for _, tt := range tests {
+		results := evaluateAssertions(
+			[]models.Assertion{{Type: models.AssertCertExpiry, Value: tt.days}},
+			checkResponse{certificates: tt.certs, now: now},
+		)
+		if results[0].Passed != tt.passed {
+			t.Errorf("days=%s certs=%d: expected passed=%v, got %+v", tt.days, len(tt.certs), tt.passed, results[0])
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package poller
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+var errTooManyRedirects = errors.New("too many redirects")
+
+// Redirect policy for an endpoint. Every redirect target is appended to chain.
+// Exceeding the limit fails with a recognisable error instead of the standard
+// library's plain message, and with NoRedirects the redirect response itself
+// is returned.
+func redirectPolicy(ep models.MonitoredEndpoint, chain *[]string) func(*http.Request, []*http.Request) error {
+	limit := ep.RedirectLimit()
+	return func(req *http.Request, via []*http.Request) error {
+		*chain = append(*chain, req.URL.String())
+		if ep.NoRedirects {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > limit {
+			return errTooManyRedirects
+		}
+		return nil
+	}
+}
+
+// Work out why a request failed from the error returned by the client
+func classifyError(err error) models.FailureReason {
+	if err == nil {
+		return models.FailureNone
+	}
+
+	if errors.Is(err, errTooManyRedirects) {
+		return models.FailureTooManyRedirects
+	}
+	if errors.Is(err, errUnexpectedResponse) {
+		return models.FailureUnexpectedResponse
+	}
+	if errors.Is(err, errTLSVersion) {
+		return models.FailureTLS
+	}
+
+	// DNS errors come first since a resolver timeout is also a net.Error timeout
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return models.FailureDNS
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return models.FailureTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return models.FailureTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return models.FailureConnectionRefused
+	}
+	if errors.Is(err, syscall.ECONNRESET) {
+		return models.FailureConnectionReset
+	}
+
+	if isTLSError(err) {
+		return models.FailureTLS
+	}
+
+	if strings.Contains(err.Error(), "unsupported protocol scheme") {
+		return models.FailureInvalidRequest
+	}
+
+	return models.FailureNetwork
+}
+
+func isTLSError(err error) bool {
+	var (
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		verifyErr    *tls.CertificateVerificationError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		authorityErr x509.UnknownAuthorityError
+	)
+	return errors.As(err, &recordErr) || errors.As(err, &alertErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) || errors.As(err, &authorityErr) ||
+		strings.Contains(err.Error(), "tls: ")
+}
@@ -0,0 +1,73 @@
+package poller
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestCheckEndpointClassifiesFailures(t *testing.T) {
+	redirectLoop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path, http.StatusFound)
+	}))
+	defer redirectLoop.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(10 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	// Grab a free port and close it so the connection is refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refusedURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		expected models.FailureReason
+	}{
+		{name: "invalid url", url: "http://bad host/", expected: models.FailureInvalidRequest},
+		{name: "unsupported scheme", url: "ftp://example.com", expected: models.FailureInvalidRequest},
+		{name: "dns failure", url: "http://pulseboard.invalid", expected: models.FailureDNS},
+		{name: "connection refused", url: refusedURL, expected: models.FailureConnectionRefused},
+		{name: "too many redirects", url: redirectLoop.URL, expected: models.FailureTooManyRedirects},
+		{name: "untrusted certificate", url: tlsServer.URL, expected: models.FailureTLS},
+		{name: "unexpected status", url: notFound.URL, expected: models.FailureUnexpectedStatus},
+		{name: "timeout", url: slow.URL, expected: models.FailureTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := models.MonitoredEndpoint{ID: uuid.New(), URL: tt.url}
+			metric := checkEndpoint(ep, http.DefaultTransport)
+
+			if metric.FailureReason != tt.expected {
+				t.Errorf("expected %q, got %q (%s)", tt.expected, metric.FailureReason, metric.ErrorMessage)
+			}
+			if metric.Success || metric.ErrorMessage == "" {
+				t.Errorf("expected a failed metric with a message, got %+v", metric)
+			}
+			if metric.EndpointID != ep.ID || metric.ID == uuid.Nil {
+				t.Error("expected failed metrics to keep the endpoint ID")
+			}
+		})
+	}
+}
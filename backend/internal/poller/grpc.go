@@ -0,0 +1,112 @@
+package poller
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Call grpc.health.v1.Health/Check on a grpc:// or grpcs:// endpoint, sending
+// its headers as metadata. The check passes when the server reports SERVING.
+// config holds the endpoint's TLS settings for grpcs, nil for the defaults.
+func checkGRPC(ep models.MonitoredEndpoint, config *tls.Config) models.Metric {
+	u, err := url.Parse(ep.URL)
+	if err != nil {
+		return failedMetric(ep, models.FailureInvalidRequest, err)
+	}
+
+	creds := insecure.NewCredentials()
+	if u.Scheme == "grpcs" {
+		if config == nil {
+			config = &tls.Config{}
+		}
+		creds = credentials.NewTLS(config)
+	}
+
+	conn, err := grpc.NewClient(hostPort(ep, "443"), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return failedMetric(ep, models.FailureInvalidRequest, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ep.Timeout())
+	defer cancel()
+	if len(ep.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(ep.Headers))
+	}
+
+	// The connection is made during the call, so its latency includes
+	// connecting and any TLS handshake
+	start := time.Now()
+	var p peer.Peer
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: ep.GRPCService}, grpc.Peer(&p))
+
+	health := ""
+	switch {
+	case err == nil:
+		health = resp.GetStatus().String()
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			err = fmt.Errorf("%w: health status is %s", errUnexpectedResponse, health)
+		}
+	case status.Code(err) == codes.NotFound:
+		// Servers answer Check for a service they don't know with NotFound
+		health = healthpb.HealthCheckResponse_SERVICE_UNKNOWN.String()
+	}
+
+	metric := networkMetric(ep, start, models.PhaseTimings{}, err)
+	metric.GRPCStatus = health
+	if err != nil && !errors.Is(err, errUnexpectedResponse) {
+		metric.FailureReason = classifyGRPCError(err)
+	}
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		metric.TLSVersion = tls.VersionName(info.State.Version)
+		metric.Certificates = describeChain(ep, info.State.PeerCertificates, start)
+	}
+	return metric
+}
+
+// Work out why a gRPC call failed from its status code. Connection failures
+// all come back as Unavailable, so those are told apart by their message.
+func classifyGRPCError(err error) models.FailureReason {
+	s, ok := status.FromError(err)
+	if !ok {
+		return classifyError(err)
+	}
+
+	switch s.Code() {
+	case codes.DeadlineExceeded:
+		return models.FailureTimeout
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return models.FailureAuth
+	case codes.NotFound, codes.Unimplemented:
+		return models.FailureUnexpectedResponse
+	case codes.Unavailable:
+		message := s.Message()
+		switch {
+		case strings.Contains(message, "no such host"):
+			return models.FailureDNS
+		case strings.Contains(message, "connection refused"):
+			return models.FailureConnectionRefused
+		case strings.Contains(message, "connection reset"):
+			return models.FailureConnectionReset
+		case strings.Contains(message, "tls:"), strings.Contains(message, "x509:"):
+			return models.FailureTLS
+		}
+	}
+	return models.FailureNetwork
+}
@@ -0,0 +1,128 @@
+package poller
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Start an in-process health server. "orders" is serving, "billing" isn't,
+// and calls naming "private" need an authorization token.
+func healthServer(t *testing.T, opts ...grpc.ServerOption) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requireToken := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if r, ok := req.(*healthpb.HealthCheckRequest); ok && r.Service == "private" {
+			md, _ := metadata.FromIncomingContext(ctx)
+			if got := md.Get("authorization"); len(got) != 1 || got[0] != "Bearer s3cret" {
+				return nil, status.Error(codes.Unauthenticated, "missing token")
+			}
+		}
+		return handler(ctx, req)
+	}
+
+	server := grpc.NewServer(append(opts, grpc.UnaryInterceptor(requireToken))...)
+	hs := health.NewServer()
+	hs.SetServingStatus("orders", healthpb.HealthCheckResponse_SERVING)
+	hs.SetServingStatus("billing", healthpb.HealthCheckResponse_NOT_SERVING)
+	hs.SetServingStatus("private", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, hs)
+
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+	return ln.Addr().String()
+}
+
+func TestCheckGRPC(t *testing.T) {
+	addr := healthServer(t)
+
+	tests := []struct {
+		name     string
+		service  string
+		headers  map[string]string
+		reason   models.FailureReason
+		expected string
+	}{
+		{name: "whole server", reason: models.FailureNone, expected: "SERVING"},
+		{name: "serving service", service: "orders", reason: models.FailureNone, expected: "SERVING"},
+		{name: "service not serving", service: "billing", reason: models.FailureUnexpectedResponse, expected: "NOT_SERVING"},
+		{name: "unknown service", service: "shipping", reason: models.FailureUnexpectedResponse, expected: "SERVICE_UNKNOWN"},
+		{name: "metadata sent", service: "private", headers: map[string]string{"Authorization": "Bearer s3cret"}, reason: models.FailureNone, expected: "SERVING"},
+		{name: "metadata missing", service: "private", reason: models.FailureAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := models.MonitoredEndpoint{ID: uuid.New(), Type: models.CheckGRPC, URL: "grpc://" + addr, GRPCService: tt.service, Headers: tt.headers}
+
+			metric := checkGRPC(ep, nil)
+			if metric.FailureReason != tt.reason || metric.Success != (tt.reason == models.FailureNone) {
+				t.Errorf("expected %q, got %q (%s)", tt.reason, metric.FailureReason, metric.ErrorMessage)
+			}
+			if metric.GRPCStatus != tt.expected {
+				t.Errorf("expected status %q, got %q", tt.expected, metric.GRPCStatus)
+			}
+		})
+	}
+}
+
+func TestCheckGRPCOverTLS(t *testing.T) {
+	// Borrow httptest's certificate, which is valid for 127.0.0.1
+	certServer := httptest.NewTLSServer(nil)
+	certServer.Close()
+	caBundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certServer.Certificate().Raw}))
+	creds := credentials.NewTLS(&tls.Config{Certificates: certServer.TLS.Certificates})
+
+	addr := healthServer(t, grpc.Creds(creds))
+	ep := models.MonitoredEndpoint{ID: uuid.New(), Type: models.CheckGRPC, URL: "grpcs://" + addr, CABundle: caBundle}
+
+	config, err := tlsConfig(ep, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metric := checkGRPC(ep, config)
+	if !metric.Success || metric.GRPCStatus != "SERVING" {
+		t.Fatalf("expected the TLS health check to pass, got %q (%s)", metric.FailureReason, metric.ErrorMessage)
+	}
+	if metric.TLSVersion == "" || len(metric.Certificates) == 0 {
+		t.Errorf("expected the TLS version and certificate to be recorded, got %q and %d certificates", metric.TLSVersion, len(metric.Certificates))
+	}
+
+	// Without the CA the server's certificate isn't trusted
+	metric = checkGRPC(ep, nil)
+	if metric.FailureReason != models.FailureTLS {
+		t.Errorf("expected %q, got %q (%s)", models.FailureTLS, metric.FailureReason, metric.ErrorMessage)
+	}
+}
+
+func TestCheckGRPCConnectionRefused(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	metric := checkGRPC(models.MonitoredEndpoint{ID: uuid.New(), Type: models.CheckGRPC, URL: "grpc://" + addr}, nil)
+	if metric.FailureReason != models.FailureConnectionRefused {
+		t.Errorf("expected %q, got %q (%s)", models.FailureConnectionRefused, metric.FailureReason, metric.ErrorMessage)
+	}
+}
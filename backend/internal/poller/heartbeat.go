@@ -0,0 +1,49 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Record a missed ping each time a heartbeat monitor's deadline passes, then
+// wait a further period. Each ping restarts the loop through Update, so it
+// only ever waits on the latest ping.
+func (s *Scheduler) watch(ctx context.Context, ep models.MonitoredEndpoint) {
+	deadline := ep.PingDeadline(time.Now())
+	// Consecutive missed pings, for confirming failures
+	missed := 0
+
+	for sleep(ctx, time.Until(deadline)) {
+		missed++
+		metric := missedPing(ep, deadline)
+		metric.Unconfirmed = missed < ep.Retry.ConfirmAfter
+		log.Printf("%s | missed ping due %s\n", ep.URL, deadline.Format(time.RFC3339))
+		s.record(ep, metric)
+
+		// Counted from now so a monitor that has been silent a long time,
+		// such as across a restart, records one miss rather than a backlog
+		deadline = time.Now().Add(ep.Frequency)
+	}
+}
+
+func missedPing(ep models.MonitoredEndpoint, deadline time.Time) models.Metric {
+	message := fmt.Sprintf("no ping by %s", deadline.Format(time.RFC3339))
+	if ep.RunningSince != nil {
+		message = fmt.Sprintf("job started at %s didn't finish by %s", ep.RunningSince.Format(time.RFC3339), deadline.Format(time.RFC3339))
+	}
+	return models.Metric{
+		ID:            uuid.New(),
+		EndpointID:    ep.ID,
+		Timestamp:     time.Now().Truncate(time.Millisecond), // Match the precision stored in the DB
+		URL:           ep.URL,
+		Attempts:      1,
+		FailureReason: models.FailureMissedPing,
+		ErrorMessage:  message,
+	}
+}
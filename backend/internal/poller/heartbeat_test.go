@@ -0,0 +1,49 @@
+package poller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestSchedulerRecordsMissedPings(t *testing.T) {
+	mock, stored := recordingDB()
+	s := NewScheduler(mock, hub.New(hub.DefaultBufferSize), DefaultLimits)
+	defer s.Stop()
+
+	// Last pinged long enough ago that the next ping is already overdue
+	lastPing := time.Now().Add(-2 * time.Hour)
+	ep := models.MonitoredEndpoint{
+		ID:        uuid.New(),
+		Type:      models.CheckHeartbeat,
+		URL:       "/ping/abc123",
+		Frequency: time.Hour,
+		PingState: models.PingState{LastPingAt: &lastPing},
+	}
+	s.Add(ep)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(stored()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected an overdue ping to be recorded as missed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	metrics := stored()
+	if len(metrics) != 1 || metrics[0].Success || metrics[0].FailureReason != models.FailureMissedPing || metrics[0].EndpointID != ep.ID {
+		t.Errorf("expected one missed ping, got %+v", metrics)
+	}
+
+	// A ping restarts the wait from the new ping
+	now := time.Now()
+	ep.LastPingAt = &now
+	s.Update(ep)
+	time.Sleep(50 * time.Millisecond)
+	if len(stored()) != 1 {
+		t.Errorf("expected no further misses after a ping, got %d", len(stored()))
+	}
+}
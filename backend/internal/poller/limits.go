@@ -0,0 +1,131 @@
+package poller
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Limits bounds how many checks run at once
+type Limits struct {
+	MaxConcurrent int // Checks running at once across every endpoint
+	MaxPerHost    int // Checks running at once against one host, 0 for no limit
+}
+
+var DefaultLimits = Limits{MaxConcurrent: 50}
+
+// Hands out check slots, counting checks that had to wait for one
+type limiter struct {
+	limits Limits
+	global chan struct{}
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+
+	inFlight   atomic.Int64
+	checksRun  atomic.Int64
+	delayed    atomic.Int64
+	delayNanos atomic.Int64
+}
+
+func newLimiter(limits Limits) *limiter {
+	if limits.MaxConcurrent <= 0 {
+		limits.MaxConcurrent = DefaultLimits.MaxConcurrent
+	}
+	return &limiter{
+		limits: limits,
+		global: make(chan struct{}, limits.MaxConcurrent),
+		hosts:  make(map[string]chan struct{}),
+	}
+}
+
+// Wait for a slot to check rawURL. Returns false if ctx is cancelled first,
+// otherwise a func that must be called once the check is done.
+func (l *limiter) acquire(ctx context.Context, rawURL string) (func(), bool) {
+	start := time.Now()
+	waited := false
+
+	// Take the host slot first so a check queued behind its host doesn't hold
+	// a global slot other hosts could use
+	var host chan struct{}
+	if l.limits.MaxPerHost > 0 {
+		host = l.hostSlots(rawURL)
+		if !take(ctx, host, &waited) {
+			return nil, false
+		}
+	}
+	if !take(ctx, l.global, &waited) {
+		if host != nil {
+			<-host
+		}
+		return nil, false
+	}
+
+	l.checksRun.Add(1)
+	if waited {
+		l.delayed.Add(1)
+		l.delayNanos.Add(int64(time.Since(start)))
+	}
+	l.inFlight.Add(1)
+
+	return func() {
+		l.inFlight.Add(-1)
+		<-l.global
+		if host != nil {
+			<-host
+		}
+	}, true
+}
+
+// Take a slot from sem, recording in waited if it wasn't free straight away
+func take(ctx context.Context, sem chan struct{}, waited *bool) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+	}
+
+	*waited = true
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *limiter) hostSlots(rawURL string) chan struct{} {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = strings.ToLower(u.Host)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sem, ok := l.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, l.limits.MaxPerHost)
+		l.hosts[host] = sem
+	}
+	return sem
+}
+
+func (l *limiter) stats() models.PollerStats {
+	stats := models.PollerStats{
+		MaxConcurrent: l.limits.MaxConcurrent,
+		MaxPerHost:    l.limits.MaxPerHost,
+		InFlight:      int(l.inFlight.Load()),
+		ChecksRun:     l.checksRun.Load(),
+		ChecksDelayed: l.delayed.Load(),
+	}
+	if stats.ChecksDelayed > 0 {
+		stats.AvgDelayMS = time.Duration(l.delayNanos.Load() / stats.ChecksDelayed).Milliseconds()
+	}
+	return stats
+}
@@ -0,0 +1,64 @@
+package poller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiterCountsDelayedChecks(t *testing.T) {
+	l := newLimiter(Limits{MaxConcurrent: 1})
+
+	release, ok := l.acquire(context.Background(), "https://a.example.com")
+	if !ok {
+		t.Fatal("expected the first check to get a slot")
+	}
+
+	acquired := make(chan func())
+	go func() {
+		r, _ := l.acquire(context.Background(), "https://b.example.com")
+		acquired <- r
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected the second check to wait for the global limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	(<-acquired)()
+
+	stats := l.stats()
+	if stats.ChecksRun != 2 || stats.ChecksDelayed != 1 || stats.InFlight != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if stats.AvgDelayMS < 50 {
+		t.Errorf("expected the delay to be recorded, got %dms", stats.AvgDelayMS)
+	}
+}
+
+func TestLimiterPerHostLimit(t *testing.T) {
+	l := newLimiter(Limits{MaxConcurrent: 10, MaxPerHost: 1})
+
+	release, _ := l.acquire(context.Background(), "https://a.example.com/one")
+
+	// Another host is unaffected
+	other, ok := l.acquire(context.Background(), "https://b.example.com")
+	if !ok {
+		t.Fatal("expected a different host to get a slot")
+	}
+	other()
+
+	// The same host has to wait, and gives up when cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, ok := l.acquire(ctx, "https://A.example.com/two"); ok {
+		t.Fatal("expected the same host to wait for its slot")
+	}
+
+	release()
+	if stats := l.stats(); stats.InFlight != 0 || len(l.global) != 0 {
+		t.Errorf("expected every slot to be released, got %+v", stats)
+	}
+}
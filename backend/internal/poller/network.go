@@ -0,0 +1,301 @@
+package poller
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Most of a TCP banner read while matching it
+const maxBanner = 4096
+
+var (
+	errUnexpectedResponse = errors.New("unexpected response")
+	errTLSVersion         = errors.New("tls version below minimum")
+)
+
+// Connect to a tcp:// endpoint and, if it has a banner pattern, wait for the
+// server to send a banner matching it
+func checkTCP(ep models.MonitoredEndpoint) models.Metric {
+	ctx, cancel := context.WithTimeout(context.Background(), ep.Timeout())
+	defer cancel()
+
+	start := time.Now()
+	conn, timings, err := dial(ctx, hostPort(ep, ""))
+	if err != nil || ep.BannerMatch == "" {
+		if conn != nil {
+			conn.Close()
+		}
+		return networkMetric(ep, start, timings, err)
+	}
+	defer conn.Close()
+
+	re, err := regexp.Compile(ep.BannerMatch)
+	if err != nil {
+		return failedMetric(ep, models.FailureInvalidRequest, err)
+	}
+
+	deadline, _ := ctx.Deadline()
+	conn.SetReadDeadline(deadline)
+	connected := time.Now()
+	banner, firstByte, err := readBanner(conn, re)
+	timings.TTFBMS = elapsedMS(connected, firstByte)
+	timings.TransferMS = elapsedMS(firstByte, time.Now())
+
+	switch {
+	case re.Match(banner):
+		err = nil
+	case len(banner) > 0:
+		err = fmt.Errorf("%w: banner %q does not match %q", errUnexpectedResponse, banner, ep.BannerMatch)
+	case err == nil:
+		err = fmt.Errorf("%w: no banner received", errUnexpectedResponse)
+	}
+	return networkMetric(ep, start, timings, err)
+}
+
+// Read from conn until what has been read matches re, the banner limit is
+// reached or the read fails. Also returns when the first byte arrived.
+func readBanner(conn net.Conn, re *regexp.Regexp) ([]byte, time.Time, error) {
+	buf := make([]byte, 0, maxBanner)
+	var firstByte time.Time
+	for len(buf) < maxBanner {
+		n, err := conn.Read(buf[len(buf):maxBanner])
+		if n > 0 && firstByte.IsZero() {
+			firstByte = time.Now()
+		}
+		buf = buf[:len(buf)+n]
+		if re.Match(buf) {
+			return buf, firstByte, nil
+		}
+		if err != nil {
+			return buf, firstByte, err
+		}
+	}
+	return buf, firstByte, nil
+}
+
+// Complete a TLS handshake with a tls:// endpoint without sending a request,
+// recording the certificate chain and the protocol negotiated. config holds
+// the endpoint's TLS settings, nil for the defaults.
+func checkTLS(ep models.MonitoredEndpoint, config *tls.Config) models.Metric {
+	ctx, cancel := context.WithTimeout(context.Background(), ep.Timeout())
+	defer cancel()
+
+	start := time.Now()
+	conn, timings, err := dial(ctx, hostPort(ep, "443"))
+	if err != nil {
+		return networkMetric(ep, start, timings, err)
+	}
+	defer conn.Close()
+
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	config.ServerName = hostname(ep)
+	// Let old protocols through so min_tls_version can report them, rather
+	// than the handshake failing without saying what was offered
+	config.MinVersion = tls.VersionTLS10
+
+	tlsConn := tls.Client(conn, config)
+	handshakeStart := time.Now()
+	err = tlsConn.HandshakeContext(ctx)
+	timings.TLSMS = elapsedMS(handshakeStart, time.Now())
+	if err != nil {
+		metric := networkMetric(ep, start, timings, err)
+		metric.Certificates = describeChain(ep, certificatesFromError(err), start)
+		return metric
+	}
+
+	state := tlsConn.ConnectionState()
+	if ep.MinTLSVersion != "" {
+		if min, _ := models.ParseTLSVersion(ep.MinTLSVersion); state.Version < min {
+			err = fmt.Errorf("%w: negotiated %s, minimum is %s", errTLSVersion, tls.VersionName(state.Version), tls.VersionName(min))
+		}
+	}
+
+	metric := networkMetric(ep, start, timings, err)
+	metric.Certificates = describeChain(ep, state.PeerCertificates, start)
+	metric.TLSVersion = tls.VersionName(state.Version)
+	if err == nil && len(ep.Assertions) > 0 {
+		metric.AssertionResults = evaluateAssertions(ep.Assertions, checkResponse{certificates: metric.Certificates, now: time.Now()})
+		if !models.AllPassed(metric.AssertionResults) {
+			metric.Success = false
+			metric.FailureReason, metric.ErrorMessage = models.FailureAssertion, firstFailedAssertion(metric.AssertionResults)
+		}
+	}
+	return metric
+}
+
+// Resolve a dns:// endpoint and, if it has an expected answer, check the
+// answer includes it
+func checkDNS(ep models.MonitoredEndpoint) models.Metric {
+	ctx, cancel := context.WithTimeout(context.Background(), ep.Timeout())
+	defer cancel()
+
+	resolver := net.DefaultResolver
+	if addr := ep.ResolverAddress(); addr != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+	}
+
+	name := hostname(ep)
+	start := time.Now()
+	answers, err := lookup(ctx, resolver, ep.RecordType(), name)
+	timings := models.PhaseTimings{DNSMS: elapsedMS(start, time.Now())}
+
+	if err == nil && ep.DNSExpected != "" && !matchesAnswer(answers, ep.DNSExpected) {
+		err = fmt.Errorf("%w: no %s record for %s matches %q, got %s",
+			errUnexpectedResponse, ep.RecordType(), name, ep.DNSExpected, strings.Join(answers, ", "))
+	}
+	return networkMetric(ep, start, timings, err)
+}
+
+// Look up the records of one type for a name
+func lookup(ctx context.Context, r *net.Resolver, recordType, name string) ([]string, error) {
+	var answers []string
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case "CNAME":
+		cname, err := r.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, cname)
+	case "MX":
+		records, err := r.LookupMX(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range records {
+			answers = append(answers, mx.Host)
+		}
+	case "NS":
+		records, err := r.LookupNS(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range records {
+			answers = append(answers, ns.Host)
+		}
+	case "TXT":
+		return r.LookupTXT(ctx, name)
+	default:
+		return nil, fmt.Errorf("unsupported record type %q", recordType)
+	}
+	return answers, nil
+}
+
+// Report whether any answer is the expected one, ignoring case, trailing
+// dots on names and how IP addresses are written
+func matchesAnswer(answers []string, expected string) bool {
+	want := normaliseAnswer(expected)
+	for _, a := range answers {
+		if normaliseAnswer(a) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func normaliseAnswer(s string) string {
+	s = strings.TrimSpace(s)
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String()
+	}
+	return strings.ToLower(strings.TrimSuffix(s, "."))
+}
+
+// Resolve and connect to a host:port, timing each phase. Each resolved
+// address is tried in turn until one connects.
+func dial(ctx context.Context, address string) (net.Conn, models.PhaseTimings, error) {
+	var timings models.PhaseTimings
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, timings, err
+	}
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	resolved := time.Now()
+	timings.DNSMS = elapsedMS(start, resolved)
+	if err != nil {
+		return nil, timings, err
+	}
+
+	var dialer net.Dialer
+	var conn net.Conn
+	for _, addr := range addrs {
+		if conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, port)); err == nil {
+			break
+		}
+	}
+	timings.ConnectMS = elapsedMS(resolved, time.Now())
+	return conn, timings, err
+}
+
+// host:port from the endpoint's URL, using defaultPort when it has none
+func hostPort(ep models.MonitoredEndpoint, defaultPort string) string {
+	u, err := url.Parse(ep.URL)
+	if err != nil {
+		return ep.URL
+	}
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	return u.Host
+}
+
+func hostname(ep models.MonitoredEndpoint) string {
+	u, err := url.Parse(ep.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// Metric for a check made without HTTP, successful when err is nil
+func networkMetric(ep models.MonitoredEndpoint, start time.Time, timings models.PhaseTimings, err error) models.Metric {
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	return models.Metric{
+		ID:            uuid.New(),
+		EndpointID:    ep.ID,
+		Timestamp:     time.Now().Truncate(time.Millisecond), // Match the precision stored in the DB
+		LatencyMS:     int(time.Since(start).Milliseconds()),
+		URL:           ep.URL,
+		Success:       err == nil,
+		PhaseTimings:  timings,
+		FailureReason: classifyError(err),
+		ErrorMessage:  message,
+	}
+}
@@ -0,0 +1,194 @@
+package poller
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Accept TCP connections and greet each with banner
+func bannerServer(t *testing.T, banner string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(banner))
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestCheckTCP(t *testing.T) {
+	addr := bannerServer(t, "SSH-2.0-OpenSSH_9.6\r\n")
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		addr     string
+		banner   string
+		expected models.FailureReason
+	}{
+		{name: "connects", addr: addr, expected: models.FailureNone},
+		{name: "matching banner", addr: addr, banner: `^SSH-2\.0-`, expected: models.FailureNone},
+		{name: "different banner", addr: addr, banner: `^220 `, expected: models.FailureUnexpectedResponse},
+		{name: "closed port", addr: closedAddr, expected: models.FailureConnectionRefused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := models.MonitoredEndpoint{ID: uuid.New(), Type: models.CheckTCP, URL: "tcp://" + tt.addr, BannerMatch: tt.banner}
+
+			metric := checkTCP(ep)
+			if metric.FailureReason != tt.expected || metric.Success != (tt.expected == models.FailureNone) {
+				t.Errorf("expected %q, got %q (%s)", tt.expected, metric.FailureReason, metric.ErrorMessage)
+			}
+			if metric.URL != ep.URL || metric.EndpointID != ep.ID {
+				t.Errorf("unexpected metric: %+v", metric)
+			}
+		})
+	}
+}
+
+func TestCheckTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	caBundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	url := "tls://" + strings.TrimPrefix(server.URL, "https://")
+
+	tests := []struct {
+		name     string
+		endpoint models.MonitoredEndpoint
+		expected models.FailureReason
+	}{
+		{name: "untrusted certificate", endpoint: models.MonitoredEndpoint{}, expected: models.FailureTLS},
+		{name: "trusted certificate", endpoint: models.MonitoredEndpoint{CABundle: caBundle}, expected: models.FailureNone},
+		{name: "protocol below minimum", endpoint: models.MonitoredEndpoint{CABundle: caBundle, MinTLSVersion: "1.3"}, expected: models.FailureTLS},
+		{
+			name:     "certificate expiry assertion",
+			endpoint: models.MonitoredEndpoint{CABundle: caBundle, Assertions: []models.Assertion{{Type: models.AssertCertExpiry, Value: "100000"}}},
+			expected: models.FailureAssertion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := tt.endpoint
+			ep.ID, ep.Type, ep.URL = uuid.New(), models.CheckTLS, url
+
+			config, err := tlsConfig(ep, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metric := checkTLS(ep, config)
+			if metric.FailureReason != tt.expected {
+				t.Fatalf("expected %q, got %q (%s)", tt.expected, metric.FailureReason, metric.ErrorMessage)
+			}
+			if len(metric.Certificates) == 0 {
+				t.Error("expected the certificate to be recorded")
+			}
+			if tt.expected != models.FailureTLS && metric.TLSVersion != "TLS 1.2" {
+				t.Errorf("expected TLS 1.2 to be recorded, got %q", metric.TLSVersion)
+			}
+		})
+	}
+}
+
+func TestCheckDNS(t *testing.T) {
+	resolver := dnsServer(t, net.IPv4(192, 0, 2, 10))
+
+	tests := []struct {
+		name     string
+		expected string
+		reason   models.FailureReason
+	}{
+		{name: "any answer", reason: models.FailureNone},
+		{name: "expected answer", expected: "192.0.2.10", reason: models.FailureNone},
+		{name: "different answer", expected: "192.0.2.99", reason: models.FailureUnexpectedResponse},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := models.MonitoredEndpoint{
+				ID:          uuid.New(),
+				Type:        models.CheckDNS,
+				URL:         "dns://db.example.test",
+				DNSExpected: tt.expected,
+				DNSResolver: resolver,
+			}
+
+			metric := checkDNS(ep)
+			if metric.FailureReason != tt.reason {
+				t.Errorf("expected %q, got %q (%s)", tt.reason, metric.FailureReason, metric.ErrorMessage)
+			}
+		})
+	}
+}
+
+// Minimal UDP DNS server answering every A query with ip
+func dnsServer(t *testing.T, ip net.IP) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+
+			// The question runs from the header to the end of the name plus
+			// its type and class
+			end := 12
+			for end < n && query[end] != 0 {
+				end += int(query[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+
+			resp := append([]byte{}, query[:2]...)                  // ID
+			resp = append(resp, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0) // Response, 1 question, 1 answer
+			resp = append(resp, query[12:end]...)
+			resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1) // Pointer to the question name, A, IN
+			resp = binary.BigEndian.AppendUint32(resp, 60)
+			resp = append(resp, 0, 4)
+			resp = append(resp, ip.To4()...)
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
@@ -1,42 +1,206 @@
 package poller
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/http/httptrace"
+	"strings"
 	"time"
 
-	"github.com/AdamGriffiths31/pulseboard/internal/db"
 	"github.com/AdamGriffiths31/pulseboard/internal/models"
 
 	"github.com/google/uuid"
 )
 
-func StartPolling(endpoints []models.MonitoredEndpoint, dbClient *db.SQLiteClient) {
-	for _, ep := range endpoints {
-		go func(e models.MonitoredEndpoint) {
-			ticker := time.NewTicker(e.Frequency)
-			defer ticker.Stop()
+// Check an endpoint, retrying failures under its retry policy, and record
+// the result. failures counts consecutive failed checks so a failure is only
+// confirmed once the policy's threshold is reached.
+func (s *Scheduler) runCheck(ctx context.Context, e models.MonitoredEndpoint, failures *int) {
+	metric, ok := s.checkWithRetries(ctx, e)
+	if !ok {
+		return
+	}
 
-			for {
-				<-ticker.C
-				metric := checkEndpoint(e)
-				log.Printf("%s | %d | %dms\n", e.URL, metric.StatusCode, metric.LatencyMS)
+	if metric.Success {
+		*failures = 0
+	} else {
+		*failures++
+		metric.Unconfirmed = *failures < e.Retry.ConfirmAfter
+	}
+	log.Printf("%s | %d | %dms | attempt %d\n", e.URL, metric.StatusCode, metric.LatencyMS, metric.Attempts)
+	s.record(e, metric)
+}
 
-				if err := dbClient.StoreMetric(metric); err != nil {
-					log.Println("DB error:", err)
-				}
-			}
-		}(ep)
+// Store a result and push it to live clients
+func (s *Scheduler) record(e models.MonitoredEndpoint, metric models.Metric) {
+	if err := s.dbClient.StoreMetric(metric); err != nil {
+		log.Println("DB error:", err)
+	}
+	if len(metric.Certificates) > 0 {
+		if err := s.dbClient.StoreCertificates(e.ID, metric.Certificates); err != nil {
+			log.Println("DB error storing certificates:", err)
+		}
 	}
+
+	// Push the result to live clients as soon as it is measured
+	s.metricsHub.Publish(metric)
 }
 
-func checkEndpoint(ep models.MonitoredEndpoint) models.Metric {
+// Check an endpoint, retrying with backoff until an attempt succeeds or the
+// retries run out. Only the last attempt is returned. Returns false if the
+// scheduler stopped before the first attempt could run.
+func (s *Scheduler) checkWithRetries(ctx context.Context, e models.MonitoredEndpoint) (models.Metric, bool) {
+	// Loaded once for every attempt, so a profile edit applies from the next check
+	profile, err := s.authProfile(e)
+	if err != nil {
+		metric := failedMetric(e, models.FailureAuth, fmt.Errorf("loading auth profile: %w", err))
+		metric.Attempts = 1
+		return metric, true
+	}
+
+	metric, ok := s.attempt(ctx, e, profile)
+	if !ok {
+		return metric, false
+	}
+	metric.Attempts = 1
+
+	for retry := 1; !metric.Success && retry <= e.Retry.Retries; retry++ {
+		// Stop retrying on shutdown, but keep the failure already measured
+		if !sleep(ctx, e.Retry.Backoff(retry)) {
+			break
+		}
+		next, ok := s.attempt(ctx, e, profile)
+		if !ok {
+			break
+		}
+		metric = next
+		metric.Attempts = retry + 1
+	}
+	return metric, true
+}
+
+// Make one request once a slot is free
+func (s *Scheduler) attempt(ctx context.Context, e models.MonitoredEndpoint, profile *models.AuthProfile) (models.Metric, bool) {
+	release, ok := s.limiter.acquire(ctx, e.URL)
+	if !ok {
+		return models.Metric{}, false
+	}
+	defer release()
+
+	return s.check(ctx, e, profile), true
+}
+
+// The endpoint's auth profile with its secrets decrypted, or nil if it has none
+func (s *Scheduler) authProfile(e models.MonitoredEndpoint) (*models.AuthProfile, error) {
+	if e.AuthProfileID == nil {
+		return nil, nil
+	}
+	p, err := s.dbClient.GetAuthProfile(*e.AuthProfileID)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Run the check matching the endpoint's kind
+func (s *Scheduler) check(ctx context.Context, e models.MonitoredEndpoint, profile *models.AuthProfile) models.Metric {
+	switch e.Kind() {
+	case models.CheckTCP:
+		return checkTCP(e)
+	case models.CheckDNS:
+		return checkDNS(e)
+	case models.CheckTLS:
+		config, err := tlsConfig(e, profile)
+		if err != nil {
+			return failedMetric(e, models.FailureInvalidRequest, err)
+		}
+		return checkTLS(e, config)
+	}
+
+	transport, err := s.transports.get(e, profile)
+	if err != nil {
+		return failedMetric(e, models.FailureInvalidRequest, err)
+	}
+
+	authed, err := s.auth.apply(ctx, e, profile, transport)
+	if err != nil {
+		return failedMetric(e, models.FailureAuth, err)
+	}
+
+	var metric models.Metric
+	switch e.Kind() {
+	case models.CheckTransaction:
+		metric = checkTransaction(authed, transport)
+	case models.CheckGRPC:
+		// Credentials are sent as metadata, so are applied as for HTTP
+		config, err := tlsConfig(e, profile)
+		if err != nil {
+			return failedMetric(e, models.FailureInvalidRequest, err)
+		}
+		metric = checkGRPC(authed, config)
+	case models.CheckWebSocket:
+		// Credentials go in the opening handshake's headers
+		config, err := tlsConfig(e, profile)
+		if err != nil {
+			return failedMetric(e, models.FailureInvalidRequest, err)
+		}
+		metric = checkWebSocket(authed, config)
+	default:
+		metric = checkEndpoint(authed, transport)
+	}
+	if metric.StatusCode == http.StatusUnauthorized || metric.FailureReason == models.FailureAuth {
+		// The token may have been revoked early, so fetch a new one next time
+		s.auth.invalidate(profile)
+	}
+	return metric
+}
+
+// Wait for d, returning false if ctx is cancelled first
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func checkEndpoint(ep models.MonitoredEndpoint, transport http.RoundTripper) models.Metric {
+	metric, _ := request(ep, transport, false)
+	return metric
+}
+
+// Make the endpoint's request and evaluate the response. With keepBody set
+// the response is returned even when there are no assertions, so values can
+// be extracted from it.
+func request(ep models.MonitoredEndpoint, transport http.RoundTripper, keepBody bool) (models.Metric, checkResponse) {
 	start := time.Now()
 
-	req, err := http.NewRequest("GET", ep.URL, nil) // TODO: Add support for POST/PUT if needed
+	var body io.Reader
+	if ep.Body != "" {
+		body = strings.NewReader(ep.Body)
+	}
+
+	tracer := &phaseTracer{}
+	req, err := http.NewRequest(ep.HTTPMethod(), ep.URL, body)
 	if err != nil {
-		// Handle error gracefully, maybe return a failed metric
-		return models.Metric{}
+		return failedMetric(ep, models.FailureInvalidRequest, err), checkResponse{}
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), tracer.clientTrace()))
+
+	if ep.ContentType != "" {
+		req.Header.Set("Content-Type", ep.ContentType)
 	}
 
 	// Set headers if any
@@ -44,25 +208,112 @@ func checkEndpoint(ep models.MonitoredEndpoint) models.Metric {
 		req.Header.Set(k, v)
 	}
 
-	const requestTimeout = 5 * time.Second
-	client := http.Client{Timeout: requestTimeout}
+	var redirects []string
+	client := http.Client{Transport: transport, Timeout: ep.Timeout(), CheckRedirect: redirectPolicy(ep, &redirects)}
 
 	resp, err := client.Do(req)
 	duration := time.Since(start).Milliseconds()
 
 	status := 0
+	var results []models.AssertionResult
+	var certs []models.Certificate
+	var response checkResponse
+	tlsVersion := ""
 	if err == nil {
 		status = resp.StatusCode
-		if resp.Body != nil {
-			defer resp.Body.Close()
+		defer resp.Body.Close()
+		if resp.TLS != nil {
+			certs = describeChain(ep, resp.TLS.PeerCertificates, start)
+			tlsVersion = tls.VersionName(resp.TLS.Version)
 		}
+		// The body is always read so transfer time is measured and the
+		// connection can be reused
+		results, response = readResponse(ep.Assertions, resp, certs, keepBody)
+	} else {
+		certs = describeChain(ep, certificatesFromError(err), start)
+	}
+
+	reason, message := classifyError(err), ""
+	switch {
+	case err != nil:
+		message = err.Error()
+	case !ep.IsExpectedStatus(status):
+		reason, message = models.FailureUnexpectedStatus, fmt.Sprintf("unexpected status code %d", status)
+	case !models.AllPassed(results):
+		reason, message = models.FailureAssertion, firstFailedAssertion(results)
 	}
 
 	return models.Metric{
-		ID:         uuid.New(),
-		EndpointID: ep.ID,
-		Timestamp:  time.Now(),
-		StatusCode: status,
-		LatencyMS:  int(duration),
+		ID:               uuid.New(),
+		EndpointID:       ep.ID,
+		Timestamp:        time.Now().Truncate(time.Millisecond), // Match the precision stored in the DB
+		StatusCode:       status,
+		LatencyMS:        int(duration),
+		URL:              ep.URL,
+		Success:          reason == models.FailureNone,
+		PhaseTimings:     tracer.timings(time.Now()),
+		FailureReason:    reason,
+		ErrorMessage:     message,
+		AssertionResults: results,
+		Certificates:     certs,
+		RedirectChain:    redirects,
+		TLSVersion:       tlsVersion,
+	}, response
+}
+
+// Metric for a check that couldn't be attempted at all
+func failedMetric(ep models.MonitoredEndpoint, reason models.FailureReason, err error) models.Metric {
+	return models.Metric{
+		ID:            uuid.New(),
+		EndpointID:    ep.ID,
+		Timestamp:     time.Now().Truncate(time.Millisecond),
+		URL:           ep.URL,
+		FailureReason: reason,
+		ErrorMessage:  err.Error(),
+	}
+}
+
+func firstFailedAssertion(results []models.AssertionResult) string {
+	for _, r := range results {
+		if !r.Passed {
+			return fmt.Sprintf("%s assertion failed: %s", r.Type, r.Message)
+		}
+	}
+	return ""
+}
+
+// Read the response body and run the endpoint's assertions against it. The
+// body is discarded unless there are assertions or keepBody is set.
+func readResponse(assertions []models.Assertion, resp *http.Response, certs []models.Certificate, keepBody bool) ([]models.AssertionResult, checkResponse) {
+	if len(assertions) == 0 && !keepBody {
+		io.Copy(io.Discard, resp.Body)
+		return nil, checkResponse{}
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAssertionBody))
+	var rest int64
+	if err == nil {
+		rest, err = io.Copy(io.Discard, resp.Body)
+	}
+
+	if err != nil {
+		// Without the full body none of the assertions can be trusted
+		results := make([]models.AssertionResult, 0, len(assertions))
+		for _, a := range assertions {
+			results = append(results, models.AssertionResult{
+				Assertion: a,
+				Message:   fmt.Sprintf("failed to read response body: %v", err),
+			})
+		}
+		return results, checkResponse{header: resp.Header, readErr: err}
+	}
+
+	response := checkResponse{
+		header:       resp.Header,
+		body:         body,
+		bodySize:     int64(len(body)) + rest,
+		certificates: certs,
+		now:          time.Now(),
 	}
+	return evaluateAssertions(assertions, response), response
 }
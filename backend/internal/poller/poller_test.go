@@ -0,0 +1,170 @@
+package poller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestCheckEndpointSendsMethodAndBody(t *testing.T) {
+	var gotMethod, gotBody, gotContentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod = r.Method
+		gotContentType = r.Header.Get("Content-Type")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ep := models.MonitoredEndpoint{
+		ID:          uuid.New(),
+		URL:         server.URL,
+		Method:      "post",
+		Body:        `{"query":"{ health }"}`,
+		ContentType: "application/json",
+	}
+
+	metric := checkEndpoint(ep, http.DefaultTransport)
+
+	if gotMethod != http.MethodPost {
+		t.Errorf("expected POST, got %s", gotMethod)
+	}
+	if gotBody != ep.Body {
+		t.Errorf("expected body %q, got %q", ep.Body, gotBody)
+	}
+	if gotContentType != "application/json" {
+		t.Errorf("expected JSON content type, got %q", gotContentType)
+	}
+	if metric.StatusCode != http.StatusOK || !metric.Success {
+		t.Errorf("expected a successful metric, got %+v", metric)
+	}
+}
+
+func TestCheckEndpointUsesExpectedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		expected []models.StatusRange
+		success  bool
+	}{
+		{name: "401 is down by default", success: false},
+		{name: "401 is up when expected", expected: []models.StatusRange{{Min: 401, Max: 401}}, success: true},
+		{name: "401 is down outside the range", expected: []models.StatusRange{{Min: 200, Max: 299}}, success: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := models.MonitoredEndpoint{ID: uuid.New(), URL: server.URL, ExpectedStatus: tt.expected}
+			metric := checkEndpoint(ep, http.DefaultTransport)
+
+			if metric.StatusCode != http.StatusUnauthorized {
+				t.Errorf("expected status 401, got %d", metric.StatusCode)
+			}
+			if metric.Success != tt.success {
+				t.Errorf("expected success %v, got %v", tt.success, metric.Success)
+			}
+		})
+	}
+}
+
+func TestCheckEndpointRecordsPhaseTimings(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Use the test server's transport so its certificate is trusted
+	metric := checkEndpoint(models.MonitoredEndpoint{ID: uuid.New(), URL: server.URL}, server.Client().Transport)
+
+	if metric.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", metric.StatusCode)
+	}
+	if metric.TTFBMS < 20 {
+		t.Errorf("expected TTFB to include the server delay, got %dms", metric.TTFBMS)
+	}
+	if metric.TTFBMS > metric.LatencyMS {
+		t.Errorf("expected TTFB (%dms) to be within total latency (%dms)", metric.TTFBMS, metric.LatencyMS)
+	}
+}
+
+func TestCheckEndpointUsesTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	metric := checkEndpoint(models.MonitoredEndpoint{ID: uuid.New(), URL: server.URL, TimeoutMS: 50}, http.DefaultTransport)
+	if metric.FailureReason != models.FailureTimeout {
+		t.Errorf("expected a timeout with a 50ms limit, got %q", metric.FailureReason)
+	}
+
+	metric = checkEndpoint(models.MonitoredEndpoint{ID: uuid.New(), URL: server.URL, TimeoutMS: 2000}, http.DefaultTransport)
+	if !metric.Success {
+		t.Errorf("expected success with a 2s limit, got %+v", metric)
+	}
+}
+
+func TestCheckEndpointRedirectPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/a", http.RedirectHandler("/b", http.StatusFound))
+	mux.Handle("/b", http.RedirectHandler("/c", http.StatusFound))
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		endpoint  models.MonitoredEndpoint
+		status    int
+		reason    models.FailureReason
+		redirects []string
+	}{
+		{
+			name:      "follows redirects by default",
+			status:    http.StatusOK,
+			redirects: []string{server.URL + "/b", server.URL + "/c"},
+		},
+		{
+			name:      "fails past the redirect limit",
+			endpoint:  models.MonitoredEndpoint{MaxRedirects: 1},
+			reason:    models.FailureTooManyRedirects,
+			redirects: []string{server.URL + "/b", server.URL + "/c"},
+		},
+		{
+			name:      "records without following",
+			endpoint:  models.MonitoredEndpoint{NoRedirects: true},
+			status:    http.StatusFound,
+			redirects: []string{server.URL + "/b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := tt.endpoint
+			ep.ID, ep.URL = uuid.New(), server.URL+"/a"
+
+			metric := checkEndpoint(ep, http.DefaultTransport)
+			if metric.StatusCode != tt.status || metric.FailureReason != tt.reason {
+				t.Errorf("expected status %d and reason %q, got %d and %q", tt.status, tt.reason, metric.StatusCode, metric.FailureReason)
+			}
+			if !reflect.DeepEqual(metric.RedirectChain, tt.redirects) {
+				t.Errorf("expected redirect chain %v, got %v", tt.redirects, metric.RedirectChain)
+			}
+		})
+	}
+}
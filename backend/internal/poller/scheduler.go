@@ -0,0 +1,217 @@
+package poller
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Upper bound on how far Start spreads out the first checks, so endpoints
+// with long intervals still get checked soon after startup
+const maxStartJitter = 10 * time.Second
+
+// Scheduler runs one polling loop per endpoint and lets endpoints be added,
+// changed, paused and removed without restarting the process
+type Scheduler struct {
+	dbClient   db.DBClient
+	metricsHub *hub.Hub
+	limiter    *limiter
+	transports *transportPool // Shared so connections are reused across checks
+	auth       *authenticator
+
+	ctx    context.Context // Cancelled by Stop
+	cancel context.CancelFunc
+	wg     sync.WaitGroup // Tracks every running loop
+
+	mu      sync.Mutex
+	loops   map[uuid.UUID]*pollLoop
+	stopped bool
+}
+
+// A running polling loop for one endpoint
+type pollLoop struct {
+	cancel context.CancelFunc
+	done   chan struct{} // Closed once the loop and any in-flight check finish
+}
+
+func NewScheduler(dbClient db.DBClient, metricsHub *hub.Hub, limits Limits) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := newLimiter(limits)
+	return &Scheduler{
+		dbClient:   dbClient,
+		metricsHub: metricsHub,
+		limiter:    l,
+		transports: newTransportPool(l.limits),
+		auth:       newAuthenticator(),
+		ctx:        ctx,
+		cancel:     cancel,
+		loops:      make(map[uuid.UUID]*pollLoop),
+	}
+}
+
+// Start polling a batch of endpoints, such as those loaded at startup. First
+// checks are spread out so they don't all fire at once.
+func (s *Scheduler) Start(endpoints []models.MonitoredEndpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, ep := range endpoints {
+		if ep.Paused {
+			continue
+		}
+		s.startLocked(ep, startJitter(ep.Frequency), nil)
+	}
+}
+
+// Start polling a new endpoint, checking it straight away. Does nothing if
+// the endpoint is already being polled or is paused.
+func (s *Scheduler) Add(ep models.MonitoredEndpoint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.loops[ep.ID]; ok || ep.Paused {
+		return
+	}
+	s.startLocked(ep, 0, nil)
+}
+
+// Poll an endpoint with its current settings, replacing any loop already
+// running for it. A paused endpoint is stopped instead. Like Remove, this
+// waits for any in-flight check with the old settings, and the new loop
+// doesn't check until then.
+func (s *Scheduler) Update(ep models.MonitoredEndpoint) {
+	s.mu.Lock()
+	old := s.loops[ep.ID]
+	delete(s.loops, ep.ID)
+	if old != nil {
+		old.cancel()
+	}
+	if !ep.Paused {
+		s.startLocked(ep, 0, old)
+	}
+	s.mu.Unlock()
+
+	if old != nil {
+		<-old.done
+	}
+}
+
+// Stop polling an endpoint until it is updated or added again
+func (s *Scheduler) Pause(id uuid.UUID) {
+	s.Remove(id)
+}
+
+// Stop polling an endpoint, waiting for any in-flight check so nothing is
+// stored for it afterwards
+func (s *Scheduler) Remove(id uuid.UUID) {
+	s.mu.Lock()
+	loop := s.loops[id]
+	delete(s.loops, id)
+	s.mu.Unlock()
+
+	if loop != nil {
+		loop.cancel()
+		<-loop.done
+	}
+}
+
+// Concurrency limits and how many checks have been delayed waiting for a slot
+func (s *Scheduler) Stats() models.PollerStats {
+	return s.limiter.stats()
+}
+
+// Whether an endpoint currently has a polling loop
+func (s *Scheduler) Running(id uuid.UUID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.loops[id]
+	return ok
+}
+
+// Stop every loop and wait for in-flight checks to be stored. Later calls to
+// Start, Add and Update do nothing.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.loops = make(map[uuid.UUID]*pollLoop)
+	s.mu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+	s.transports.closeIdle()
+}
+
+// Start a loop for an endpoint, which waits for the loop it replaces, if any,
+// to finish first
+func (s *Scheduler) startLocked(ep models.MonitoredEndpoint, delay time.Duration, replaces *pollLoop) {
+	if s.stopped {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	loop := &pollLoop{cancel: cancel, done: make(chan struct{})}
+	s.loops[ep.ID] = loop
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(loop.done)
+		if replaces != nil {
+			<-replaces.done
+		}
+		s.poll(ctx, ep, delay)
+	}()
+}
+
+// Check an endpoint after the initial delay and then every Frequency until
+// cancelled. Heartbeat monitors are watched for missed pings instead. A check
+// that has started always runs to completion, but one still waiting for a
+// slot is abandoned.
+func (s *Scheduler) poll(ctx context.Context, ep models.MonitoredEndpoint, delay time.Duration) {
+	if ep.Kind() == models.CheckHeartbeat {
+		s.watch(ctx, ep)
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-timer.C:
+	}
+
+	// Consecutive failed checks, for confirming failures
+	failures := 0
+	s.runCheck(ctx, ep, &failures)
+
+	ticker := time.NewTicker(ep.Frequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runCheck(ctx, ep, &failures)
+		}
+	}
+}
+
+// Random delay before an endpoint's first check, within its interval
+func startJitter(frequency time.Duration) time.Duration {
+	window := min(frequency, maxStartJitter)
+	if window <= 0 {
+		return 0
+	}
+	return rand.N(window)
+}
@@ -0,0 +1,219 @@
+package poller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// DB mock that records stored metrics
+func recordingDB() (*db.MockDBClient, func() []models.Metric) {
+	var mu sync.Mutex
+	var stored []models.Metric
+	mock := &db.MockDBClient{
+		StoreMetricFunc: func(m models.Metric) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stored = append(stored, m)
+			return nil
+		},
+	}
+	return mock, func() []models.Metric {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]models.Metric(nil), stored...)
+	}
+}
+
+func TestSchedulerUpdatePauseAndRemove(t *testing.T) {
+	mock, _ := recordingDB()
+	s := NewScheduler(mock, hub.New(hub.DefaultBufferSize), DefaultLimits)
+	defer s.Stop()
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: "http://127.0.0.1:1", Frequency: time.Hour}
+
+	s.Add(ep)
+	if !s.Running(ep.ID) {
+		t.Fatal("expected the endpoint to be polled after Add")
+	}
+
+	s.Pause(ep.ID)
+	if s.Running(ep.ID) {
+		t.Fatal("expected a paused endpoint to stop being polled")
+	}
+
+	s.Update(ep)
+	if !s.Running(ep.ID) {
+		t.Fatal("expected Update to restart polling")
+	}
+
+	ep.Paused = true
+	s.Update(ep)
+	if s.Running(ep.ID) {
+		t.Fatal("expected an endpoint updated as paused to stop being polled")
+	}
+
+	ep.Paused = false
+	s.Update(ep)
+	s.Remove(ep.ID)
+	if s.Running(ep.ID) {
+		t.Fatal("expected a removed endpoint to stop being polled")
+	}
+}
+
+func TestSchedulerChecksImmediately(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	mock, stored := recordingDB()
+	s := NewScheduler(mock, hub.New(hub.DefaultBufferSize), DefaultLimits)
+	defer s.Stop()
+
+	s.Add(models.MonitoredEndpoint{ID: uuid.New(), URL: server.URL, Frequency: time.Hour})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(stored()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the first check to run without waiting for the interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSchedulerStopWaitsForInFlightChecks(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	mock, stored := recordingDB()
+	s := NewScheduler(mock, hub.New(hub.DefaultBufferSize), DefaultLimits)
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: server.URL, Frequency: time.Hour}
+	s.Add(ep)
+
+	<-started
+	s.Stop()
+
+	if len(stored()) != 1 {
+		t.Fatalf("expected the in-flight check to be stored before Stop returned, got %d metrics", len(stored()))
+	}
+
+	s.Add(ep)
+	if s.Running(ep.ID) {
+		t.Error("expected Add to do nothing after Stop")
+	}
+}
+
+func TestSchedulerUpdateWaitsForInFlightChecks(t *testing.T) {
+	started := make(chan struct{})
+	var inFlight atomic.Bool
+	old := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Store(true)
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		inFlight.Store(false)
+	}))
+	defer old.Close()
+	var overlapped atomic.Bool
+	updated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		overlapped.Store(inFlight.Load())
+	}))
+	defer updated.Close()
+
+	mock, stored := recordingDB()
+	s := NewScheduler(mock, hub.New(hub.DefaultBufferSize), DefaultLimits)
+	defer s.Stop()
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: old.URL, Frequency: time.Hour}
+	s.Add(ep)
+
+	<-started
+	ep.URL = updated.URL
+	s.Update(ep)
+
+	if len(stored()) != 1 {
+		t.Fatalf("expected the in-flight check to be stored before Update returned, got %d metrics", len(stored()))
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(stored()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the updated endpoint to be checked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if overlapped.Load() {
+		t.Error("expected the updated check to wait for the old one")
+	}
+}
+
+func TestSchedulerRetriesFailedChecks(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first request, as if a packet was dropped
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	mock, _ := recordingDB()
+	s := NewScheduler(mock, hub.New(hub.DefaultBufferSize), DefaultLimits)
+	defer s.Stop()
+
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: server.URL, Retry: models.RetryPolicy{Retries: 2, BackoffMS: 10}}
+	metric, ok := s.checkWithRetries(context.Background(), ep)
+
+	if !ok || !metric.Success {
+		t.Fatalf("expected the retry to succeed, got %+v", metric)
+	}
+	if metric.Attempts != 2 || requests.Load() != 2 {
+		t.Errorf("expected 2 attempts, got %d (%d requests)", metric.Attempts, requests.Load())
+	}
+}
+
+func TestSchedulerConfirmsFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	mock, stored := recordingDB()
+	s := NewScheduler(mock, hub.New(hub.DefaultBufferSize), DefaultLimits)
+	defer s.Stop()
+
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: server.URL, Retry: models.RetryPolicy{Retries: 1, ConfirmAfter: 2}}
+	failures := 0
+	s.runCheck(context.Background(), ep, &failures)
+	s.runCheck(context.Background(), ep, &failures)
+
+	metrics := stored()
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics, got %d", len(metrics))
+	}
+	if !metrics[0].Unconfirmed || metrics[0].Attempts != 2 {
+		t.Errorf("expected the first failure to be unconfirmed after 2 attempts, got %+v", metrics[0])
+	}
+	if metrics[1].Unconfirmed {
+		t.Error("expected the second consecutive failure to be confirmed")
+	}
+}
+
+func TestStartJitter(t *testing.T) {
+	for _, frequency := range []time.Duration{time.Second, 30 * time.Second, time.Hour} {
+		window := min(frequency, maxStartJitter)
+		for i := 0; i < 100; i++ {
+			if d := startJitter(frequency); d < 0 || d >= window {
+				t.Fatalf("jitter %s outside [0, %s) for frequency %s", d, window, frequency)
+			}
+		}
+	}
+}
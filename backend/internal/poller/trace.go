@@ -0,0 +1,75 @@
+package poller
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Records when each phase of a request starts and ends. Dialing can race
+// several addresses at once, so callbacks may arrive concurrently.
+type phaseTracer struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+func (t *phaseTracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.set(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.set(&t.dnsDone) },
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.set(&t.connectDone)
+			}
+		},
+		TLSHandshakeStart:    func() { t.set(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.set(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.set(&t.wroteRequest) },
+		GotFirstResponseByte: func() { t.set(&t.firstByte) },
+	}
+}
+
+func (t *phaseTracer) set(field *time.Time) {
+	t.mu.Lock()
+	*field = time.Now()
+	t.mu.Unlock()
+}
+
+// Durations of each phase. Phases that didn't happen, such as DNS and connect
+// on a reused connection, are zero. Transfer runs until bodyDone.
+func (t *phaseTracer) timings(bodyDone time.Time) models.PhaseTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return models.PhaseTimings{
+		DNSMS:      elapsedMS(t.dnsStart, t.dnsDone),
+		ConnectMS:  elapsedMS(t.connectStart, t.connectDone),
+		TLSMS:      elapsedMS(t.tlsStart, t.tlsDone),
+		TTFBMS:     elapsedMS(t.wroteRequest, t.firstByte),
+		TransferMS: elapsedMS(t.firstByte, bodyDone),
+	}
+}
+
+func elapsedMS(start, end time.Time) int {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return int(end.Sub(start).Milliseconds())
+}
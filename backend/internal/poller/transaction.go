@@ -0,0 +1,153 @@
+package poller
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/jsonpath"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Run a transaction's steps in order, passing values extracted from each
+// response on to later steps. The transaction stops at the first failing step
+// and its metric totals the timings of the steps that ran.
+func checkTransaction(ep models.MonitoredEndpoint, transport http.RoundTripper) models.Metric {
+	total := models.Metric{
+		ID:         uuid.New(),
+		EndpointID: ep.ID,
+		URL:        ep.URL,
+		Success:    true,
+		Steps:      make([]models.StepResult, 0, len(ep.Steps)),
+	}
+	vars := make(map[string]string)
+
+	for i, step := range ep.Steps {
+		metric, response := request(stepEndpoint(ep, step, vars), transport, len(step.Extract) > 0)
+		if metric.Success {
+			for _, x := range step.Extract {
+				value, err := extract(x, response)
+				if err != nil {
+					metric.Success = false
+					metric.FailureReason = models.FailureExtraction
+					metric.ErrorMessage = fmt.Sprintf("extracting %s: %v", x.Name, err)
+					break
+				}
+				vars[x.Name] = value
+			}
+		}
+		// Errors and assertion messages can quote the expanded request
+		metric.ErrorMessage = models.RedactVariables(metric.ErrorMessage, vars)
+		for j := range metric.AssertionResults {
+			metric.AssertionResults[j].Message = models.RedactVariables(metric.AssertionResults[j].Message, vars)
+		}
+
+		total.Steps = append(total.Steps, models.StepResult{
+			Name:             step.Name,
+			Method:           step.HTTPMethod(),
+			URL:              step.URL, // Unexpanded so extracted tokens aren't stored
+			StatusCode:       metric.StatusCode,
+			LatencyMS:        metric.LatencyMS,
+			Success:          metric.Success,
+			PhaseTimings:     metric.PhaseTimings,
+			FailureReason:    metric.FailureReason,
+			ErrorMessage:     metric.ErrorMessage,
+			AssertionResults: metric.AssertionResults,
+		})
+		total.StatusCode = metric.StatusCode
+		total.LatencyMS += metric.LatencyMS
+		total.PhaseTimings = addTimings(total.PhaseTimings, metric.PhaseTimings)
+		if i == 0 {
+			total.Certificates = metric.Certificates
+		}
+
+		if !metric.Success {
+			total.Success = false
+			total.FailureReason = metric.FailureReason
+			total.ErrorMessage = fmt.Sprintf("step %q: %s", step.Name, metric.ErrorMessage)
+			break
+		}
+	}
+
+	total.Timestamp = time.Now().Truncate(time.Millisecond) // Match the precision stored in the DB
+	return total
+}
+
+// Endpoint for a single step, with variables filled in. The transaction's
+// headers and connection settings apply to every step.
+func stepEndpoint(ep models.MonitoredEndpoint, step models.TransactionStep, vars map[string]string) models.MonitoredEndpoint {
+	headers := maps.Clone(ep.Headers)
+	if headers == nil {
+		headers = make(map[string]string, len(step.Headers))
+	}
+	for k, v := range step.Headers {
+		headers[k] = models.ExpandVariables(v, vars)
+	}
+
+	ep.Type = models.CheckHTTP
+	ep.Steps = nil
+	ep.URL = models.ExpandVariables(step.URL, vars)
+	ep.Method = step.Method
+	ep.Headers = headers
+	ep.Body = models.ExpandVariables(step.Body, vars)
+	ep.ContentType = step.ContentType
+	ep.ExpectedStatus = step.ExpectedStatus
+	ep.Assertions = step.Assertions
+	return ep
+}
+
+// Pull a value out of a step's response
+func extract(x models.Extraction, resp checkResponse) (string, error) {
+	if resp.readErr != nil && x.Source != models.ExtractHeader {
+		return "", fmt.Errorf("failed to read response body: %w", resp.readErr)
+	}
+
+	switch x.Source {
+	case models.ExtractJSONPath:
+		var doc any
+		if err := json.Unmarshal(resp.body, &doc); err != nil {
+			return "", fmt.Errorf("body is not valid JSON: %w", err)
+		}
+		value, err := jsonpath.Lookup(doc, x.Expression)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", x.Expression, err)
+		}
+		return jsonValueString(value), nil
+	case models.ExtractHeader:
+		value := resp.header.Get(x.Expression)
+		if value == "" {
+			return "", fmt.Errorf("header %s is missing", x.Expression)
+		}
+		return value, nil
+	case models.ExtractRegex:
+		re, err := regexp.Compile(x.Expression)
+		if err != nil {
+			return "", fmt.Errorf("invalid pattern: %w", err)
+		}
+		match := re.FindSubmatch(resp.body)
+		if match == nil {
+			return "", fmt.Errorf("body does not match %q", x.Expression)
+		}
+		if len(match) > 1 {
+			return string(match[1]), nil
+		}
+		return string(match[0]), nil
+	default:
+		return "", fmt.Errorf("unknown source %q", x.Source)
+	}
+}
+
+func addTimings(a, b models.PhaseTimings) models.PhaseTimings {
+	return models.PhaseTimings{
+		DNSMS:      a.DNSMS + b.DNSMS,
+		ConnectMS:  a.ConnectMS + b.ConnectMS,
+		TLSMS:      a.TLSMS + b.TLSMS,
+		TTFBMS:     a.TTFBMS + b.TTFBMS,
+		TransferMS: a.TransferMS + b.TransferMS,
+	}
+}
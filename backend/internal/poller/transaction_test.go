@@ -0,0 +1,159 @@
+package poller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+// Test API where logging in returns a token that /orders requires
+func transactionServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Session", "session-7")
+		w.Write([]byte(`{"access_token":"tok-123","user":{"id":42}}`))
+	})
+	mux.HandleFunc("GET /users/{id}/orders", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok-123" || r.Header.Get("X-Session") != "session-7" || r.PathValue("id") != "42" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`order ref=ORD-9`))
+	})
+	mux.HandleFunc("GET /orders/{ref}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.PathValue("ref")))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckTransaction(t *testing.T) {
+	server := transactionServer(t)
+
+	ep := models.MonitoredEndpoint{
+		ID:   uuid.New(),
+		Type: models.CheckTransaction,
+		URL:  server.URL + "/login",
+		Steps: []models.TransactionStep{
+			{
+				Name:   "login",
+				Method: "POST",
+				URL:    server.URL + "/login",
+				Extract: []models.Extraction{
+					{Name: "token", Source: models.ExtractJSONPath, Expression: "$.access_token"},
+					{Name: "user_id", Source: models.ExtractJSONPath, Expression: "$.user.id"},
+					{Name: "session", Source: models.ExtractHeader, Expression: "X-Session"},
+				},
+			},
+			{
+				Name:    "orders",
+				URL:     server.URL + "/users/{{user_id}}/orders",
+				Headers: map[string]string{"Authorization": "Bearer {{token}}", "X-Session": "{{session}}"},
+				Extract: []models.Extraction{{Name: "ref", Source: models.ExtractRegex, Expression: `ref=(\S+)`}},
+			},
+			{
+				Name:       "order",
+				URL:        server.URL + "/orders/{{ref}}",
+				Assertions: []models.Assertion{{Type: models.AssertContains, Value: "ORD-9"}},
+			},
+		},
+	}
+
+	metric := checkTransaction(ep, http.DefaultTransport)
+	if !metric.Success {
+		t.Fatalf("expected the transaction to succeed, got %q: %s", metric.FailureReason, metric.ErrorMessage)
+	}
+	if len(metric.Steps) != 3 {
+		t.Fatalf("expected a result per step, got %+v", metric.Steps)
+	}
+
+	latency := 0
+	for _, step := range metric.Steps {
+		if !step.Success || step.StatusCode != http.StatusOK {
+			t.Errorf("expected step %s to succeed, got %+v", step.Name, step)
+		}
+		latency += step.LatencyMS
+	}
+	if metric.LatencyMS != latency || metric.URL != ep.URL || metric.EndpointID != ep.ID {
+		t.Errorf("unexpected transaction totals: %+v", metric)
+	}
+	if !strings.Contains(metric.Steps[1].URL, "{{user_id}}") {
+		t.Errorf("expected step URLs to be stored before variables are inserted, got %s", metric.Steps[1].URL)
+	}
+}
+
+func TestCheckTransactionStopsAtFirstFailure(t *testing.T) {
+	server := transactionServer(t)
+
+	tests := []struct {
+		name     string
+		steps    []models.TransactionStep
+		expected models.FailureReason
+	}{
+		{
+			name: "unexpected status",
+			steps: []models.TransactionStep{
+				{Name: "login", Method: "POST", URL: server.URL + "/login"},
+				{Name: "orders", URL: server.URL + "/users/42/orders"},
+				{Name: "order", URL: server.URL + "/orders/ORD-9"},
+			},
+			expected: models.FailureUnexpectedStatus,
+		},
+		{
+			name: "missing value",
+			steps: []models.TransactionStep{
+				{Name: "login", Method: "POST", URL: server.URL + "/login", Extract: []models.Extraction{{Name: "token", Source: models.ExtractJSONPath, Expression: "$.token"}}},
+				{Name: "orders", URL: server.URL + "/users/42/orders", Headers: map[string]string{"Authorization": "Bearer {{token}}"}},
+				{Name: "order", URL: server.URL + "/orders/ORD-9"},
+			},
+			expected: models.FailureExtraction,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := models.MonitoredEndpoint{ID: uuid.New(), Type: models.CheckTransaction, URL: server.URL, Steps: tt.steps}
+
+			metric := checkTransaction(ep, http.DefaultTransport)
+			if metric.Success || metric.FailureReason != tt.expected {
+				t.Fatalf("expected the transaction to fail with %q, got %q (%s)", tt.expected, metric.FailureReason, metric.ErrorMessage)
+			}
+			failed := metric.Steps[len(metric.Steps)-1]
+			if failed.Success || failed.FailureReason != tt.expected {
+				t.Errorf("expected the last step result to be the failure, got %+v", failed)
+			}
+			if len(metric.Steps) == len(tt.steps) {
+				t.Error("expected steps after the failure not to run")
+			}
+			if !strings.Contains(metric.ErrorMessage, failed.Name) {
+				t.Errorf("expected the error to name the failing step, got %q", metric.ErrorMessage)
+			}
+		})
+	}
+}
+
+func TestCheckTransactionRedactsExtractedValues(t *testing.T) {
+	server := transactionServer(t)
+
+	// The second step fails to connect, and the error quotes its URL
+	ep := models.MonitoredEndpoint{ID: uuid.New(), Type: models.CheckTransaction, URL: server.URL, Steps: []models.TransactionStep{
+		{Name: "login", Method: "POST", URL: server.URL + "/login", Extract: []models.Extraction{{Name: "token", Source: models.ExtractJSONPath, Expression: "$.access_token"}}},
+		{Name: "orders", URL: "http://127.0.0.1:1/orders?token={{token}}"},
+	}}
+
+	metric := checkTransaction(ep, http.DefaultTransport)
+	if metric.Success {
+		t.Fatal("expected the transaction to fail")
+	}
+	for _, message := range []string{metric.ErrorMessage, metric.Steps[1].ErrorMessage} {
+		if strings.Contains(message, "tok-123") || !strings.Contains(message, "{{token}}") {
+			t.Errorf("expected the extracted token to be redacted, got %q", message)
+		}
+	}
+}
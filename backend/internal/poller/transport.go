@@ -0,0 +1,151 @@
+package poller
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+)
+
+// Most transports with custom settings kept at once. Editing an endpoint or
+// rotating a profile's certificate leaves the old settings' transport unused,
+// so beyond this the least recently used is closed.
+const maxTransports = 64
+
+// Connection settings that need their own transport
+type transportKey struct {
+	proxyURL   string
+	skipVerify bool
+	caBundle   [sha256.Size]byte
+	clientCert [sha256.Size]byte // Certificate and key for mutual TLS
+}
+
+// Transports shared between checks. Endpoints with default connection
+// settings use one pooled transport; endpoints with a proxy or custom TLS
+// settings share a transport with others configured the same way.
+type transportPool struct {
+	base *http.Transport
+	max  int // Transports with custom settings kept before evicting
+
+	mu         sync.Mutex
+	transports map[transportKey]*pooledTransport
+	uses       uint64 // Counts gets, to order transports by when they were last used
+}
+
+type pooledTransport struct {
+	*http.Transport
+	lastUsed uint64
+}
+
+func newTransportPool(limits Limits) *transportPool {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.MaxIdleConns = max(base.MaxIdleConns, limits.MaxConcurrent)
+	base.MaxIdleConnsPerHost = limits.MaxPerHost // 0 keeps the standard library default
+	base.MaxConnsPerHost = limits.MaxPerHost
+
+	return &transportPool{base: base, max: maxTransports, transports: make(map[transportKey]*pooledTransport)}
+}
+
+// Transport to check an endpoint with. profile is the endpoint's auth
+// profile, if it has one, and supplies the client certificate for mutual TLS.
+func (p *transportPool) get(ep models.MonitoredEndpoint, profile *models.AuthProfile) (http.RoundTripper, error) {
+	mtls := profile != nil && profile.Type == models.AuthMTLS
+	if ep.ProxyURL == "" && !ep.TLSSkipVerify && ep.CABundle == "" && !mtls {
+		return p.base, nil
+	}
+
+	key := transportKey{proxyURL: ep.ProxyURL, skipVerify: ep.TLSSkipVerify}
+	if ep.CABundle != "" {
+		key.caBundle = sha256.Sum256([]byte(ep.CABundle))
+	}
+	if mtls {
+		key.clientCert = sha256.Sum256([]byte(profile.ClientCert + "\n" + profile.ClientKey))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.uses++
+	if t, ok := p.transports[key]; ok {
+		t.lastUsed = p.uses
+		return t.Transport, nil
+	}
+
+	t := p.base.Clone()
+	if ep.ProxyURL != "" {
+		proxy, err := url.Parse(ep.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	config, err := tlsConfig(ep, profile)
+	if err != nil {
+		return nil, err
+	}
+	t.TLSClientConfig = config
+
+	if len(p.transports) >= p.max {
+		p.evictLocked()
+	}
+	p.transports[key] = &pooledTransport{Transport: t, lastUsed: p.uses}
+	return t, nil
+}
+
+// Drop the least recently used transport. Requests already using it finish,
+// and its idle connections are closed.
+func (p *transportPool) evictLocked() {
+	var oldest transportKey
+	var oldestUse uint64
+	found := false
+	for key, t := range p.transports {
+		if !found || t.lastUsed < oldestUse {
+			oldest, oldestUse, found = key, t.lastUsed, true
+		}
+	}
+	if found {
+		p.transports[oldest].CloseIdleConnections()
+		delete(p.transports, oldest)
+	}
+}
+
+// TLS settings for an endpoint, nil when it uses the defaults
+func tlsConfig(ep models.MonitoredEndpoint, profile *models.AuthProfile) (*tls.Config, error) {
+	mtls := profile != nil && profile.Type == models.AuthMTLS
+	if !ep.TLSSkipVerify && ep.CABundle == "" && !mtls {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: ep.TLSSkipVerify}
+	if ep.CABundle != "" {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM([]byte(ep.CABundle)) {
+			return nil, errors.New("ca bundle contains no PEM certificates")
+		}
+		config.RootCAs = roots
+	}
+	if mtls {
+		cert, err := tls.X509KeyPair([]byte(profile.ClientCert), []byte(profile.ClientKey))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Close idle connections on every transport
+func (p *transportPool) closeIdle() {
+	p.base.CloseIdleConnections()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.transports {
+		t.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,98 @@
+package poller
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestTransportPoolTLSSettings(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caBundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	tests := []struct {
+		name     string
+		endpoint models.MonitoredEndpoint
+		expected models.FailureReason
+	}{
+		{name: "system roots reject the test certificate", endpoint: models.MonitoredEndpoint{}, expected: models.FailureTLS},
+		{name: "custom CA bundle", endpoint: models.MonitoredEndpoint{CABundle: caBundle}, expected: models.FailureNone},
+		{name: "skip verification", endpoint: models.MonitoredEndpoint{TLSSkipVerify: true}, expected: models.FailureNone},
+	}
+
+	pool := newTransportPool(DefaultLimits)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := tt.endpoint
+			ep.ID, ep.URL = uuid.New(), server.URL
+
+			transport, err := pool.get(ep, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			metric := checkEndpoint(ep, transport)
+			if metric.FailureReason != tt.expected {
+				t.Errorf("expected %q, got %q (%s)", tt.expected, metric.FailureReason, metric.ErrorMessage)
+			}
+		})
+	}
+
+	// Endpoints with the same settings share a transport
+	first, _ := pool.get(models.MonitoredEndpoint{TLSSkipVerify: true}, nil)
+	second, _ := pool.get(models.MonitoredEndpoint{TLSSkipVerify: true, URL: "https://other.example.com"}, nil)
+	if first != second {
+		t.Error("expected endpoints with the same settings to share a transport")
+	}
+}
+
+func TestTransportPoolProxy(t *testing.T) {
+	var proxiedURL string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxy sees the absolute URL of the target
+		proxiedURL = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	ep := models.MonitoredEndpoint{ID: uuid.New(), URL: "http://pulseboard.invalid/health", ProxyURL: proxy.URL}
+	transport, err := newTransportPool(DefaultLimits).get(ep, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metric := checkEndpoint(ep, transport)
+	if !metric.Success {
+		t.Fatalf("expected the check to succeed through the proxy, got %+v", metric)
+	}
+	if proxiedURL != ep.URL {
+		t.Errorf("expected the proxy to receive %s, got %q", ep.URL, proxiedURL)
+	}
+}
+
+func TestTransportPoolEvictsLeastRecentlyUsed(t *testing.T) {
+	pool := newTransportPool(DefaultLimits)
+	pool.max = 2
+
+	first := models.MonitoredEndpoint{ProxyURL: "http://proxy-1.invalid"}
+	second := models.MonitoredEndpoint{ProxyURL: "http://proxy-2.invalid"}
+	firstTransport, _ := pool.get(first, nil)
+	pool.get(second, nil)
+	// Using the first again leaves the second as the least recently used
+	pool.get(first, nil)
+	pool.get(models.MonitoredEndpoint{ProxyURL: "http://proxy-3.invalid"}, nil)
+
+	if len(pool.transports) != 2 {
+		t.Fatalf("expected the pool to stay at 2 transports, got %d", len(pool.transports))
+	}
+	if again, _ := pool.get(first, nil); again != firstTransport {
+		t.Error("expected the recently used transport to be kept")
+	}
+	if _, ok := pool.transports[transportKey{proxyURL: second.ProxyURL}]; ok {
+		t.Error("expected the least recently used transport to be evicted")
+	}
+}
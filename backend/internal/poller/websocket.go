@@ -0,0 +1,163 @@
+package poller
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// How long to wait for the server to answer our close frame, so its close
+// code can be recorded
+const wsCloseWait = time.Second
+
+// Open a WebSocket connection to a ws:// or wss:// endpoint, sending its
+// headers with the opening handshake. If ws_message is set it is sent once
+// connected, and if ws_expect is set a message matching it must arrive within
+// the timeout. config holds the endpoint's TLS settings for wss, nil for the
+// defaults.
+func checkWebSocket(ep models.MonitoredEndpoint, config *tls.Config) models.Metric {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		TLSClientConfig:  config,
+		HandshakeTimeout: ep.Timeout(),
+	}
+	if ep.ProxyURL != "" {
+		proxy, err := url.Parse(ep.ProxyURL)
+		if err != nil {
+			return failedMetric(ep, models.FailureInvalidRequest, err)
+		}
+		dialer.Proxy = http.ProxyURL(proxy)
+	}
+
+	var expect *regexp.Regexp
+	if ep.WSExpect != "" {
+		var err error
+		if expect, err = regexp.Compile(ep.WSExpect); err != nil {
+			return failedMetric(ep, models.FailureInvalidRequest, err)
+		}
+	}
+
+	header := http.Header{}
+	for k, v := range ep.Headers {
+		header.Set(k, v)
+	}
+
+	deadline := time.Now().Add(ep.Timeout())
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	tracer := &phaseTracer{}
+	ctx = httptrace.WithClientTrace(ctx, tracer.clientTrace())
+
+	start := time.Now()
+	conn, resp, err := dialer.DialContext(ctx, ep.URL, header)
+	handshakeDone := time.Now()
+	if err != nil {
+		metric := networkMetric(ep, start, tracer.timings(handshakeDone), err)
+		if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+			metric.StatusCode = resp.StatusCode
+			metric.FailureReason = models.FailureUnexpectedStatus
+			metric.ErrorMessage = fmt.Sprintf("handshake failed with status %d", resp.StatusCode)
+		}
+		return metric
+	}
+	defer conn.Close()
+
+	var firstMessage time.Time
+	closeCode := 0
+	err = exchange(conn, ep.WSMessage, expect, deadline, &firstMessage)
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		closeCode = closeErr.Code
+	} else if err == nil {
+		closeCode = closeConnection(conn)
+	}
+
+	metric := networkMetric(ep, start, tracer.timings(handshakeDone), err)
+	metric.StatusCode = resp.StatusCode
+	metric.HandshakeMS = int(handshakeDone.Sub(start).Milliseconds())
+	metric.FirstMessageMS = elapsedMS(handshakeDone, firstMessage)
+	metric.CloseCode = closeCode
+	if state, ok := conn.NetConn().(*tls.Conn); ok {
+		cs := state.ConnectionState()
+		metric.TLSVersion = tls.VersionName(cs.Version)
+		metric.Certificates = describeChain(ep, cs.PeerCertificates, start)
+	}
+	return metric
+}
+
+// Send message if there is one, then read until a message matches expect or
+// the deadline passes. With no pattern the first message is enough, and with
+// no message or pattern nothing is exchanged.
+func exchange(conn *websocket.Conn, message string, expect *regexp.Regexp, deadline time.Time, firstMessage *time.Time) error {
+	if message != "" {
+		conn.SetWriteDeadline(deadline)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			return err
+		}
+	}
+	if message == "" && expect == nil {
+		return nil
+	}
+
+	conn.SetReadDeadline(deadline)
+	var last []byte
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				return fmt.Errorf("%w: closed before a matching message: %w", errUnexpectedResponse, err)
+			}
+			if last != nil {
+				return fmt.Errorf("%w: no message matched %q, last was %q", errUnexpectedResponse, expect, truncate(last))
+			}
+			return err
+		}
+		if firstMessage.IsZero() {
+			*firstMessage = time.Now()
+		}
+		if expect == nil || expect.Match(data) {
+			return nil
+		}
+		last = data
+	}
+}
+
+// Send a normal close frame and wait briefly for the server's reply,
+// returning the code it closed with or 0 if it didn't answer
+func closeConnection(conn *websocket.Conn) int {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsCloseWait)); err != nil {
+		return 0
+	}
+
+	conn.SetReadDeadline(time.Now().Add(wsCloseWait))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				return closeErr.Code
+			}
+			return 0
+		}
+	}
+}
+
+// Shorten a message for an error, keeping it readable
+func truncate(data []byte) string {
+	const limit = 200
+	if len(data) > limit {
+		return string(data[:limit]) + "..."
+	}
+	return string(data)
+}
@@ -0,0 +1,133 @@
+package poller
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+
+	"github.com/gorilla/websocket"
+)
+
+// Serve WebSocket connections that need an authorization token. /echo sends
+// back each message, /greet says "welcome" first and /bye closes straight
+// away with 1001.
+func webSocketHandler(t *testing.T) http.Handler {
+	upgrader := websocket.Upgrader{}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		switch r.URL.Path {
+		case "/greet":
+			conn.WriteMessage(websocket.TextMessage, []byte("welcome"))
+		case "/bye":
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down"))
+			return
+		}
+		for {
+			kind, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(kind, data)
+		}
+	})
+}
+
+func TestCheckWebSocket(t *testing.T) {
+	server := httptest.NewServer(webSocketHandler(t))
+	defer server.Close()
+	base := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	tests := []struct {
+		name      string
+		path      string
+		token     string
+		message   string
+		expect    string
+		reason    models.FailureReason
+		status    int
+		closeCode int
+	}{
+		{name: "connect only", path: "/echo", token: "Bearer s3cret", reason: models.FailureNone, status: 101, closeCode: websocket.CloseNormalClosure},
+		{name: "echo matches", path: "/echo", token: "Bearer s3cret", message: "ping", expect: "^ping$", reason: models.FailureNone, status: 101, closeCode: websocket.CloseNormalClosure},
+		{name: "echo doesn't match", path: "/echo", token: "Bearer s3cret", message: "ping", expect: "pong", reason: models.FailureUnexpectedResponse, status: 101},
+		{name: "greeting matches", path: "/greet", token: "Bearer s3cret", expect: "welc", reason: models.FailureNone, status: 101, closeCode: websocket.CloseNormalClosure},
+		{name: "closed before match", path: "/bye", token: "Bearer s3cret", expect: "welcome", reason: models.FailureUnexpectedResponse, status: 101, closeCode: websocket.CloseGoingAway},
+		{name: "handshake rejected", path: "/echo", reason: models.FailureUnexpectedStatus, status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := models.MonitoredEndpoint{
+				ID:        uuid.New(),
+				Type:      models.CheckWebSocket,
+				URL:       base + tt.path,
+				TimeoutMS: 500,
+				WSMessage: tt.message,
+				WSExpect:  tt.expect,
+			}
+			if tt.token != "" {
+				ep.Headers = map[string]string{"Authorization": tt.token}
+			}
+
+			metric := checkWebSocket(ep, nil)
+			if metric.FailureReason != tt.reason || metric.Success != (tt.reason == models.FailureNone) {
+				t.Errorf("expected %q, got %q (%s)", tt.reason, metric.FailureReason, metric.ErrorMessage)
+			}
+			if metric.StatusCode != tt.status {
+				t.Errorf("expected status %d, got %d", tt.status, metric.StatusCode)
+			}
+			if metric.CloseCode != tt.closeCode {
+				t.Errorf("expected close code %d, got %d", tt.closeCode, metric.CloseCode)
+			}
+		})
+	}
+}
+
+func TestCheckWebSocketOverTLS(t *testing.T) {
+	server := httptest.NewTLSServer(webSocketHandler(t))
+	defer server.Close()
+	caBundle := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	ep := models.MonitoredEndpoint{
+		ID:        uuid.New(),
+		Type:      models.CheckWebSocket,
+		URL:       "wss" + strings.TrimPrefix(server.URL, "https") + "/greet",
+		Headers:   map[string]string{"Authorization": "Bearer s3cret"},
+		CABundle:  caBundle,
+		WSExpect:  "welcome",
+		TimeoutMS: 500,
+	}
+	config, err := tlsConfig(ep, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metric := checkWebSocket(ep, config)
+	if !metric.Success {
+		t.Fatalf("expected the wss check to pass, got %q (%s)", metric.FailureReason, metric.ErrorMessage)
+	}
+	if metric.TLSVersion == "" || len(metric.Certificates) == 0 {
+		t.Errorf("expected the TLS version and certificate to be recorded, got %q and %d certificates", metric.TLSVersion, len(metric.Certificates))
+	}
+
+	// Without the CA the server's certificate isn't trusted
+	metric = checkWebSocket(ep, nil)
+	if metric.FailureReason != models.FailureTLS {
+		t.Errorf("expected %q, got %q (%s)", models.FailureTLS, metric.FailureReason, metric.ErrorMessage)
+	}
+}
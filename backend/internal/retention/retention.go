@@ -0,0 +1,212 @@
+// Package retention deletes metrics and rollups once they are older than
+// their retention policy allows, so the database doesn't grow without bound.
+package retention
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/AdamGriffiths31/pulseboard/internal/rollup"
+)
+
+const (
+	DefaultInterval = time.Hour
+
+	// Rows deleted per statement. Each batch is its own short write, so
+	// metrics stored by the poller only wait for one batch at a time.
+	DefaultBatchSize = 500
+
+	// Gap between batches, giving other writers a turn at the database
+	batchPause = 20 * time.Millisecond
+)
+
+// Data the pruner deletes, in the order it does so. Day rollups are kept.
+var pruned = []models.Resolution{models.ResolutionRaw, models.ResolutionMinute, models.ResolutionHour}
+
+// Pruner deletes expired data every interval until stopped, then compacts
+// the database
+type Pruner struct {
+	dbClient  db.DBClient
+	defaults  models.RetentionPolicy
+	interval  time.Duration
+	batchSize int
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	status models.PruneStatus
+}
+
+func NewPruner(dbClient db.DBClient, defaults models.RetentionPolicy, interval time.Duration, batchSize int) *Pruner {
+	return &Pruner{
+		dbClient:  dbClient,
+		defaults:  defaults,
+		interval:  interval,
+		batchSize: batchSize,
+		status:    models.PruneStatus{Defaults: defaults},
+	}
+}
+
+// Prune straight away and then every interval, in the background
+func (p *Pruner) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.run(ctx)
+	}()
+}
+
+// Stop pruning, abandoning a run in progress after its current batch
+func (p *Pruner) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+// Where the pruner is up to and how much it has deleted
+func (p *Pruner) Status() models.PruneStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+func (p *Pruner) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.Prune(ctx, time.Now())
+
+		next := time.Now().Add(p.interval)
+		p.update(func(s *models.PruneStatus) { s.NextRunAt = &next })
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Delete everything older than its retention allows, a batch at a time, then
+// compact the database. Progress is reported through Status.
+func (p *Pruner) Prune(ctx context.Context, now time.Time) {
+	p.update(func(s *models.PruneStatus) {
+		*s = models.PruneStatus{Defaults: p.defaults, Running: true, StartedAt: &now}
+	})
+
+	err := p.prune(ctx, now)
+	if ctx.Err() != nil {
+		err = nil // Stopped part way, which isn't a failure
+	} else if err != nil {
+		log.Printf("Error pruning expired metrics: %v", err)
+	}
+
+	finished := time.Now()
+	p.update(func(s *models.PruneStatus) {
+		s.Running = false
+		s.Phase = ""
+		s.FinishedAt = &finished
+		if err != nil {
+			s.LastError = err.Error()
+		}
+	})
+	if err == nil && ctx.Err() == nil {
+		deleted := p.Status().Deleted
+		log.Printf("Pruned %d raw metrics, %d minute rollups and %d hour rollups", deleted.Raw, deleted.Minute, deleted.Hour)
+	}
+}
+
+func (p *Pruner) prune(ctx context.Context, now time.Time) error {
+	endpoints, err := p.dbClient.GetAllEndpoints()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range pruned {
+		p.update(func(s *models.PruneStatus) { s.Phase = string(r) })
+
+		limit, err := p.rolledUpBefore(r)
+		if err != nil {
+			return err
+		}
+		if limit.IsZero() {
+			continue // Nothing has been rolled up yet
+		}
+		for _, ep := range endpoints {
+			cutoff := p.defaults.With(ep.Retention).Cutoff(r, now)
+			if limit.Before(cutoff) {
+				cutoff = limit
+			}
+			if err := p.deleteBatches(ctx, r, ep, cutoff); err != nil {
+				return err
+			}
+		}
+	}
+
+	p.update(func(s *models.PruneStatus) { s.Phase = "compact" })
+	return p.dbClient.Compact()
+}
+
+// Data from before this time has been rolled up into the next resolution for
+// good, so can be deleted without losing it from charts
+func (p *Pruner) rolledUpBefore(r models.Resolution) (time.Time, error) {
+	switch r {
+	case models.ResolutionRaw:
+		// Recent minutes are rolled up again until they settle
+		until, err := p.dbClient.RolledUntil(models.ResolutionMinute)
+		if err != nil || until.IsZero() {
+			return time.Time{}, err
+		}
+		return until.Add(-rollup.DefaultSettle), nil
+	case models.ResolutionMinute:
+		return p.dbClient.RolledUntil(models.ResolutionHour)
+	default:
+		return p.dbClient.RolledUntil(models.ResolutionDay)
+	}
+}
+
+// Delete an endpoint's data from before the cutoff until none is left,
+// pausing between batches
+func (p *Pruner) deleteBatches(ctx context.Context, r models.Resolution, ep models.MonitoredEndpoint, cutoff time.Time) error {
+	for {
+		n, err := p.dbClient.DeleteExpired(r, ep.ID, cutoff, p.batchSize)
+		if err != nil {
+			return err
+		}
+		p.update(func(s *models.PruneStatus) {
+			switch r {
+			case models.ResolutionRaw:
+				s.Deleted.Raw += n
+			case models.ResolutionMinute:
+				s.Deleted.Minute += n
+			default:
+				s.Deleted.Hour += n
+			}
+		})
+		if n < int64(p.batchSize) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(batchPause):
+		}
+	}
+}
+
+func (p *Pruner) update(change func(s *models.PruneStatus)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	change(&p.status)
+}
@@ -0,0 +1,149 @@
+package retention
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/AdamGriffiths31/pulseboard/internal/rollup"
+	"github.com/google/uuid"
+)
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	ep := models.MonitoredEndpoint{ID: uuid.New()}
+	override := models.MonitoredEndpoint{ID: uuid.New(), Retention: &models.RetentionPolicy{RawDays: 1}}
+
+	// Minutes are rolled up to now, but hours only up to 40 days ago and days
+	// not at all
+	rolledUntil := map[models.Resolution]time.Time{
+		models.ResolutionMinute: now,
+		models.ResolutionHour:   now.AddDate(0, 0, -40),
+	}
+
+	type call struct {
+		resolution models.Resolution
+		endpointID uuid.UUID
+		before     time.Time
+	}
+	var calls []call
+	remaining := map[call]int64{}
+	compacted := false
+
+	mock := &db.MockDBClient{
+		GetAllEndpointsFunc: func() ([]models.MonitoredEndpoint, error) {
+			return []models.MonitoredEndpoint{ep, override}, nil
+		},
+		RolledUntilFunc: func(r models.Resolution) (time.Time, error) {
+			return rolledUntil[r], nil
+		},
+		DeleteExpiredFunc: func(r models.Resolution, endpointID uuid.UUID, before time.Time, limit int) (int64, error) {
+			c := call{r, endpointID, before}
+			if len(calls) == 0 || calls[len(calls)-1] != c {
+				calls = append(calls, c)
+				remaining[c] = 5
+			}
+			n := min(remaining[c], int64(limit))
+			remaining[c] -= n
+			return n, nil
+		},
+		CompactFunc: func() error {
+			compacted = true
+			return nil
+		},
+	}
+
+	pruner := NewPruner(mock, models.DefaultRetention, time.Hour, 2)
+	pruner.Prune(context.Background(), now)
+
+	expected := []call{
+		{models.ResolutionRaw, ep.ID, now.AddDate(0, 0, -7)},
+		{models.ResolutionRaw, override.ID, now.AddDate(0, 0, -1)},
+		// Minutes not yet rolled up into hours are kept past their retention
+		{models.ResolutionMinute, ep.ID, now.AddDate(0, 0, -40)},
+		{models.ResolutionMinute, override.ID, now.AddDate(0, 0, -40)},
+	}
+	if len(calls) != len(expected) {
+		t.Fatalf("expected deletes %+v, got %+v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("delete %d: expected %+v, got %+v", i, expected[i], calls[i])
+		}
+	}
+	if !compacted {
+		t.Error("expected the database to be compacted")
+	}
+
+	status := pruner.Status()
+	if status.Running || status.FinishedAt == nil || status.LastError != "" {
+		t.Errorf("expected a finished run, got %+v", status)
+	}
+	if status.Deleted != (models.PruneCounts{Raw: 10, Minute: 10}) {
+		t.Errorf("unexpected deleted counts %+v", status.Deleted)
+	}
+	if status.Defaults != models.DefaultRetention {
+		t.Errorf("expected the default policy, got %+v", status.Defaults)
+	}
+}
+
+func TestPruneKeepsRawMetricsStillBeingRolledUp(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	var before time.Time
+	mock := &db.MockDBClient{
+		GetAllEndpointsFunc: func() ([]models.MonitoredEndpoint, error) {
+			return []models.MonitoredEndpoint{{ID: uuid.New(), Retention: &models.RetentionPolicy{RawDays: 1}}}, nil
+		},
+		RolledUntilFunc: func(r models.Resolution) (time.Time, error) {
+			if r == models.ResolutionMinute {
+				return now.AddDate(0, 0, -2), nil
+			}
+			return time.Time{}, nil
+		},
+		DeleteExpiredFunc: func(r models.Resolution, endpointID uuid.UUID, cutoff time.Time, limit int) (int64, error) {
+			before = cutoff
+			return 0, nil
+		},
+		CompactFunc: func() error { return nil },
+	}
+
+	NewPruner(mock, models.DefaultRetention, time.Hour, DefaultBatchSize).Prune(context.Background(), now)
+
+	if want := now.AddDate(0, 0, -2).Add(-rollup.DefaultSettle); !before.Equal(want) {
+		t.Errorf("expected raw metrics before %v to be deleted, got %v", want, before)
+	}
+}
+
+func TestPruneStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	deletes := 0
+	mock := &db.MockDBClient{
+		GetAllEndpointsFunc: func() ([]models.MonitoredEndpoint, error) {
+			return []models.MonitoredEndpoint{{ID: uuid.New()}}, nil
+		},
+		RolledUntilFunc: func(r models.Resolution) (time.Time, error) {
+			return time.Now(), nil
+		},
+		DeleteExpiredFunc: func(r models.Resolution, endpointID uuid.UUID, before time.Time, limit int) (int64, error) {
+			deletes++
+			cancel() // Always a full batch, so only cancelling stops it
+			return int64(limit), nil
+		},
+		CompactFunc: func() error {
+			t.Error("expected a cancelled prune not to compact")
+			return nil
+		},
+	}
+
+	pruner := NewPruner(mock, models.DefaultRetention, time.Hour, DefaultBatchSize)
+	pruner.Prune(ctx, time.Now())
+
+	if deletes != 1 {
+		t.Errorf("expected pruning to stop after the first batch, got %d", deletes)
+	}
+	if status := pruner.Status(); status.Running || status.LastError != "" {
+		t.Errorf("expected a stopped run without an error, got %+v", status)
+	}
+}
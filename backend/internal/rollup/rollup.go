@@ -0,0 +1,77 @@
+// Package rollup keeps the metric rollups charts are read from up to date
+// by aggregating new metrics in the background.
+package rollup
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+)
+
+const (
+	DefaultInterval = time.Minute
+
+	// How long after its timestamp a metric may still be written. Metrics
+	// are stamped when the check or ping completes and stored straight
+	// away, so this only has to cover a write held up behind others on the
+	// database or landing just after a rollup read its minute; minutes are
+	// rolled up again until they are this old.
+	DefaultSettle = 2 * time.Minute
+)
+
+// Job rolls up metrics every interval until stopped
+type Job struct {
+	dbClient db.DBClient
+	interval time.Duration
+	settle   time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewJob(dbClient db.DBClient, interval, settle time.Duration) *Job {
+	return &Job{dbClient: dbClient, interval: interval, settle: settle}
+}
+
+// Roll up straight away and then every interval, in the background
+func (j *Job) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.run(ctx)
+	}()
+}
+
+// Stop rolling up, waiting for a run in progress to finish
+func (j *Job) Stop() {
+	if j.cancel != nil {
+		j.cancel()
+	}
+	j.wg.Wait()
+}
+
+func (j *Job) run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := j.dbClient.RollUpMetrics(start, j.settle); err != nil {
+			log.Printf("Error rolling up metrics: %v", err)
+		} else if took := time.Since(start); took > j.interval/2 {
+			log.Printf("Rolling up metrics took %v", took)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
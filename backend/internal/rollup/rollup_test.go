@@ -0,0 +1,42 @@
+package rollup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+)
+
+func TestJobRollsUpUntilStopped(t *testing.T) {
+	runs := make(chan time.Duration, 10)
+	mock := &db.MockDBClient{
+		RollUpMetricsFunc: func(now time.Time, settle time.Duration) error {
+			runs <- settle
+			return nil
+		},
+	}
+
+	job := NewJob(mock, 10*time.Millisecond, DefaultSettle)
+	job.Start()
+
+	// Runs straight away and then on the interval
+	for i := 0; i < 2; i++ {
+		select {
+		case settle := <-runs:
+			if settle != DefaultSettle {
+				t.Errorf("expected settle %v, got %v", DefaultSettle, settle)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the job to roll up metrics")
+		}
+	}
+
+	job.Stop()
+	for len(runs) > 0 {
+		<-runs
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(runs) != 0 {
+		t.Error("expected no runs after Stop")
+	}
+}
@@ -0,0 +1,107 @@
+// Package secrets encrypts values that must not be stored in plain text.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Marks a sealed value so it can be told apart from plain text written
+// before encryption was added
+const sealedPrefix = "enc:v1:"
+
+var ErrNoKey = errors.New("value is encrypted but no secret key is configured")
+
+// Box seals and opens values with AES-256-GCM
+type Box struct {
+	aead cipher.AEAD
+}
+
+// Create a Box from a key of any length. The key is hashed to 32 bytes.
+func NewBox(key []byte) (*Box, error) {
+	if len(key) == 0 {
+		return nil, errors.New("secret key is empty")
+	}
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Encrypt a value, returning printable text
+func (b *Box) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt a value from Seal. Values that were never sealed are returned as-is.
+func (b *Box) Open(value string) (string, error) {
+	if !IsSealed(value) {
+		return value, nil
+	}
+	if b == nil {
+		return "", ErrNoKey
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("decoding sealed value: %w", err)
+	}
+	if len(data) < b.aead.NonceSize() {
+		return "", errors.New("sealed value is too short")
+	}
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	plaintext, err := b.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypting sealed value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Whether a value was produced by Seal
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+// Read the key at path, creating a random one readable only by the owner if
+// the file doesn't exist
+func LoadOrCreateKey(path string) ([]byte, error) {
+	key, err := os.ReadFile(path)
+	if err == nil {
+		key = []byte(strings.TrimSpace(string(key)))
+		if len(key) == 0 {
+			return nil, fmt.Errorf("secret key file %s is empty", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	key = []byte(base64.StdEncoding.EncodeToString(raw))
+	if err := os.WriteFile(path, append(key, '\n'), 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,57 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealAndOpen(t *testing.T) {
+	box, err := NewBox([]byte("test key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := box.Seal("Bearer abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || bytes.Contains([]byte(sealed), []byte("abc123")) {
+		t.Fatalf("expected an opaque sealed value, got %q", sealed)
+	}
+
+	opened, err := box.Open(sealed)
+	if err != nil || opened != "Bearer abc123" {
+		t.Fatalf("expected the original value back, got %q (%v)", opened, err)
+	}
+
+	// Values stored before encryption was enabled pass through
+	if plain, err := box.Open("Pulseboard-Poller"); err != nil || plain != "Pulseboard-Poller" {
+		t.Errorf("expected plain text to pass through, got %q (%v)", plain, err)
+	}
+
+	other, _ := NewBox([]byte("another key"))
+	if _, err := other.Open(sealed); err == nil {
+		t.Error("expected a different key to fail to open the value")
+	}
+
+	var none *Box
+	if _, err := none.Open(sealed); !errors.Is(err, ErrNoKey) {
+		t.Errorf("expected ErrNoKey without a key, got %v", err)
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.key")
+
+	created, err := LoadOrCreateKey(path)
+	if err != nil || len(created) == 0 {
+		t.Fatalf("expected a key to be created, got %q (%v)", created, err)
+	}
+
+	loaded, err := LoadOrCreateKey(path)
+	if err != nil || !bytes.Equal(created, loaded) {
+		t.Errorf("expected the same key to be loaded again, got %q (%v)", loaded, err)
+	}
+}
@@ -0,0 +1,131 @@
+// Package sketch estimates quantiles of a distribution from a small summary
+// that can be stored and merged.
+package sketch
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+)
+
+// RelativeAccuracy bounds the error of a quantile relative to its true value,
+// so p99 of a 2000ms latency is reported within 20ms
+const RelativeAccuracy = 0.01
+
+var (
+	gamma    = (1 + RelativeAccuracy) / (1 - RelativeAccuracy)
+	logGamma = math.Log(gamma)
+)
+
+// Values at or below this are counted as zero rather than given a bin
+const minIndexable = 1e-3
+
+// Sketch summarises a distribution of non-negative values, such as latencies,
+// so its quantiles can be estimated without keeping every value. Values are
+// counted in logarithmically sized bins, which keeps the error relative to the
+// value. Sketches of the same kind of value can be merged, so a quantile over
+// an hour can be built from sketches of each minute.
+//
+// The zero value is an empty sketch ready to use.
+type Sketch struct {
+	zeros uint64
+	bins  map[int]uint64
+	count uint64
+}
+
+// Add a value. Negative values are counted as zero.
+func (s *Sketch) Add(v float64) {
+	s.count++
+	if v <= minIndexable {
+		s.zeros++
+		return
+	}
+	if s.bins == nil {
+		s.bins = make(map[int]uint64)
+	}
+	s.bins[int(math.Ceil(math.Log(v)/logGamma))]++
+}
+
+// Add every value counted by another sketch
+func (s *Sketch) Merge(other *Sketch) {
+	if other == nil {
+		return
+	}
+	s.count += other.count
+	s.zeros += other.zeros
+	if len(other.bins) > 0 && s.bins == nil {
+		s.bins = make(map[int]uint64, len(other.bins))
+	}
+	for i, n := range other.bins {
+		s.bins[i] += n
+	}
+}
+
+// Number of values added
+func (s *Sketch) Count() uint64 {
+	return s.count
+}
+
+// Estimate the value at quantile q, between 0 and 1. Returns 0 for an empty
+// sketch.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	q = min(max(q, 0), 1)
+
+	// Nearest rank of the value wanted, counting from 0
+	rank := uint64(max(math.Ceil(q*float64(s.count))-1, 0))
+	if rank < s.zeros {
+		return 0
+	}
+	seen := s.zeros
+	for _, i := range s.indexes() {
+		seen += s.bins[i]
+		if seen > rank {
+			// Midpoint of the bin in relative terms, which bounds the error
+			return 2 * math.Pow(gamma, float64(i)) / (gamma + 1)
+		}
+	}
+	return 0 // Not reached while the counts are consistent
+}
+
+func (s *Sketch) indexes() []int {
+	indexes := make([]int, 0, len(s.bins))
+	for i := range s.bins {
+		indexes = append(indexes, i)
+	}
+	slices.Sort(indexes)
+	return indexes
+}
+
+// Stored form of a sketch, with bins as [index, count] pairs in index order
+type sketchJSON struct {
+	Zeros uint64      `json:"zeros,omitempty"`
+	Bins  [][2]uint64 `json:"bins,omitempty"`
+}
+
+func (s *Sketch) MarshalJSON() ([]byte, error) {
+	raw := sketchJSON{Zeros: s.zeros}
+	for _, i := range s.indexes() {
+		// Indexes are offset so negative ones, for values below 1, fit
+		raw.Bins = append(raw.Bins, [2]uint64{uint64(i - math.MinInt32), s.bins[i]})
+	}
+	return json.Marshal(raw)
+}
+
+func (s *Sketch) UnmarshalJSON(data []byte) error {
+	var raw sketchJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = Sketch{zeros: raw.Zeros, count: raw.Zeros}
+	for _, bin := range raw.Bins {
+		if s.bins == nil {
+			s.bins = make(map[int]uint64, len(raw.Bins))
+		}
+		s.bins[int(bin[0])+math.MinInt32] += bin[1]
+		s.count += bin[1]
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package sketch
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// Value at quantile q of sorted values, using the same rank as Quantile
+func exactQuantile(sorted []float64, q float64) float64 {
+	return sorted[max(int(math.Ceil(q*float64(len(sorted))))-1, 0)]
+}
+
+func TestQuantileWithinRelativeAccuracy(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	var s Sketch
+	values := make([]float64, 10000)
+	for i := range values {
+		// Long-tailed, like latencies
+		values[i] = math.Exp(rng.NormFloat64()) * 200
+		s.Add(values[i])
+	}
+	slices.Sort(values)
+
+	if s.Count() != uint64(len(values)) {
+		t.Fatalf("expected count %d, got %d", len(values), s.Count())
+	}
+	for _, q := range []float64{0, 0.5, 0.9, 0.95, 0.99, 1} {
+		want := exactQuantile(values, q)
+		got := s.Quantile(q)
+		if math.Abs(got-want) > want*RelativeAccuracy {
+			t.Errorf("q%v: expected %v within %v%%, got %v", q, want, RelativeAccuracy*100, got)
+		}
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		q      float64
+		want   float64
+	}{
+		{name: "empty", q: 0.5, want: 0},
+		{name: "zeros", values: []float64{0, 0, 0}, q: 0.99, want: 0},
+		{name: "negative counted as zero", values: []float64{-5, 100}, q: 0, want: 0},
+		{name: "single value", values: []float64{250}, q: 0.5, want: 250},
+		{name: "mixed with zeros", values: []float64{0, 0, 1000, 1000}, q: 1, want: 1000},
+		{name: "quantile clamped", values: []float64{10, 20}, q: 2, want: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Sketch
+			for _, v := range tt.values {
+				s.Add(v)
+			}
+			if got := s.Quantile(tt.q); math.Abs(got-tt.want) > tt.want*RelativeAccuracy {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMergeMatchesAddingEverything(t *testing.T) {
+	var whole, a, b Sketch
+	for i := 1; i <= 1000; i++ {
+		whole.Add(float64(i))
+		if i%3 == 0 {
+			a.Add(float64(i))
+		} else {
+			b.Add(float64(i))
+		}
+	}
+	a.Merge(&b)
+	a.Merge(nil)
+
+	if a.Count() != whole.Count() {
+		t.Fatalf("expected count %d, got %d", whole.Count(), a.Count())
+	}
+	for _, q := range []float64{0.1, 0.5, 0.99} {
+		if a.Quantile(q) != whole.Quantile(q) {
+			t.Errorf("q%v: expected %v, got %v", q, whole.Quantile(q), a.Quantile(q))
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	var s Sketch
+	for _, v := range []float64{0, 0.5, 3, 42, 42, 9000} {
+		s.Add(v)
+	}
+
+	data, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Sketch
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Count() != s.Count() {
+		t.Fatalf("expected count %d, got %d", s.Count(), decoded.Count())
+	}
+	for _, q := range []float64{0, 0.25, 0.5, 0.75, 1} {
+		if decoded.Quantile(q) != s.Quantile(q) {
+			t.Errorf("q%v: expected %v, got %v", q, s.Quantile(q), decoded.Quantile(q))
+		}
+	}
+
+	// An empty sketch stores as an empty object
+	data, err = json.Marshal(&Sketch{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "{}" {
+		t.Errorf("expected {}, got %s", data)
+	}
+}
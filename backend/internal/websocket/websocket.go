@@ -1,28 +1,62 @@
 package websocket
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 	"time"
 
-	"math/rand"
-
 	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
 	"github.com/AdamGriffiths31/pulseboard/internal/models"
-	"github.com/google/uuid"
 
 	"github.com/gorilla/websocket"
 )
 
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+)
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
-func HandleWebSocket(w http.ResponseWriter, r *http.Request, dbClient *db.SQLiteClient) {
+// Message sent by a client to change which metrics it receives
+type ClientMessage struct {
+	Action string `json:"action"` // "subscribe" or "unsubscribe"
+	hub.Filter
+}
+
+// Message sent back to a client in reply to a ClientMessage
+type ServerMessage struct {
+	Type   string      `json:"type"` // "filter" or "error"
+	Filter *hub.Filter `json:"filter,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Handle a live metrics connection. Recent history is replayed from the
+// database first, either the last `minutes` minutes or everything after the
+// `since` cursor when a client is resuming, before switching to live events. The
+// initial filter can be given as query parameters, see hub.FilterFromQuery.
+func HandleWebSocket(w http.ResponseWriter, r *http.Request, metricsHub *hub.Hub, dbClient db.DBClient) {
 	log.Printf("Received WebSocket connection from %s", r.RemoteAddr)
 
+	query := r.URL.Query()
+	cursor, err := hub.BackfillStart(query.Get("since"), query.Get("minutes"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := hub.FilterFromQuery(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WebSocket upgrade failed:", err)
@@ -32,44 +66,107 @@ func HandleWebSocket(w http.ResponseWriter, r *http.Request, dbClient *db.SQLite
 
 	log.Println("WebSocket connection established")
 
-	ticker := time.NewTicker(5 * time.Second) // Send updates every 5 seconds
+	// History is replayed a page per message before subscribing, and anything
+	// also caught up after subscribing is skipped below
+	sub, replayed, err := metricsHub.Replay(dbClient, cursor, filter, func(metrics []models.Metric) error {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return conn.WriteJSON(metrics)
+	})
+	if err != nil {
+		log.Println("Error sending backfill over WebSocket:", err)
+		return
+	}
+	defer metricsHub.Unsubscribe(sub)
+
+	// Replies are written by the loop below, since gorilla connections only
+	// support one concurrent writer
+	replies := make(chan ServerMessage, 8)
+	done := make(chan struct{})
+	go readLoop(conn, sub, replies, done)
+
+	ticker := time.NewTicker(pingPeriod)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		data := getTestData() // Generate fake data
-		if err := conn.WriteJSON(data); err != nil {
-			log.Println("Error sending data over WebSocket:", err)
+	for {
+		select {
+		case metric, ok := <-sub.C:
+			if !ok {
+				log.Printf("Dropping slow WebSocket client %s", r.RemoteAddr)
+				return
+			}
+			if _, ok := replayed[metric.ID]; ok {
+				delete(replayed, metric.ID)
+				continue
+			}
+			// The dashboard expects an array of metrics per message
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON([]models.Metric{metric}); err != nil {
+				log.Println("Error sending data over WebSocket:", err)
+				return
+			}
+		case reply := <-replies:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteJSON(reply); err != nil {
+				log.Println("Error sending reply over WebSocket:", err)
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-done:
+			log.Printf("WebSocket connection from %s closed", r.RemoteAddr)
+			return
+		}
+	}
+}
+
+// Read subscribe/unsubscribe messages until the client goes away
+func readLoop(conn *websocket.Conn, sub *hub.Subscriber, replies chan<- ServerMessage, done chan<- struct{}) {
+	defer close(done)
+
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
 			return
 		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		reply := applyClientMessage(sub, data)
+		select {
+		case replies <- reply:
+		default:
+			// The writer is backed up; the client can re-send if it needs the ack
+		}
 	}
 }
 
-func getTestData() []models.Metric {
-	rand.Seed(time.Now().UnixNano()) // Seed the random number generator using math/rand
-	return []models.Metric{
-		{
-			ID:         uuid.New(),
-			EndpointID: uuid.New(),
-			Timestamp:  time.Now(),
-			StatusCode: 200,
-			LatencyMS:  rand.Intn(500), // Random latency between 0 and 499 ms
-			URL:        "https://api.github.com",
-		},
-		{
-			ID:         uuid.New(),
-			EndpointID: uuid.New(),
-			Timestamp:  time.Now(),
-			StatusCode: 200,
-			LatencyMS:  rand.Intn(500), // Random latency between 0 and 499 ms
-			URL:        "https://httpstat.us/200",
-		},
-		{
-			ID:         uuid.New(),
-			EndpointID: uuid.New(),
-			Timestamp:  time.Now(),
-			StatusCode: 503,
-			LatencyMS:  rand.Intn(500), // Random latency between 0 and 499 ms
-			URL:        "https://httpstat.us/503",
-		},
+func applyClientMessage(sub *hub.Subscriber, data []byte) ServerMessage {
+	var msg ClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return ServerMessage{Type: "error", Error: "invalid message: " + err.Error()}
+	}
+
+	current := sub.Filter()
+	var next hub.Filter
+	switch msg.Action {
+	case "subscribe":
+		next = current.Merge(msg.Filter)
+	case "unsubscribe":
+		next = current.Without(msg.Filter)
+	default:
+		return ServerMessage{Type: "error", Error: "unknown action: " + msg.Action}
+	}
+
+	if err := sub.SetFilter(next); err != nil {
+		return ServerMessage{Type: "error", Error: err.Error()}
 	}
+
+	return ServerMessage{Type: "filter", Filter: &next}
 }
@@ -0,0 +1,270 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AdamGriffiths31/pulseboard/internal/db"
+	"github.com/AdamGriffiths31/pulseboard/internal/hub"
+	"github.com/AdamGriffiths31/pulseboard/internal/models"
+	"github.com/google/uuid"
+
+	"github.com/gorilla/websocket"
+)
+
+func emptyHistory() *db.MockDBClient {
+	return &db.MockDBClient{
+		GetMetricsAfterFunc: func(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error) {
+			return nil, nil
+		},
+	}
+}
+
+// Page of history after a cursor, as the database would return it. history
+// must be in cursor order.
+func pageAfter(history []models.Metric, cursor models.MetricCursor, filter hub.Filter, limit int) []models.Metric {
+	var page []models.Metric
+	for _, m := range history {
+		if len(page) == limit {
+			break
+		}
+		after := m.Timestamp.After(cursor.Timestamp) || m.Timestamp.Equal(cursor.Timestamp) && m.ID.String() > cursor.ID.String()
+		if after && filter.Matches(m) {
+			page = append(page, m)
+		}
+	}
+	return page
+}
+
+func dialTestServer(t *testing.T, metricsHub *hub.Hub, dbClient db.DBClient, query string) *websocket.Conn {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleWebSocket(w, r, metricsHub, dbClient)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+query, nil)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func waitForSubscribers(t *testing.T, metricsHub *hub.Hub, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for metricsHub.Len() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscribers, got %d", n, metricsHub.Len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHandleWebSocketForwardsPublishedMetrics(t *testing.T) {
+	metricsHub := hub.New(4)
+	conn := dialTestServer(t, metricsHub, emptyHistory(), "")
+	waitForSubscribers(t, metricsHub, 1)
+
+	metric := models.Metric{ID: uuid.New(), StatusCode: 200, LatencyMS: 12, URL: "https://example.com"}
+	metricsHub.Publish(metric)
+
+	var got []models.Metric
+	if err := conn.ReadJSON(&got); err != nil {
+		t.Fatalf("failed to read metric: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != metric.ID {
+		t.Errorf("unexpected payload: %+v", got)
+	}
+}
+
+func TestHandleWebSocketAppliesSubscriptionFilter(t *testing.T) {
+	metricsHub := hub.New(4)
+	conn := dialTestServer(t, metricsHub, emptyHistory(), "")
+	waitForSubscribers(t, metricsHub, 1)
+
+	wanted := uuid.New()
+	if err := conn.WriteJSON(map[string]any{"action": "subscribe", "endpoint_ids": []uuid.UUID{wanted}}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	var ack ServerMessage
+	if err := conn.ReadJSON(&ack); err != nil {
+		t.Fatalf("failed to read ack: %v", err)
+	}
+	if ack.Type != "filter" || ack.Filter == nil || len(ack.Filter.EndpointIDs) != 1 {
+		t.Fatalf("unexpected ack: %+v", ack)
+	}
+
+	metricsHub.Publish(models.Metric{ID: uuid.New(), EndpointID: uuid.New()})
+	matching := models.Metric{ID: uuid.New(), EndpointID: wanted}
+	metricsHub.Publish(matching)
+
+	var got []models.Metric
+	if err := conn.ReadJSON(&got); err != nil {
+		t.Fatalf("failed to read metric: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != matching.ID {
+		t.Errorf("expected only the matching metric, got %+v", got)
+	}
+}
+
+func TestHandleWebSocketRejectsInvalidMessages(t *testing.T) {
+	metricsHub := hub.New(4)
+	conn := dialTestServer(t, metricsHub, emptyHistory(), "")
+	waitForSubscribers(t, metricsHub, 1)
+
+	messages := []string{
+		`not json`,
+		`{"action":"explode"}`,
+		`{"action":"subscribe","status_classes":["9xx"]}`,
+	}
+
+	for _, msg := range messages {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatalf("failed to send message: %v", err)
+		}
+		var reply ServerMessage
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("failed to read reply: %v", err)
+		}
+		if reply.Type != "error" || reply.Error == "" {
+			t.Errorf("expected error reply for %q, got %+v", msg, reply)
+		}
+	}
+}
+
+func TestHandleWebSocketReplaysHistoryWithoutDuplicates(t *testing.T) {
+	since := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	history := []models.Metric{
+		{ID: uuid.New(), Timestamp: since.Add(time.Second)},
+		{ID: uuid.New(), Timestamp: since.Add(2 * time.Second)},
+	}
+
+	var requestedSince time.Time
+	mock := &db.MockDBClient{
+		GetMetricsAfterFunc: func(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error) {
+			if requestedSince.IsZero() {
+				requestedSince = cursor.Timestamp
+			}
+			return pageAfter(history, cursor, filter, limit), nil
+		},
+	}
+
+	metricsHub := hub.New(4)
+	conn := dialTestServer(t, metricsHub, mock, "?since="+since.Format(time.RFC3339))
+
+	var replayed []models.Metric
+	if err := conn.ReadJSON(&replayed); err != nil {
+		t.Fatalf("failed to read backfill: %v", err)
+	}
+	if len(replayed) != len(history) {
+		t.Fatalf("expected %d replayed metrics, got %d", len(history), len(replayed))
+	}
+	if time.Since(requestedSince) > 2*time.Minute {
+		t.Errorf("expected backfill to start from since, got %s", requestedSince)
+	}
+
+	// A metric that was both stored and published must only be delivered once
+	metricsHub.Publish(history[1])
+	live := models.Metric{ID: uuid.New()}
+	metricsHub.Publish(live)
+
+	var got []models.Metric
+	if err := conn.ReadJSON(&got); err != nil {
+		t.Fatalf("failed to read live metric: %v", err)
+	}
+	if len(got) != 1 || got[0].ID != live.ID {
+		t.Errorf("expected only the new live metric, got %+v", got)
+	}
+}
+
+func TestHandleWebSocketReplaysLongHistoryWithoutDroppingClient(t *testing.T) {
+	// More history than fits in a page, with a live metric stored and
+	// published during every read, which together would overflow the buffer
+	since := time.Now().Add(-time.Hour).UTC().Truncate(time.Millisecond)
+	var history []models.Metric
+	for i := range 2*hub.ReplayPageSize + 10 {
+		history = append(history, models.Metric{ID: uuid.New(), Timestamp: since.Add(time.Duration(i) * time.Millisecond)})
+	}
+
+	metricsHub := hub.New(4)
+	var mu sync.Mutex
+	mock := &db.MockDBClient{
+		GetMetricsAfterFunc: func(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error) {
+			mu.Lock()
+			live := models.Metric{ID: uuid.New(), Timestamp: time.Now().UTC().Truncate(time.Millisecond)}
+			history = append(history, live)
+			page := pageAfter(history, cursor, filter, limit)
+			mu.Unlock()
+			metricsHub.Publish(live)
+			return page, nil
+		},
+	}
+	conn := dialTestServer(t, metricsHub, mock, "?minutes=120")
+
+	received := make(map[uuid.UUID]int)
+	for {
+		var got []models.Metric
+		if err := conn.ReadJSON(&got); err != nil {
+			t.Fatalf("expected the client to stay connected, got %v", err)
+		}
+		if len(got) > hub.ReplayPageSize {
+			t.Errorf("expected at most a page per message, got %d", len(got))
+		}
+		for _, m := range got {
+			received[m.ID]++
+		}
+		mu.Lock()
+		done := len(received) == len(history)
+		mu.Unlock()
+		if done {
+			break
+		}
+	}
+
+	// A final metric shows the live feed is still running
+	live := models.Metric{ID: uuid.New()}
+	metricsHub.Publish(live)
+	var got []models.Metric
+	if err := conn.ReadJSON(&got); err != nil || len(got) != 1 || got[0].ID != live.ID {
+		t.Fatalf("expected the live metric, got %+v (%v)", got, err)
+	}
+	for id, n := range received {
+		if n != 1 {
+			t.Errorf("expected %s once, got %d", id, n)
+		}
+	}
+}
+
+func TestHandleWebSocketResumesFromCursor(t *testing.T) {
+	// Two metrics stored in the same millisecond, the first already received
+	at := time.Now().Add(-time.Minute).UTC().Truncate(time.Millisecond)
+	history := []models.Metric{{ID: uuid.New(), Timestamp: at}, {ID: uuid.New(), Timestamp: at}}
+	if history[0].ID.String() > history[1].ID.String() {
+		history[0], history[1] = history[1], history[0]
+	}
+	mock := &db.MockDBClient{
+		GetMetricsAfterFunc: func(cursor models.MetricCursor, filter hub.Filter, limit int) ([]models.Metric, error) {
+			return pageAfter(history, cursor, filter, limit), nil
+		},
+	}
+
+	conn := dialTestServer(t, hub.New(4), mock, "?since="+url.QueryEscape(history[0].Cursor().String()))
+
+	var replayed []models.Metric
+	if err := conn.ReadJSON(&replayed); err != nil {
+		t.Fatalf("failed to read backfill: %v", err)
+	}
+	if len(replayed) != 1 || replayed[0].ID != history[1].ID {
+		t.Errorf("expected only the metric after the cursor, got %+v", replayed)
+	}
+}
@@ -1,12 +1,12 @@
 import { useEffect, useState } from 'react';
-import { fetchLatencyMetrics, fetchStatusCodeDistributionMetrics } from './api';
+import { fetchLatencyRollups, fetchStatusCodeDistributionMetrics } from './api';
 import useWebSocketMetrics from './hooks/useWebSocketMetrics';
 import LatencyChart from './components/LatencyChart';
 import StatusCodePieChart from './components/StatusCodePieChart';
 import './tailwind.css';
 
 function App() {
-  const [metrics, setMetrics] = useState([]);
+  const [metrics, setMetrics] = useState({});
   const [statusCodes, setStatusCodes] = useState({});
   const [loading, setLoading] = useState(true);
   const liveData = useWebSocketMetrics();
@@ -23,23 +23,19 @@ function App() {
     const formattedEndDate = new Date(endDate).toISOString();
 
     Promise.all([
-      fetchLatencyMetrics(formattedStartDate, formattedEndDate),
+      fetchLatencyRollups(formattedStartDate, formattedEndDate),
       fetchStatusCodeDistributionMetrics(formattedStartDate, formattedEndDate),
     ])
       .then(([latencyData, statusCodeData]) => {
-        const groupedLatency = latencyData.reduce((acc, metric) => {
-          if (!acc[metric.endpoint_id]) {
-            acc[metric.endpoint_id] = {
-              url: metric.url,
-              data: [],
-            };
-          }
-          acc[metric.endpoint_id].data.push({
-            timestamp: new Date(metric.timestamp).toLocaleString(),
-            latency: metric.latency_ms,
-          });
-          return acc;
-        }, {});
+        const groupedLatency = Object.fromEntries(
+          Object.entries(latencyData.endpoints || {}).map(([url, buckets]) => [
+            url,
+            buckets.map(bucket => ({
+              timestamp: new Date(bucket.bucket_start).toLocaleString(),
+              latency: Math.round(bucket.avg_latency_ms),
+            })),
+          ])
+        );
 
         setMetrics(groupedLatency);
         setStatusCodes(statusCodeData);
@@ -53,7 +49,7 @@ function App() {
 
   const allUrls = [
     ...new Set([
-      ...Object.values(metrics).map(m => m.url),
+      ...Object.keys(metrics),
       ...Object.keys(statusCodes),
       ...Object.keys(liveData),
     ])
@@ -110,15 +106,12 @@ function App() {
           <h3 className="text-xl font-bold mb-6 text-left">Latency</h3>
           <hr className="border-gray-700 mb-6" />
           <div className="grid grid-cols-1 sm:grid-cols-2 lg:grid-cols-3 gap-6">
-            {allUrls.map((url) => {
-              const endpointId = Object.keys(metrics).find(id => metrics[id].url === url);
-              return (
-                <div key={url} className="bg-gray-800 p-6 rounded-lg shadow-lg">
-                  <h4 className="text-lg font-semibold mb-4 text-center">{url}</h4>
-                  <LatencyChart data={endpointId ? metrics[endpointId].data : []} />
-                </div>
-              );
-            })}
+            {allUrls.map((url) => (
+              <div key={url} className="bg-gray-800 p-6 rounded-lg shadow-lg">
+                <h4 className="text-lg font-semibold mb-4 text-center">{url}</h4>
+                <LatencyChart data={metrics[url] || []} />
+              </div>
+            ))}
           </div>
 
           {/* Status Code Section */}
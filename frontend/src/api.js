@@ -2,20 +2,22 @@ import axios from "axios";
 
 const API_BASE_URL = "http://localhost:8080"; // Backend URL
 
-// Fetch latency metrics with startDate and endDate
-export const fetchLatencyMetrics = async (startDate, endDate) => {
+// Fetch latency rollups with startDate and endDate. Buckets come from the
+// resolution that suits the range, so older data that has been pruned from
+// raw metrics is still charted.
+export const fetchLatencyRollups = async (startDate, endDate) => {
   try {
-    console.log("Requesting latency metrics with params:", { startDate, endDate });
-    const response = await axios.get(`${API_BASE_URL}/getlatency`, {
+    console.log("Requesting latency rollups with params:", { startDate, endDate });
+    const response = await axios.get(`${API_BASE_URL}/latencyrollups`, {
       params: {
         startDate: startDate,
-        endDate: endDate,    
+        endDate: endDate,
       },
     });
     return response.data; // Return the fetched data
   } catch (error) {
-    console.error("Error fetching latency metrics:", error);
-    return [];
+    console.error("Error fetching latency rollups:", error);
+    return { endpoints: {} };
   }
 };
 
@@ -1,21 +1,31 @@
 import { PieChart, Pie, Cell, Tooltip, Legend, ResponsiveContainer } from 'recharts';
 
+// Checks without HTTP (TCP, DNS, TLS, heartbeats) have no status code, so
+// slices are labelled up or down as well
+const sliceLabel = ({ status_code, success }) => {
+  if (status_code === 0) {
+    return success ? 'up' : 'down';
+  }
+  return success ? `${status_code}` : `${status_code} (down)`;
+};
+
 const StatusCodePieChart = ({ data }) => {
-  const COLORS = data.map(item => (item.status_code >= 200 && item.status_code < 300 ? '#22c55e' : '#ef4444'));
+  const slices = data.map(item => ({ ...item, label: sliceLabel(item) }));
+  const COLORS = slices.map(item => (item.success ? '#22c55e' : '#ef4444'));
 
   return (
     <ResponsiveContainer width="100%" height={250}>
       <PieChart>
         <Pie
-          data={data}
+          data={slices}
           dataKey="count"
-          nameKey="status_code"
+          nameKey="label"
           cx="50%"
           cy="50%"
           outerRadius={80}
-          label={({ status_code }) => status_code}
+          label={({ label }) => label}
         >
-          {data.map((entry, index) => (
+          {slices.map((entry, index) => (
             <Cell key={`cell-${index}`} fill={COLORS[index]} />
           ))}
         </Pie>
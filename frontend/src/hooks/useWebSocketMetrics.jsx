@@ -1,52 +1,86 @@
 import { useEffect, useState } from 'react';
 
+const RECONNECT_DELAY_MS = 3000;
+
+// Whether metric a comes after b in the server's order, by timestamp and then ID
+const isAfter = (a, b) => {
+  const diff = new Date(a.timestamp) - new Date(b.timestamp);
+  return diff > 0 || (diff === 0 && a.id > b.id);
+};
+
 export default function useWebSocketMetrics() {
   const [liveData, setLiveData] = useState({});
 
   useEffect(() => {
-    const socket = new WebSocket('ws://localhost:8080/ws');
+    let socket;
+    let reconnectTimer;
+    let closedByUs = false;
+    let last = null; // newest metric seen, whose cursor resumes without gaps or repeats
 
-    socket.onopen = () => console.log('WebSocket connected');
+    const connect = () => {
+      // The server replays recent history on connect, or everything after `since` when resuming
+      const query = last ? `?since=${encodeURIComponent(`${last.timestamp}/${last.id}`)}` : '';
+      socket = new WebSocket(`ws://localhost:8080/ws${query}`);
 
-    socket.onmessage = (event) => {
-      try {
-        const data = JSON.parse(event.data); // should be an array of metrics
-        const grouped = {};
+      socket.onopen = () => console.log('WebSocket connected');
 
-        for (const metric of data) {
-          const { url, timestamp, latency_ms } = metric;
-
-          if (!grouped[url]) {
-            grouped[url] = [];
+      socket.onmessage = (event) => {
+        try {
+          const data = JSON.parse(event.data); // should be an array of metrics
+          if (!Array.isArray(data)) {
+            return; // subscription acknowledgements and errors
           }
+          const grouped = {};
 
-          grouped[url].push({
-            timestamp: new Date(timestamp).toLocaleString(),
-            latency: latency_ms,
-          });
-        }
+          for (const metric of data) {
+            const { url, timestamp, latency_ms } = metric;
+            if (!last || isAfter(metric, last)) {
+              last = metric;
+            }
 
-        // Merge new data into state per URL
-        setLiveData(prev => {
-          const updated = { ...prev };
-          for (const url in grouped) {
-            if (!updated[url]) {
-              updated[url] = [];
+            if (!grouped[url]) {
+              grouped[url] = [];
             }
-            updated[url] = [...updated[url], ...grouped[url]].slice(-50); // keep last 50 points
+
+            grouped[url].push({
+              timestamp: new Date(timestamp).toLocaleString(),
+              latency: latency_ms,
+            });
           }
-          return updated;
-        });
 
-      } catch (err) {
-        console.error('Failed to parse message:', err);
-      }
+          // Merge new data into state per URL
+          setLiveData(prev => {
+            const updated = { ...prev };
+            for (const url in grouped) {
+              if (!updated[url]) {
+                updated[url] = [];
+              }
+              updated[url] = [...updated[url], ...grouped[url]].slice(-50); // keep last 50 points
+            }
+            return updated;
+          });
+
+        } catch (err) {
+          console.error('Failed to parse message:', err);
+        }
+      };
+
+      socket.onerror = (err) => console.error('WebSocket error:', err);
+      socket.onclose = () => {
+        console.log('WebSocket closed');
+        if (!closedByUs) {
+          reconnectTimer = setTimeout(connect, RECONNECT_DELAY_MS);
+        }
+      };
     };
 
-    socket.onerror = (err) => console.error('WebSocket error:', err);
-    socket.onclose = () => console.log('WebSocket closed');
+    connect();
 
-    return () => socket.close();
+    return () => {
+      closedByUs = true;
+      clearTimeout(reconnectTimer);
+      socket.close();
+    };
   }, []);
 
   return liveData;